@@ -0,0 +1,234 @@
+// Package audit keeps the append-only log of administrative and
+// authentication actions. Entries of a tenant form a hash chain: each one
+// hashes its content together with the hash of the entry before it.
+package audit
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"ithelp/models"
+	"ithelp/tenants"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Entry is one audited action. Before and After are snapshots of the
+// entity, marshalled to JSON; nil leaves them out.
+type Entry struct {
+	TenantID  int
+	ActorID   *int
+	ActorRole string
+	Action    string // e.g. user.delete, plan.update, auth.login
+	Entity    string // e.g. users, plans
+	EntityID  string
+	Before    any
+	After     any
+	IP        string
+	UserAgent string
+}
+
+// FromRequest starts an entry with the tenant, actor, IP and user agent of
+// the current request.
+func FromRequest(c *fiber.Ctx, action, entity string, entityID any) Entry {
+	e := Entry{
+		TenantID:  tenants.DefaultID,
+		Action:    action,
+		Entity:    entity,
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+	if entityID != nil {
+		e.EntityID = fmt.Sprint(entityID)
+	}
+	if t, ok := c.Locals("tenant").(models.Tenant); ok {
+		e.TenantID = t.ID
+	}
+	if user, ok := c.Locals("user").(models.User); ok && user.ID != 0 {
+		id := user.ID
+		e.ActorID, e.ActorRole = &id, user.Role
+		if user.TenantID != 0 {
+			e.TenantID = user.TenantID
+		}
+	}
+	return e
+}
+
+// Log records an entry for the current request and marks the request as
+// audited, so Middleware does not add a generic entry for it. A failure is
+// logged: the action already happened and is not undone.
+func Log(c *fiber.Ctx, database *sql.DB, e Entry) {
+	c.Locals("audited", true)
+	if err := Record(database, e); err != nil {
+		log.Printf("audit: recording %s failed: %v", e.Action, err)
+	}
+}
+
+func snapshot(v any) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func nullable(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// hashEntry hashes the fields of an entry, each prefixed by its length so
+// that no two different entries give the same input.
+func hashEntry(prev string, tenant int, actorID *int, actorRole, action, entity, entityID, before, after, ip, userAgent string, at time.Time) string {
+	actor := ""
+	if actorID != nil {
+		actor = strconv.Itoa(*actorID)
+	}
+	h := sha256.New()
+	for _, f := range []string{
+		prev, strconv.Itoa(tenant), actor, actorRole, action, entity, entityID, before, after, ip, userAgent,
+		at.UTC().Format("2006-01-02T15:04:05.000000Z"),
+	} {
+		fmt.Fprintf(h, "%d:%s;", len(f), f)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Record appends e to the chain of its tenant.
+func Record(database *sql.DB, e Entry) error {
+	before, err := snapshot(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := snapshot(e.After)
+	if err != nil {
+		return err
+	}
+	if len(e.UserAgent) > 500 {
+		e.UserAgent = e.UserAgent[:500]
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT IGNORE INTO audit_chain (tenant_id) VALUES (?)`, e.TenantID); err != nil {
+		return err
+	}
+	var prev string
+	if err := tx.QueryRow(`SELECT last_hash FROM audit_chain WHERE tenant_id = ? FOR UPDATE`, e.TenantID).Scan(&prev); err != nil {
+		return err
+	}
+
+	at := time.Now().UTC().Truncate(time.Microsecond)
+	hash := hashEntry(prev, e.TenantID, e.ActorID, e.ActorRole, e.Action, e.Entity, e.EntityID, before, after, e.IP, e.UserAgent, at)
+	result, err := tx.Exec(`
+		INSERT INTO audit_log (tenant_id, actor_id, actor_role, action, entity, entity_id, before_data, after_data, ip, user_agent,
+			created_at, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.TenantID, e.ActorID, nullable(e.ActorRole), e.Action, e.Entity, nullable(e.EntityID), nullable(before), nullable(after),
+		nullable(e.IP), nullable(e.UserAgent), at, prev, hash)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	if _, err := tx.Exec(`UPDATE audit_chain SET last_id = ?, last_hash = ? WHERE tenant_id = ?`, id, hash, e.TenantID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Verification is the outcome of checking a tenant's chain.
+type Verification struct {
+	Entries  int    `json:"entries"`
+	Valid    bool   `json:"valid"`
+	BrokenAt *int64 `json:"broken_at,omitempty"` // first entry that does not fit the chain
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Verify recomputes the chain of a tenant from its first entry.
+func Verify(database *sql.DB, tenant int) (Verification, error) {
+	var v Verification
+	rows, err := database.Query(`
+		SELECT id, actor_id, COALESCE(actor_role, ''), action, entity, COALESCE(entity_id, ''), COALESCE(before_data, ''),
+			COALESCE(after_data, ''), COALESCE(ip, ''), COALESCE(user_agent, ''), created_at, prev_hash, hash
+		FROM audit_log WHERE tenant_id = ? ORDER BY id`, tenant)
+	if err != nil {
+		return v, err
+	}
+	defer rows.Close()
+
+	expected := ""
+	var lastID int64
+	for rows.Next() {
+		var id int64
+		var actorID *int
+		var actorRole, action, entity, entityID, before, after, ip, userAgent, prev, hash string
+		var at time.Time
+		if err := rows.Scan(&id, &actorID, &actorRole, &action, &entity, &entityID, &before, &after, &ip, &userAgent,
+			&at, &prev, &hash); err != nil {
+			return v, err
+		}
+		v.Entries++
+		switch {
+		case prev != expected:
+			v.BrokenAt, v.Reason = &id, "previous entry is missing or was changed"
+		case hashEntry(prev, tenant, actorID, actorRole, action, entity, entityID, before, after, ip, userAgent, at) != hash:
+			v.BrokenAt, v.Reason = &id, "entry was changed"
+		}
+		if v.BrokenAt != nil {
+			return v, nil
+		}
+		expected, lastID = hash, id
+	}
+	if err := rows.Err(); err != nil {
+		return v, err
+	}
+
+	// entries removed from the end leave the chain head pointing past them
+	var headID sql.NullInt64
+	var headHash string
+	err = database.QueryRow(`SELECT last_id, last_hash FROM audit_chain WHERE tenant_id = ?`, tenant).Scan(&headID, &headHash)
+	if err != nil && err != sql.ErrNoRows {
+		return v, err
+	}
+	if headHash != expected {
+		broken := headID.Int64
+		v.BrokenAt, v.Reason = &broken, fmt.Sprintf("entries after #%d are missing", lastID)
+		return v, nil
+	}
+	v.Valid = true
+	return v, nil
+}
+
+// sensitive request fields never stored in the log
+var redacted = []string{"password", "token", "secret"}
+
+// Redact decodes a JSON object request body with the values of sensitive
+// keys replaced, or returns nil when the body is no JSON object.
+func Redact(body []byte) any {
+	var m map[string]any
+	if json.Unmarshal(body, &m) != nil {
+		return nil
+	}
+	for k := range m {
+		lower := strings.ToLower(k)
+		for _, r := range redacted {
+			if strings.Contains(lower, r) {
+				m[k] = "[redacted]"
+			}
+		}
+	}
+	return m
+}
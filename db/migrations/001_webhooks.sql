@@ -0,0 +1,35 @@
+-- Outgoing webhooks
+
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    url VARCHAR(500) NOT NULL,
+    secret VARCHAR(128) NOT NULL,
+    event_types VARCHAR(500) NOT NULL, -- comma separated, e.g. "ticket.created,invoice.paid"
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    failure_count INT NOT NULL DEFAULT 0,
+    disabled_at DATETIME NULL,
+    created_by INT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    endpoint_id INT NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSON NOT NULL,
+    status ENUM('pending', 'delivered', 'failed') NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    response_code INT NULL,
+    response_body TEXT NULL,
+    last_error TEXT NULL,
+    next_attempt_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_webhook_deliveries_due (status, next_attempt_at),
+    INDEX idx_webhook_deliveries_endpoint (endpoint_id, created_at),
+    FOREIGN KEY (endpoint_id) REFERENCES webhook_endpoints(id) ON DELETE CASCADE
+);
+
+-- Marks users whose subscription.expired event has already been sent
+ALTER TABLE users ADD COLUMN subscription_expired_at DATETIME NULL;
@@ -0,0 +1,25 @@
+-- In-app notification center
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    type VARCHAR(64) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    request_id INT NULL,
+    read_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_notifications_user (user_id, read_at, created_at),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Missing rows fall back to the defaults in notifications.DefaultPreference
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INT NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    in_app TINYINT(1) NOT NULL DEFAULT 1,
+    email TINYINT(1) NOT NULL DEFAULT 0,
+    sms TINYINT(1) NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, event_type),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,38 @@
+-- Technician profiles, skills and service regions
+
+CREATE TABLE IF NOT EXISTS technician_profiles (
+    user_id INT PRIMARY KEY,
+    status ENUM('active', 'on_leave', 'inactive') NOT NULL DEFAULT 'active',
+    max_concurrent_tickets INT NOT NULL DEFAULT 5,
+    bio TEXT NULL,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- category matches support_requests.category
+CREATE TABLE IF NOT EXISTS technician_skills (
+    user_id INT NOT NULL,
+    category VARCHAR(100) NOT NULL,
+    PRIMARY KEY (user_id, category),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS technician_regions (
+    user_id INT NOT NULL,
+    region VARCHAR(100) NOT NULL,
+    PRIMARY KEY (user_id, region),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- weekday: 0 = Sunday ... 6 = Saturday
+CREATE TABLE IF NOT EXISTS technician_working_hours (
+    user_id INT NOT NULL,
+    weekday TINYINT NOT NULL,
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    PRIMARY KEY (user_id, weekday),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- district of the customer for onsite visits
+ALTER TABLE support_requests ADD COLUMN region VARCHAR(100) NULL;
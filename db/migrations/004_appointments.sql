@@ -0,0 +1,26 @@
+-- Onsite visit scheduling
+
+CREATE TABLE IF NOT EXISTS appointments (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    request_id INT NOT NULL,
+    technician_id INT NOT NULL,
+    customer_id INT NOT NULL,
+    address VARCHAR(500) NOT NULL,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NOT NULL,
+    status ENUM('scheduled', 'completed', 'cancelled') NOT NULL DEFAULT 'scheduled',
+    notes TEXT NULL,
+    cancel_reason VARCHAR(500) NULL,
+    reschedule_count INT NOT NULL DEFAULT 0,
+    created_by INT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_appointments_tech_time (technician_id, starts_at),
+    INDEX idx_appointments_customer (customer_id, starts_at),
+    FOREIGN KEY (request_id) REFERENCES support_requests(id) ON DELETE CASCADE,
+    FOREIGN KEY (technician_id) REFERENCES users(id),
+    FOREIGN KEY (customer_id) REFERENCES users(id)
+);
+
+-- secret token for the technician's iCalendar feed URL
+ALTER TABLE technician_profiles ADD COLUMN calendar_token VARCHAR(64) NULL UNIQUE;
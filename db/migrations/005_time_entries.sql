@@ -0,0 +1,20 @@
+-- Technician time tracking
+
+CREATE TABLE IF NOT EXISTS time_entries (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    request_id INT NOT NULL,
+    technician_id INT NOT NULL,
+    kind ENUM('remote', 'onsite', 'travel') NOT NULL,
+    started_at DATETIME NOT NULL,
+    ended_at DATETIME NULL, -- NULL while the timer is running
+    description VARCHAR(1000) NULL,
+    status ENUM('pending', 'approved', 'rejected') NOT NULL DEFAULT 'pending',
+    reviewed_by INT NULL,
+    reviewed_at DATETIME NULL,
+    reject_reason VARCHAR(500) NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_time_entries_tech (technician_id, started_at),
+    INDEX idx_time_entries_request (request_id),
+    FOREIGN KEY (request_id) REFERENCES support_requests(id) ON DELETE CASCADE,
+    FOREIGN KEY (technician_id) REFERENCES users(id)
+);
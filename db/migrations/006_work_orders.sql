@@ -0,0 +1,25 @@
+-- Digital work orders with customer sign-off
+
+CREATE TABLE IF NOT EXISTS work_orders (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    request_id INT NOT NULL,
+    appointment_id INT NULL,
+    technician_id INT NOT NULL,
+    summary TEXT NOT NULL,
+    parts_used JSON NULL, -- [{"name": "...", "quantity": 1}]
+    minutes_spent INT NOT NULL DEFAULT 0,
+    status ENUM('draft', 'signed') NOT NULL DEFAULT 'draft',
+    signer_name VARCHAR(255) NULL,
+    signature_path VARCHAR(500) NULL,
+    signed_at DATETIME NULL,
+    signed_latitude DECIMAL(9, 6) NULL,
+    signed_longitude DECIMAL(9, 6) NULL,
+    signed_ip VARCHAR(64) NULL,
+    pdf_path VARCHAR(500) NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_work_orders_request (request_id),
+    FOREIGN KEY (request_id) REFERENCES support_requests(id) ON DELETE CASCADE,
+    FOREIGN KEY (appointment_id) REFERENCES appointments(id) ON DELETE SET NULL,
+    FOREIGN KEY (technician_id) REFERENCES users(id)
+);
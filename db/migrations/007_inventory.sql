@@ -0,0 +1,85 @@
+-- Parts, stock and invoicing of consumed parts
+
+CREATE TABLE IF NOT EXISTS parts (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    sku VARCHAR(64) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    category VARCHAR(100) NULL,
+    unit_price DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    low_stock_threshold INT NOT NULL DEFAULT 0,
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- a warehouse, or the van of one technician
+CREATE TABLE IF NOT EXISTS stock_locations (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    type ENUM('warehouse', 'van') NOT NULL,
+    technician_id INT NULL UNIQUE,
+    FOREIGN KEY (technician_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS stock_levels (
+    part_id INT NOT NULL,
+    location_id INT NOT NULL,
+    quantity INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (part_id, location_id),
+    FOREIGN KEY (part_id) REFERENCES parts(id) ON DELETE CASCADE,
+    FOREIGN KEY (location_id) REFERENCES stock_locations(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    part_id INT NOT NULL,
+    from_location_id INT NULL,
+    to_location_id INT NULL,
+    quantity INT NOT NULL,
+    reason ENUM('receive', 'transfer', 'consume', 'adjust') NOT NULL,
+    request_id INT NULL,
+    created_by INT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_stock_movements_part (part_id, created_at),
+    FOREIGN KEY (part_id) REFERENCES parts(id) ON DELETE CASCADE
+);
+
+-- parts used on a support request, with the price at the time of use
+CREATE TABLE IF NOT EXISTS request_parts (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    request_id INT NOT NULL,
+    part_id INT NOT NULL,
+    location_id INT NOT NULL,
+    quantity INT NOT NULL,
+    unit_price DECIMAL(10, 2) NOT NULL,
+    billable TINYINT(1) NOT NULL DEFAULT 1,
+    created_by INT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_request_parts_request (request_id),
+    FOREIGN KEY (request_id) REFERENCES support_requests(id) ON DELETE CASCADE,
+    FOREIGN KEY (part_id) REFERENCES parts(id)
+);
+
+CREATE TABLE IF NOT EXISTS invoices (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    status ENUM('draft', 'issued', 'paid', 'void') NOT NULL DEFAULT 'draft',
+    total DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    issued_at DATETIME NULL,
+    paid_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_invoices_user (user_id, status),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS invoice_items (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    invoice_id INT NOT NULL,
+    request_id INT NULL,
+    request_part_id INT NULL,
+    description VARCHAR(500) NOT NULL,
+    quantity INT NOT NULL,
+    unit_price DECIMAL(10, 2) NOT NULL,
+    amount DECIMAL(12, 2) NOT NULL,
+    FOREIGN KEY (invoice_id) REFERENCES invoices(id) ON DELETE CASCADE,
+    FOREIGN KEY (request_part_id) REFERENCES request_parts(id) ON DELETE SET NULL
+);
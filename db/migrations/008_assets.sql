@@ -0,0 +1,24 @@
+-- Customer assets (laptops, printers, routers...) and their tickets
+
+CREATE TABLE IF NOT EXISTS assets (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    make VARCHAR(100) NULL,
+    model VARCHAR(100) NULL,
+    serial_number VARCHAR(100) NULL,
+    os VARCHAR(100) NULL,
+    purchase_date DATE NULL,
+    warranty_until DATE NULL,
+    notes TEXT NULL,
+    created_by INT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_assets_user (user_id),
+    INDEX idx_assets_serial (serial_number),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+ALTER TABLE support_requests
+    ADD COLUMN asset_id INT NULL,
+    ADD CONSTRAINT fk_support_requests_asset FOREIGN KEY (asset_id) REFERENCES assets(id) ON DELETE SET NULL;
@@ -0,0 +1,42 @@
+-- Business customers: organizations own a subscription shared by their members
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    subscription_plan VARCHAR(100) NULL,
+    subscription_start DATETIME NULL,
+    subscription_end DATETIME NULL,
+    subscription_expired_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- a user belongs to at most one organization
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization_id INT NOT NULL,
+    user_id INT NOT NULL UNIQUE,
+    role ENUM('org_admin', 'employee') NOT NULL DEFAULT 'employee',
+    joined_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id),
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS organization_invitations (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    organization_id INT NOT NULL,
+    phone VARCHAR(50) NULL,
+    email VARCHAR(255) NULL,
+    role ENUM('org_admin', 'employee') NOT NULL DEFAULT 'employee',
+    token CHAR(40) NOT NULL UNIQUE,
+    invited_by INT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    accepted_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+-- the organization whose quota the ticket was counted against
+ALTER TABLE support_requests
+    ADD COLUMN organization_id INT NULL,
+    ADD INDEX idx_support_requests_org (organization_id),
+    ADD CONSTRAINT fk_support_requests_org FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE SET NULL;
@@ -0,0 +1,53 @@
+-- Multi-tenant mode for reseller partners. Existing data belongs to tenant 1.
+
+CREATE TABLE IF NOT EXISTS tenants (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    slug VARCHAR(64) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    domain VARCHAR(255) NULL UNIQUE,
+    brand_name VARCHAR(255) NULL,
+    logo_url VARCHAR(500) NULL,
+    primary_color VARCHAR(16) NULL,
+    support_email VARCHAR(255) NULL,
+    support_phone VARCHAR(50) NULL,
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT IGNORE INTO tenants (id, slug, name) VALUES (1, 'default', 'IT Help');
+
+ALTER TABLE users
+    ADD COLUMN tenant_id INT NOT NULL DEFAULT 1,
+    ADD INDEX idx_users_tenant (tenant_id, role),
+    ADD UNIQUE INDEX uq_users_tenant_phone (tenant_id, phone),
+    ADD CONSTRAINT fk_users_tenant FOREIGN KEY (tenant_id) REFERENCES tenants(id);
+
+ALTER TABLE support_requests
+    ADD COLUMN tenant_id INT NOT NULL DEFAULT 1,
+    ADD INDEX idx_support_requests_tenant (tenant_id, status),
+    ADD CONSTRAINT fk_support_requests_tenant FOREIGN KEY (tenant_id) REFERENCES tenants(id);
+
+ALTER TABLE plans
+    ADD COLUMN tenant_id INT NOT NULL DEFAULT 1,
+    ADD INDEX idx_plans_tenant (tenant_id, name),
+    ADD CONSTRAINT fk_plans_tenant FOREIGN KEY (tenant_id) REFERENCES tenants(id);
+
+ALTER TABLE tech_notes
+    ADD COLUMN tenant_id INT NOT NULL DEFAULT 1,
+    ADD INDEX idx_tech_notes_tenant (tenant_id),
+    ADD CONSTRAINT fk_tech_notes_tenant FOREIGN KEY (tenant_id) REFERENCES tenants(id);
+
+-- tables added since that are not reached through a user or a ticket
+ALTER TABLE organizations ADD COLUMN tenant_id INT NOT NULL DEFAULT 1, ADD INDEX idx_organizations_tenant (tenant_id);
+ALTER TABLE webhook_endpoints ADD COLUMN tenant_id INT NOT NULL DEFAULT 1, ADD INDEX idx_webhook_endpoints_tenant (tenant_id);
+ALTER TABLE parts
+    ADD COLUMN tenant_id INT NOT NULL DEFAULT 1,
+    DROP INDEX sku,
+    ADD UNIQUE INDEX uq_parts_tenant_sku (tenant_id, sku);
+ALTER TABLE stock_locations ADD COLUMN tenant_id INT NOT NULL DEFAULT 1, ADD INDEX idx_stock_locations_tenant (tenant_id);
+
+-- phone and email were unique across the whole platform; they are unique per
+-- tenant now (uq_users_tenant_phone). Drop the old global unique index on
+-- users.phone/email if your schema has one, e.g.:
+-- ALTER TABLE users DROP INDEX phone;
+-- ALTER TABLE users DROP INDEX email;
@@ -0,0 +1,41 @@
+-- Knowledge base articles and the suggestions shown before a ticket is filed
+
+CREATE TABLE IF NOT EXISTS kb_articles (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    category VARCHAR(100) NOT NULL, -- same values as support_requests.category
+    title VARCHAR(255) NOT NULL,
+    body MEDIUMTEXT NOT NULL, -- markdown
+    status ENUM('draft', 'published') NOT NULL DEFAULT 'draft',
+    author_id INT NOT NULL,
+    view_count INT NOT NULL DEFAULT 0,
+    helpful_count INT NOT NULL DEFAULT 0,
+    not_helpful_count INT NOT NULL DEFAULT 0,
+    published_at DATETIME NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_kb_articles_tenant (tenant_id, status, category),
+    FULLTEXT INDEX ft_kb_articles (title, body),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (author_id) REFERENCES users(id)
+);
+
+-- One row per suggest call that returned articles. A suggestion is deflected
+-- when the customer opened an article and did not file the ticket, or said
+-- the article solved the problem.
+CREATE TABLE IF NOT EXISTS kb_suggestions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    user_id INT NOT NULL,
+    query VARCHAR(255) NOT NULL,
+    category VARCHAR(100) NULL,
+    article_ids VARCHAR(255) NOT NULL,
+    opened_article_id INT NULL,
+    resolved TINYINT(1) NOT NULL DEFAULT 0,
+    request_id INT NULL, -- set when a ticket was filed anyway
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_kb_suggestions_tenant (tenant_id, created_at),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (opened_article_id) REFERENCES kb_articles(id) ON DELETE SET NULL,
+    FOREIGN KEY (request_id) REFERENCES support_requests(id) ON DELETE SET NULL
+);
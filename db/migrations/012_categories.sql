@@ -0,0 +1,38 @@
+-- Ticket categories managed by admins, with custom fields and SLA defaults
+
+CREATE TABLE IF NOT EXISTS ticket_categories (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    parent_id INT NULL,
+    name VARCHAR(100) NOT NULL,
+    default_priority ENUM('low', 'normal', 'high', 'urgent') NULL, -- NULL inherits from the parent
+    sla_hours INT NULL,                                            -- hours to resolve, NULL inherits
+    sort_order INT NOT NULL DEFAULT 0,
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX uq_ticket_categories_name (tenant_id, parent_id, name),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (parent_id) REFERENCES ticket_categories(id)
+);
+
+-- Fields asked for when a ticket of the category (or a subcategory) is filed
+CREATE TABLE IF NOT EXISTS category_fields (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    category_id INT NOT NULL,
+    field_key VARCHAR(64) NOT NULL,
+    label VARCHAR(255) NOT NULL,
+    type ENUM('text', 'number', 'select', 'date', 'asset') NOT NULL,
+    required TINYINT(1) NOT NULL DEFAULT 0,
+    options TEXT NULL, -- JSON array of choices for select fields
+    sort_order INT NOT NULL DEFAULT 0,
+    UNIQUE INDEX uq_category_fields_key (category_id, field_key),
+    FOREIGN KEY (category_id) REFERENCES ticket_categories(id) ON DELETE CASCADE
+);
+
+ALTER TABLE support_requests
+    ADD COLUMN category_id INT NULL,
+    ADD COLUMN priority ENUM('low', 'normal', 'high', 'urgent') NOT NULL DEFAULT 'normal',
+    ADD COLUMN due_at DATETIME NULL,
+    ADD COLUMN custom_fields JSON NULL,
+    ADD INDEX idx_support_requests_category (category_id),
+    ADD CONSTRAINT fk_support_requests_category FOREIGN KEY (category_id) REFERENCES ticket_categories(id);
@@ -0,0 +1,21 @@
+-- Customer satisfaction surveys sent when a ticket is resolved
+
+CREATE TABLE IF NOT EXISTS csat_surveys (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    request_id INT NOT NULL UNIQUE, -- one survey per ticket, even if it is resolved again
+    customer_id INT NOT NULL,
+    technician_id INT NULL,
+    category_id INT NULL,
+    category VARCHAR(255) NULL,
+    rating TINYINT NULL, -- 1..5, NULL until answered
+    comment TEXT NULL,
+    sent_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reminded_at DATETIME NULL,
+    responded_at DATETIME NULL,
+    INDEX idx_csat_surveys_tenant (tenant_id, responded_at),
+    INDEX idx_csat_surveys_technician (technician_id),
+    FOREIGN KEY (request_id) REFERENCES support_requests(id) ON DELETE CASCADE,
+    FOREIGN KEY (customer_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (technician_id) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,35 @@
+-- Reopening, merging and linking tickets, with a history of those actions
+
+ALTER TABLE support_requests
+    ADD COLUMN resolved_at DATETIME NULL,
+    ADD COLUMN reopen_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN merged_into INT NULL,
+    ADD CONSTRAINT fk_support_requests_merged FOREIGN KEY (merged_into) REFERENCES support_requests(id);
+
+-- type 'parent': linked_request_id is the parent of request_id.
+-- type 'related': stored once, with the lower id in request_id.
+CREATE TABLE IF NOT EXISTS ticket_links (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    request_id INT NOT NULL,
+    linked_request_id INT NOT NULL,
+    type ENUM('parent', 'related') NOT NULL,
+    created_by INT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX uq_ticket_links (request_id, linked_request_id),
+    INDEX idx_ticket_links_linked (linked_request_id),
+    FOREIGN KEY (request_id) REFERENCES support_requests(id) ON DELETE CASCADE,
+    FOREIGN KEY (linked_request_id) REFERENCES support_requests(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS ticket_history (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    request_id INT NOT NULL,
+    actor_id INT NULL,
+    action VARCHAR(32) NOT NULL, -- status, reopened, merged, merged_from, linked, unlinked
+    from_status VARCHAR(50) NULL,
+    to_status VARCHAR(50) NULL,
+    detail VARCHAR(500) NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_ticket_history_request (request_id, id),
+    FOREIGN KEY (request_id) REFERENCES support_requests(id) ON DELETE CASCADE
+);
@@ -0,0 +1,33 @@
+-- Canned responses and macros for technicians, and internal notes
+
+-- internal notes are only shown to staff; other notes are replies the customer sees
+ALTER TABLE tech_notes
+    ADD COLUMN internal TINYINT(1) NOT NULL DEFAULT 0;
+
+-- owner_id NULL: shared with every technician of the tenant, otherwise personal
+CREATE TABLE IF NOT EXISTS canned_responses (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    owner_id INT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_canned_responses_tenant (tenant_id, owner_id),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- actions is a JSON array like [{"type": "set_status", "status": "resolved"}, {"type": "reply", "body": "..."}]
+CREATE TABLE IF NOT EXISTS macros (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    owner_id INT NULL,
+    name VARCHAR(255) NOT NULL,
+    actions JSON NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_macros_tenant (tenant_id, owner_id),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
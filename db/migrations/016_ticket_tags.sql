@@ -0,0 +1,10 @@
+-- Free-form tags on support requests, lowercased
+
+CREATE TABLE IF NOT EXISTS ticket_tags (
+    request_id INT NOT NULL,
+    tag VARCHAR(50) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (request_id, tag),
+    INDEX idx_ticket_tags_tag (tag),
+    FOREIGN KEY (request_id) REFERENCES support_requests(id) ON DELETE CASCADE
+);
@@ -0,0 +1,17 @@
+-- Saved ticket views: a stored filter and sort, personal or shared with a role
+
+CREATE TABLE IF NOT EXISTS saved_views (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    owner_id INT NULL, -- personal view; NULL when shared with role
+    role ENUM('admin', 'tech') NULL,
+    name VARCHAR(255) NOT NULL,
+    filter JSON NOT NULL,
+    sort VARCHAR(32) NULL,
+    sort_order ENUM('asc', 'desc') NOT NULL DEFAULT 'desc',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_saved_views_tenant (tenant_id, owner_id),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,39 @@
+-- Recurring preventive maintenance: schedules that create support requests
+
+CREATE TABLE IF NOT EXISTS recurring_tickets (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    customer_id INT NOT NULL, -- owner of the created tickets
+    organization_id INT NULL, -- tickets go on the organization's account
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL,
+    category_id INT NULL,
+    custom_fields JSON NULL,
+    region VARCHAR(100) NULL,
+    technician_id INT NULL, -- the usual technician, assigned to every ticket
+    schedule VARCHAR(255) NOT NULL, -- cron ("0 9 1 * *") or RRULE ("FREQ=MONTHLY;BYMONTHDAY=1;BYHOUR=9")
+    starts_at DATETIME NOT NULL,
+    lead_days INT NOT NULL DEFAULT 3, -- tickets are created this long before the occurrence
+    onsite TINYINT(1) NOT NULL DEFAULT 1, -- book a visit at the occurrence, counted against the onsite quota
+    address VARCHAR(500) NULL,
+    visit_minutes INT NOT NULL DEFAULT 60,
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    next_run_at DATETIME NULL, -- next occurrence, NULL once the schedule has ended
+    last_run_at DATETIME NULL,
+    last_error VARCHAR(500) NULL,
+    created_by INT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_recurring_tickets_due (active, next_run_at),
+    INDEX idx_recurring_tickets_tenant (tenant_id),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (customer_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES ticket_categories(id) ON DELETE SET NULL,
+    FOREIGN KEY (technician_id) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+ALTER TABLE support_requests
+    ADD COLUMN recurring_id INT NULL,
+    ADD CONSTRAINT fk_support_requests_recurring FOREIGN KEY (recurring_id) REFERENCES recurring_tickets(id) ON DELETE SET NULL;
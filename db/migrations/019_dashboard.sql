@@ -0,0 +1,15 @@
+-- Admin dashboard: registration dates and indexes for its aggregates
+
+-- existing users get the migration time
+ALTER TABLE users
+    ADD COLUMN registered_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD INDEX idx_users_tenant_registered (tenant_id, registered_at);
+
+ALTER TABLE support_requests
+    ADD INDEX idx_support_requests_tenant_status (tenant_id, status),
+    ADD INDEX idx_support_requests_tenant_created (tenant_id, created_at),
+    ADD INDEX idx_support_requests_tenant_resolved (tenant_id, resolved_at),
+    ADD INDEX idx_support_requests_tenant_due (tenant_id, due_at);
+
+ALTER TABLE tech_notes
+    ADD INDEX idx_tech_notes_request_created (request_id, internal, created_at);
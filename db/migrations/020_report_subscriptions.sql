@@ -0,0 +1,39 @@
+-- Scheduled reports emailed to managers, with a history of every run
+
+CREATE TABLE IF NOT EXISTS report_subscriptions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    name VARCHAR(255) NOT NULL,
+    report VARCHAR(50) NOT NULL, -- tickets, technicians, plan-usage, revenue
+    filters JSON NULL, -- query-string filters of the report, e.g. {"status": "open"}
+    format ENUM('csv', 'xlsx') NOT NULL DEFAULT 'xlsx',
+    recipients JSON NOT NULL, -- email addresses
+    schedule VARCHAR(255) NOT NULL, -- cron ("0 8 * * 1") or RRULE
+    period_days INT NOT NULL DEFAULT 7, -- from/to cover the days before the run; 0 keeps those in filters
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    next_run_at DATETIME NULL,
+    last_run_at DATETIME NULL,
+    last_error VARCHAR(1000) NULL,
+    created_by INT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_report_subscriptions_due (active, next_run_at),
+    INDEX idx_report_subscriptions_tenant (tenant_id),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS report_runs (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    subscription_id INT NOT NULL,
+    status ENUM('running', 'sent', 'failed') NOT NULL DEFAULT 'running',
+    manual TINYINT(1) NOT NULL DEFAULT 0, -- started from the API instead of the schedule
+    period_from DATE NULL,
+    period_to DATE NULL,
+    size_bytes INT NULL,
+    error VARCHAR(1000) NULL,
+    started_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at DATETIME NULL,
+    INDEX idx_report_runs_subscription (subscription_id, started_at),
+    FOREIGN KEY (subscription_id) REFERENCES report_subscriptions(id) ON DELETE CASCADE
+);
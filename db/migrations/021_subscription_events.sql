@@ -0,0 +1,47 @@
+-- Subscription ledger: every start, plan change and end of a user's or an
+-- organization's subscription, with the monthly recurring revenue before and
+-- after it. Analytics replay it instead of reading the current columns.
+
+CREATE TABLE IF NOT EXISTS subscription_events (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    -- exactly one of user_id and organization_id is set; no foreign keys so the
+    -- history survives deleting the customer
+    user_id INT NULL,
+    organization_id INT NULL,
+    type ENUM('started', 'renewed', 'upgraded', 'downgraded', 'changed', 'cancelled', 'expired') NOT NULL,
+    from_plan VARCHAR(100) NULL,
+    to_plan VARCHAR(100) NULL,
+    mrr_before DECIMAL(12, 2) NOT NULL DEFAULT 0, -- monthly plan price
+    mrr_after DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    period_start DATETIME NULL,
+    period_end DATETIME NULL,
+    actor_id INT NULL, -- NULL for the expiry job
+    occurred_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_subscription_events_tenant (tenant_id, occurred_at),
+    INDEX idx_subscription_events_user (user_id),
+    INDEX idx_subscription_events_org (organization_id),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id)
+);
+
+-- seed the ledger with the subscriptions that exist today
+INSERT INTO subscription_events (tenant_id, user_id, type, to_plan, mrr_after, period_start, period_end, occurred_at)
+SELECT u.tenant_id, u.id, 'started', u.subscription_plan, COALESCE(p.price, 0), u.subscription_start, u.subscription_end, u.subscription_start
+FROM users u LEFT JOIN plans p ON p.name = u.subscription_plan AND p.tenant_id = u.tenant_id
+WHERE u.subscription_plan IS NOT NULL AND u.subscription_plan <> '' AND u.subscription_start IS NOT NULL;
+
+INSERT INTO subscription_events (tenant_id, user_id, type, from_plan, mrr_before, occurred_at)
+SELECT u.tenant_id, u.id, 'expired', u.subscription_plan, COALESCE(p.price, 0), u.subscription_end
+FROM users u LEFT JOIN plans p ON p.name = u.subscription_plan AND p.tenant_id = u.tenant_id
+WHERE u.subscription_plan IS NOT NULL AND u.subscription_plan <> '' AND u.subscription_start IS NOT NULL
+    AND u.subscription_expired_at IS NOT NULL;
+
+INSERT INTO subscription_events (tenant_id, organization_id, type, to_plan, mrr_after, period_start, period_end, occurred_at)
+SELECT o.tenant_id, o.id, 'started', o.subscription_plan, COALESCE(p.price, 0), o.subscription_start, o.subscription_end, o.subscription_start
+FROM organizations o LEFT JOIN plans p ON p.name = o.subscription_plan AND p.tenant_id = o.tenant_id
+WHERE o.subscription_plan IS NOT NULL AND o.subscription_start IS NOT NULL;
+
+INSERT INTO subscription_events (tenant_id, organization_id, type, from_plan, mrr_before, occurred_at)
+SELECT o.tenant_id, o.id, 'expired', o.subscription_plan, COALESCE(p.price, 0), o.subscription_end
+FROM organizations o LEFT JOIN plans p ON p.name = o.subscription_plan AND p.tenant_id = o.tenant_id
+WHERE o.subscription_plan IS NOT NULL AND o.subscription_start IS NOT NULL AND o.subscription_expired_at IS NOT NULL;
@@ -0,0 +1,38 @@
+-- Append-only audit log of administrative and authentication actions. Each
+-- entry stores the hash of the previous entry of its tenant, so editing,
+-- removing or reordering entries breaks the chain (GET /api/admin/audit/verify).
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    actor_id INT NULL, -- NULL for anonymous actions such as failed logins; no foreign key, deleted users stay referenced
+    actor_role VARCHAR(20) NULL,
+    action VARCHAR(100) NOT NULL, -- user.delete, plan.update, auth.login_failed, or "METHOD /route" for generic entries
+    entity VARCHAR(64) NOT NULL,
+    entity_id VARCHAR(64) NULL,
+    before_data MEDIUMTEXT NULL, -- JSON snapshots kept as text: the hash covers their exact bytes
+    after_data MEDIUMTEXT NULL,
+    ip VARCHAR(45) NULL,
+    user_agent VARCHAR(500) NULL,
+    created_at DATETIME(6) NOT NULL,
+    prev_hash CHAR(64) NOT NULL, -- empty for the first entry of a tenant
+    hash CHAR(64) NOT NULL,
+    INDEX idx_audit_log_tenant (tenant_id, id),
+    INDEX idx_audit_log_actor (tenant_id, actor_id, created_at),
+    INDEX idx_audit_log_entity (tenant_id, entity, entity_id),
+    INDEX idx_audit_log_action (tenant_id, action, created_at),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id)
+);
+
+-- head of each tenant's chain; locking its row serializes appends
+CREATE TABLE IF NOT EXISTS audit_chain (
+    tenant_id INT PRIMARY KEY,
+    last_id BIGINT NULL,
+    last_hash CHAR(64) NOT NULL DEFAULT ''
+);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+    FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+    FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
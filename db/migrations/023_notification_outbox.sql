@@ -0,0 +1,18 @@
+-- Notifications are written here together with the change that caused them
+-- and sent by the notifier, so no message is lost when the event hub drops
+-- an event under load.
+
+CREATE TABLE IF NOT EXISTS notification_outbox (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    user_id INT NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    request_id INT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at DATETIME NULL, -- set when a notifier claims the message
+    INDEX idx_notification_outbox_pending (sent_at, id),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,6 @@
+-- Surveys are created together with the status change that resolves the
+-- ticket and sent afterwards; delivered_at stays NULL until the link went out.
+
+ALTER TABLE csat_surveys ADD COLUMN delivered_at DATETIME NULL AFTER sent_at;
+UPDATE csat_surveys SET delivered_at = sent_at;
+CREATE INDEX idx_csat_surveys_undelivered ON csat_surveys (delivered_at);
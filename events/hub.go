@@ -0,0 +1,182 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"ithelp/models"
+)
+
+// Event types pushed to real-time clients
+const (
+	TicketCreated  = "ticket.created"
+	TicketUpdated  = "ticket.updated"
+	TicketAssigned = "ticket.assigned"
+	NoteAdded      = "note.added"
+
+	TicketStatusChanged = "ticket.status_changed"
+	UserRegistered      = "user.registered"
+	SubscriptionExpired = "subscription.expired"
+	InvoicePaid         = "invoice.paid"
+
+	AppointmentScheduled   = "appointment.scheduled"
+	AppointmentRescheduled = "appointment.rescheduled"
+	AppointmentCancelled   = "appointment.cancelled"
+
+	StockLow = "stock.low"
+)
+
+type Event struct {
+	TenantID   int            `json:"tenant_id"`
+	Type       string         `json:"type"`
+	RequestID  int            `json:"request_id,omitempty"`
+	UserID     int            `json:"user_id,omitempty"`     // ticket owner
+	AssignedTo *int           `json:"assigned_to,omitempty"` // technician on the ticket
+	Data       map[string]any `json:"data,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// VisibleTo reports whether the user is allowed to receive the event.
+// Nobody sees events of another tenant. Admins see everything in their tenant,
+// customers their own tickets (without internal notes), techs the tickets
+// assigned to them.
+func (e Event) VisibleTo(user models.User) bool {
+	if e.TenantID != user.TenantID {
+		return false
+	}
+	switch user.Role {
+	case "admin":
+		return true
+	case "tech":
+		return e.AssignedTo != nil && *e.AssignedTo == user.ID
+	default:
+		return e.UserID != 0 && e.UserID == user.ID && e.Data["internal"] != true
+	}
+}
+
+// Broker moves events between app instances. The hub publishes every event
+// to the broker and delivers whatever the broker hands back to local subscribers.
+type Broker interface {
+	Publish(e Event) error
+	Subscribe(handler func(Event)) error
+}
+
+// LocalBroker delivers events inside the current process only.
+type LocalBroker struct {
+	mu       sync.RWMutex
+	handlers []func(Event)
+}
+
+func NewLocalBroker() *LocalBroker {
+	return &LocalBroker{}
+}
+
+func (b *LocalBroker) Publish(e Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, h := range b.handlers {
+		h(e)
+	}
+	return nil
+}
+
+func (b *LocalBroker) Subscribe(handler func(Event)) error {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+	return nil
+}
+
+type Subscription struct {
+	C      chan Event
+	filter func(Event) bool
+}
+
+type Hub struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	broker Broker
+}
+
+func NewHub(broker Broker) *Hub {
+	h := &Hub{subs: make(map[*Subscription]struct{}), broker: broker}
+	if err := broker.Subscribe(h.deliver); err != nil {
+		log.Printf("events: broker subscribe failed: %v", err)
+	}
+	return h
+}
+
+// Subscribe registers a listener. Only events passing filter are sent to it.
+func (h *Hub) Subscribe(filter func(Event) bool) *Subscription {
+	s := &Subscription{C: make(chan Event, 32), filter: filter}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.C)
+	}
+	h.mu.Unlock()
+}
+
+func (h *Hub) Publish(e Event) {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	if err := h.broker.Publish(e); err != nil {
+		log.Printf("events: publish %s failed: %v", e.Type, err)
+	}
+}
+
+func (h *Hub) deliver(e Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subs {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.C <- e:
+		default:
+			// slow client, drop rather than block publishers
+			log.Printf("events: dropping %s for slow subscriber", e.Type)
+		}
+	}
+}
+
+var (
+	defaultMu  sync.Mutex
+	defaultHub = NewHub(NewLocalBroker())
+)
+
+// UseBroker replaces the default hub with one backed by the given broker.
+// Call it once at startup, before any subscribers are registered.
+func UseBroker(b Broker) {
+	defaultMu.Lock()
+	defaultHub = NewHub(b)
+	defaultMu.Unlock()
+}
+
+func Default() *Hub {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultHub
+}
+
+func Publish(e Event) {
+	Default().Publish(e)
+}
+
+func Subscribe(filter func(Event) bool) *Subscription {
+	return Default().Subscribe(filter)
+}
+
+func Unsubscribe(s *Subscription) {
+	Default().Unsubscribe(s)
+}
@@ -0,0 +1,39 @@
+package events
+
+import (
+	"testing"
+
+	"ithelp/models"
+)
+
+func TestVisibleTo(t *testing.T) {
+	tech := 5
+	ticket := Event{TenantID: 2, Type: TicketUpdated, RequestID: 10, UserID: 4, AssignedTo: &tech}
+	note := Event{TenantID: 2, Type: NoteAdded, RequestID: 10, UserID: 4, AssignedTo: &tech, Data: map[string]any{"internal": true}}
+
+	tests := []struct {
+		name  string
+		event Event
+		user  models.User
+		want  bool
+	}{
+		{"admin of the tenant", ticket, models.User{ID: 1, Role: "admin", TenantID: 2}, true},
+		{"admin of another tenant", ticket, models.User{ID: 1, Role: "admin", TenantID: 3}, false},
+		{"assigned tech", ticket, models.User{ID: 5, Role: "tech", TenantID: 2}, true},
+		{"assigned tech id in another tenant", ticket, models.User{ID: 5, Role: "tech", TenantID: 3}, false},
+		{"other tech", ticket, models.User{ID: 6, Role: "tech", TenantID: 2}, false},
+		{"ticket owner", ticket, models.User{ID: 4, Role: "user", TenantID: 2}, true},
+		{"owner id in another tenant", ticket, models.User{ID: 4, Role: "user", TenantID: 3}, false},
+		{"other customer", ticket, models.User{ID: 8, Role: "user", TenantID: 2}, false},
+		{"internal note to owner", note, models.User{ID: 4, Role: "user", TenantID: 2}, false},
+		{"internal note to tech", note, models.User{ID: 5, Role: "tech", TenantID: 2}, true},
+		{"event without owner", Event{TenantID: 2, Type: StockLow}, models.User{ID: 0, Role: "user", TenantID: 2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.VisibleTo(tt.user); got != tt.want {
+				t.Errorf("VisibleTo = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
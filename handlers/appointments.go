@@ -0,0 +1,749 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"ithelp/db"
+	"ithelp/events"
+	"ithelp/models"
+	"ithelp/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	slotStep                = 30 * time.Minute
+	defaultVisitDuration    = 60 * time.Minute
+	maxCustomerReschedules  = 3
+	defaultChangeCutoffHour = 24
+)
+
+// Working hours used for technicians that have none configured: Mon-Sat 09:00-18:00
+var defaultWorkingHours = []models.WorkingHours{
+	{Weekday: 1, StartTime: "09:00", EndTime: "18:00"},
+	{Weekday: 2, StartTime: "09:00", EndTime: "18:00"},
+	{Weekday: 3, StartTime: "09:00", EndTime: "18:00"},
+	{Weekday: 4, StartTime: "09:00", EndTime: "18:00"},
+	{Weekday: 5, StartTime: "09:00", EndTime: "18:00"},
+	{Weekday: 6, StartTime: "09:00", EndTime: "18:00"},
+}
+
+// changeCutoff is how long before a visit customers may still move or cancel it.
+func changeCutoff() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("APPOINTMENT_CHANGE_CUTOFF_HOURS"))
+	if err != nil || hours < 0 {
+		hours = defaultChangeCutoffHour
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// workingWindow returns the technician's shift on the day of t, in the business timezone.
+func workingWindow(hours []models.WorkingHours, day time.Time) (time.Time, time.Time, bool) {
+	if len(hours) == 0 {
+		hours = defaultWorkingHours
+	}
+	day = day.In(utils.BusinessLocation())
+	for _, h := range hours {
+		if h.Weekday != int(day.Weekday()) {
+			continue
+		}
+		start, err1 := time.Parse("15:04", h.StartTime)
+		end, err2 := time.Parse("15:04", h.EndTime)
+		if err1 != nil || err2 != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		y, m, d := day.Date()
+		return time.Date(y, m, d, start.Hour(), start.Minute(), 0, 0, day.Location()),
+			time.Date(y, m, d, end.Hour(), end.Minute(), 0, 0, day.Location()), true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// checkVisitWindow validates a booking against the technician's status,
+// working hours and existing appointments. excludeID skips the appointment being moved.
+// It locks the technician in tx, so the caller writes the visit in tx and two
+// bookings of the same technician cannot both pass.
+func checkVisitWindow(database *sql.DB, tx *sql.Tx, techID int, start, end time.Time, excludeID int) error {
+	if !end.After(start) {
+		return fiber.NewError(fiber.StatusBadRequest, "End time must be after start time")
+	}
+	if start.Before(time.Now()) {
+		return fiber.NewError(fiber.StatusBadRequest, "Appointment must be in the future")
+	}
+
+	tech, err := loadTechnicianProfile(database, techID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusBadRequest, "Technician not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if tech.Status != models.TechStatusActive {
+		return fiber.NewError(fiber.StatusConflict, "Technician is not available")
+	}
+
+	shiftStart, shiftEnd, ok := workingWindow(tech.WorkingHours, start)
+	if !ok || start.Before(shiftStart) || end.After(shiftEnd) {
+		return fiber.NewError(fiber.StatusConflict, "Outside the technician's working hours")
+	}
+
+	// the user row always exists, a technician profile may not
+	var locked int
+	if err := tx.QueryRow(`SELECT id FROM users WHERE id = ? FOR UPDATE`, techID).Scan(&locked); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	var conflicts int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM appointments
+		WHERE technician_id = ? AND status = 'scheduled' AND id <> ?
+		AND starts_at < ? AND ends_at > ?
+	`, techID, excludeID, end, start).Scan(&conflicts)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if conflicts > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Technician already has a visit at that time")
+	}
+	return nil
+}
+
+func scanAppointment(scan func(dest ...any) error) (models.Appointment, error) {
+	var a models.Appointment
+	var notes, reason sql.NullString
+	err := scan(&a.ID, &a.RequestID, &a.TechnicianID, &a.CustomerID, &a.Address, &a.StartsAt, &a.EndsAt,
+		&a.Status, &notes, &reason, &a.RescheduleCount, &a.CreatedAt)
+	a.Notes = notes.String
+	a.CancelReason = reason.String
+	return a, err
+}
+
+const appointmentColumns = `id, request_id, technician_id, customer_id, address, starts_at, ends_at,
+	status, notes, cancel_reason, reschedule_count, created_at`
+
+func loadAppointment(database *sql.DB, id int) (models.Appointment, error) {
+	return scanAppointment(database.QueryRow(`SELECT `+appointmentColumns+` FROM appointments WHERE id = ?`, id).Scan)
+}
+
+func publishAppointmentEvent(database *sql.DB, eventType string, a models.Appointment) {
+	publishTicketEvent(database, eventType, a.RequestID, fiber.Map{
+		"appointment_id": a.ID,
+		"technician_id":  a.TechnicianID,
+		"starts_at":      a.StartsAt,
+		"ends_at":        a.EndsAt,
+		"status":         a.Status,
+	})
+}
+
+// parseVisitTimes reads starts_at and either ends_at or duration_minutes.
+func parseVisitTimes(startsAt, endsAt string, durationMinutes int) (time.Time, time.Time, error) {
+	start, err := time.Parse(time.RFC3339, startsAt)
+	if err != nil {
+		return start, start, fiber.NewError(fiber.StatusBadRequest, "starts_at must be an RFC3339 time")
+	}
+	if endsAt != "" {
+		end, err := time.Parse(time.RFC3339, endsAt)
+		if err != nil {
+			return start, end, fiber.NewError(fiber.StatusBadRequest, "ends_at must be an RFC3339 time")
+		}
+		return start, end, nil
+	}
+	duration := defaultVisitDuration
+	if durationMinutes > 0 {
+		duration = time.Duration(durationMinutes) * time.Minute
+	}
+	return start, start.Add(duration), nil
+}
+
+// CreateAppointment books an onsite visit for a support request. Customers can
+// book for their own tickets, admins for any ticket and any technician.
+func CreateAppointment(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	var input struct {
+		RequestID       int    `json:"request_id"`
+		TechnicianID    int    `json:"technician_id"` // admin only, defaults to the assigned tech
+		StartsAt        string `json:"starts_at"`
+		EndsAt          string `json:"ends_at"`
+		DurationMinutes int    `json:"duration_minutes"`
+		Address         string `json:"address"`
+		Notes           string `json:"notes"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+	}
+	if input.Address == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Address is required")
+	}
+	start, end, err := parseVisitTimes(input.StartsAt, input.EndsAt, input.DurationMinutes)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var ownerID int
+	var assignedTo *int
+	err = database.QueryRow(`SELECT user_id, assigned_to FROM support_requests WHERE id = ? AND tenant_id = ?`, input.RequestID, tenantID(c)).Scan(&ownerID, &assignedTo)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Request not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if user.Role != "admin" && !canManageTicket(database, user, input.RequestID) {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+
+	techID := 0
+	if assignedTo != nil {
+		techID = *assignedTo
+	}
+	if input.TechnicianID != 0 && user.Role == "admin" {
+		techID = input.TechnicianID
+	}
+	if techID == 0 {
+		return fiber.NewError(fiber.StatusConflict, "No technician assigned to this request yet")
+	}
+	if err := inTenant(database, c, "users", techID); err != nil {
+		return err
+	}
+
+	if user.Role != "admin" {
+		usage, err := loadPlanUsage(database, ownerID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+		}
+		if usage == nil {
+			return fiber.NewError(fiber.StatusPaymentRequired, "An active subscription is required for onsite visits")
+		}
+		if usage.OnsiteRemaining <= 0 {
+			return fiber.NewError(fiber.StatusConflict, "Onsite visit quota of your plan is used up")
+		}
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	if err := checkVisitWindow(database, tx, techID, start, end, 0); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO appointments (request_id, technician_id, customer_id, address, starts_at, ends_at, notes, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		input.RequestID, techID, ownerID, input.Address, start, end, input.Notes, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	id, _ := result.LastInsertId()
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+
+	a, err := loadAppointment(database, int(id))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	publishAppointmentEvent(database, events.AppointmentScheduled, a)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Appointment scheduled", "data": a})
+}
+
+// ListAppointments: admins see all (optionally ?technician_id=), techs their
+// own visits, customers their own bookings. ?from= and ?to= are RFC3339.
+func ListAppointments(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	query := `SELECT ` + appointmentColumns + ` FROM appointments
+		WHERE request_id IN (SELECT id FROM support_requests WHERE tenant_id = ?)`
+	args := []any{user.TenantID}
+	switch user.Role {
+	case "admin":
+		if techID := c.QueryInt("technician_id"); techID != 0 {
+			query += ` AND technician_id = ?`
+			args = append(args, techID)
+		}
+	case "tech":
+		query += ` AND technician_id = ?`
+		args = append(args, user.ID)
+	default:
+		query += ` AND customer_id = ?`
+		args = append(args, user.ID)
+	}
+	if from, err := time.Parse(time.RFC3339, c.Query("from")); err == nil {
+		query += ` AND ends_at >= ?`
+		args = append(args, from)
+	}
+	if to, err := time.Parse(time.RFC3339, c.Query("to")); err == nil {
+		query += ` AND starts_at <= ?`
+		args = append(args, to)
+	}
+	if status := c.Query("status"); status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY starts_at`
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	list := []models.Appointment{}
+	for rows.Next() {
+		a, err := scanAppointment(rows.Scan)
+		if err != nil {
+			continue
+		}
+		list = append(list, a)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": list})
+}
+
+// checkCustomerChange applies the rules customers have when moving or cancelling a visit.
+func checkCustomerChange(user models.User, a models.Appointment) error {
+	if a.Status != models.AppointmentScheduled {
+		return fiber.NewError(fiber.StatusConflict, "Only scheduled appointments can be changed")
+	}
+	if user.Role == "admin" || (user.Role == "tech" && user.ID == a.TechnicianID) {
+		return nil
+	}
+	if user.ID != a.CustomerID {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+	if time.Until(a.StartsAt) < changeCutoff() {
+		return fiber.NewError(fiber.StatusConflict,
+			fmt.Sprintf("Appointments can only be changed at least %d hours in advance", int(changeCutoff().Hours())))
+	}
+	return nil
+}
+
+// visitTechnician picks the technician of a moved visit: the current one, or
+// the one an admin asked for, who must belong to the tenant.
+func visitTechnician(database *sql.DB, c *fiber.Ctx, user models.User, a models.Appointment, requested int) (int, error) {
+	if requested == 0 || requested == a.TechnicianID || user.Role != "admin" {
+		return a.TechnicianID, nil
+	}
+	if err := inTenant(database, c, "users", requested); err != nil {
+		return 0, err
+	}
+	return requested, nil
+}
+
+func RescheduleAppointment(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid appointment ID")
+	}
+
+	var input struct {
+		StartsAt        string `json:"starts_at"`
+		EndsAt          string `json:"ends_at"`
+		DurationMinutes int    `json:"duration_minutes"`
+		TechnicianID    int    `json:"technician_id"` // admin only
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "appointments", id); err != nil {
+		return err
+	}
+
+	a, err := loadAppointment(database, id)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Appointment not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if err := checkCustomerChange(user, a); err != nil {
+		return err
+	}
+	// only the customer's own reschedules count toward their limit
+	byCustomer := user.ID == a.CustomerID && user.Role != "admin"
+	if byCustomer && a.RescheduleCount >= maxCustomerReschedules {
+		return fiber.NewError(fiber.StatusConflict, "This appointment cannot be rescheduled again, please contact support")
+	}
+
+	// keep the original length unless a new one is given
+	if input.EndsAt == "" && input.DurationMinutes == 0 {
+		input.DurationMinutes = int(a.EndsAt.Sub(a.StartsAt).Minutes())
+	}
+	start, end, err := parseVisitTimes(input.StartsAt, input.EndsAt, input.DurationMinutes)
+	if err != nil {
+		return err
+	}
+	techID, err := visitTechnician(database, c, user, a, input.TechnicianID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	if err := checkVisitWindow(database, tx, techID, start, end, a.ID); err != nil {
+		return err
+	}
+
+	counted := 0
+	if byCustomer {
+		counted = 1
+	}
+	_, err = tx.Exec(`
+		UPDATE appointments SET starts_at = ?, ends_at = ?, technician_id = ?, reschedule_count = reschedule_count + ?
+		WHERE id = ?`, start, end, techID, counted, a.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+
+	a, _ = loadAppointment(database, a.ID)
+	publishAppointmentEvent(database, events.AppointmentRescheduled, a)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Appointment rescheduled", "data": a})
+}
+
+func CancelAppointment(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid appointment ID")
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	c.BodyParser(&input)
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "appointments", id); err != nil {
+		return err
+	}
+
+	a, err := loadAppointment(database, id)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Appointment not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if err := checkCustomerChange(user, a); err != nil {
+		return err
+	}
+
+	if _, err := database.Exec(`UPDATE appointments SET status = 'cancelled', cancel_reason = ? WHERE id = ?`, input.Reason, a.ID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+
+	a.Status = models.AppointmentCancelled
+	a.CancelReason = input.Reason
+	publishAppointmentEvent(database, events.AppointmentCancelled, a)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Appointment cancelled"})
+}
+
+// CompleteAppointment is called by the technician (or an admin) after the visit.
+func CompleteAppointment(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid appointment ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "appointments", id); err != nil {
+		return err
+	}
+
+	a, err := loadAppointment(database, id)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Appointment not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if user.Role != "admin" && user.ID != a.TechnicianID {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+	if a.Status != models.AppointmentScheduled {
+		return fiber.NewError(fiber.StatusConflict, "Only scheduled appointments can be completed")
+	}
+
+	if _, err := database.Exec(`UPDATE appointments SET status = 'completed' WHERE id = ?`, a.ID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Appointment completed"})
+}
+
+// AppointmentSlots lists free start times for a day. The technician is the one
+// assigned to ?request_id=, or ?technician_id= for admins.
+// ?date=YYYY-MM-DD (business timezone), ?duration=minutes.
+func AppointmentSlots(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	loc := utils.BusinessLocation()
+	day, err := time.ParseInLocation("2006-01-02", c.Query("date"), loc)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "date must be YYYY-MM-DD")
+	}
+	duration := time.Duration(c.QueryInt("duration", int(defaultVisitDuration.Minutes()))) * time.Minute
+	if duration <= 0 {
+		duration = defaultVisitDuration
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	techID := 0
+	if requestID := c.QueryInt("request_id"); requestID != 0 {
+		var ownerID int
+		var assignedTo *int
+		err := database.QueryRow(`SELECT user_id, assigned_to FROM support_requests WHERE id = ? AND tenant_id = ?`, requestID, tenantID(c)).Scan(&ownerID, &assignedTo)
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusNotFound, "Request not found")
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+		}
+		if user.Role != "admin" && !canManageTicket(database, user, requestID) {
+			return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+		}
+		if assignedTo != nil {
+			techID = *assignedTo
+		}
+	}
+	if id := c.QueryInt("technician_id"); id != 0 && user.Role == "admin" {
+		techID = id
+	}
+	if techID == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "No technician to look up")
+	}
+	if err := inTenant(database, c, "users", techID); err != nil {
+		return err
+	}
+
+	tech, err := loadTechnicianProfile(database, techID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Technician not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+
+	slots := []fiber.Map{}
+	shiftStart, shiftEnd, ok := workingWindow(tech.WorkingHours, day)
+	if !ok || tech.Status != models.TechStatusActive {
+		return c.JSON(fiber.Map{"success": true, "data": slots})
+	}
+
+	type busy struct{ start, end time.Time }
+	var booked []busy
+	rows, err := database.Query(`
+		SELECT starts_at, ends_at FROM appointments
+		WHERE technician_id = ? AND status = 'scheduled' AND starts_at < ? AND ends_at > ?
+	`, techID, shiftEnd, shiftStart)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	for rows.Next() {
+		var b busy
+		if rows.Scan(&b.start, &b.end) == nil {
+			booked = append(booked, b)
+		}
+	}
+	rows.Close()
+
+	now := time.Now()
+	for start := shiftStart; !start.Add(duration).After(shiftEnd); start = start.Add(slotStep) {
+		end := start.Add(duration)
+		if start.Before(now) {
+			continue
+		}
+		free := true
+		for _, b := range booked {
+			if start.Before(b.end) && end.After(b.start) {
+				free = false
+				break
+			}
+		}
+		if free {
+			slots = append(slots, fiber.Map{"starts_at": start, "ends_at": end})
+		}
+	}
+
+	return c.JSON(fiber.Map{"success": true, "technician_id": techID, "data": slots})
+}
+
+// CreateCalendarToken issues (or replaces) the secret token of a technician's .ics feed.
+func CreateCalendarToken(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidUserID)
+	}
+	if user.Role != "admin" && user.ID != id {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Token generation failed")
+	}
+	token := hex.EncodeToString(buf)
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "users", id); err != nil {
+		return err
+	}
+
+	var isTech bool
+	database.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = ? AND role = 'tech')`, id).Scan(&isTech)
+	if !isTech {
+		return fiber.NewError(fiber.StatusNotFound, "Technician not found")
+	}
+
+	_, err = database.Exec(`
+		INSERT INTO technician_profiles (user_id, calendar_token) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE calendar_token = VALUES(calendar_token)`, id, token)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"token":   token,
+		"url":     c.BaseURL() + "/api/calendar/" + token + ".ics",
+	})
+}
+
+// TechnicianCalendar serves the iCalendar feed of a technician. It is public so
+// calendar apps can subscribe; the unguessable token is the credential.
+func TechnicianCalendar(c *fiber.Ctx) error {
+	token := c.Params("token")
+	if token == "" {
+		return fiber.NewError(fiber.StatusNotFound, "Calendar not found")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var techID int
+	var techName string
+	err = database.QueryRow(`
+		SELECT u.id, u.name FROM technician_profiles tp JOIN users u ON u.id = tp.user_id
+		WHERE tp.calendar_token = ?`, token).Scan(&techID, &techName)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Calendar not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+
+	// last month onwards is enough for calendar clients
+	rows, err := database.Query(`
+		SELECT a.id, a.request_id, a.address, a.starts_at, a.ends_at, a.status, a.updated_at, s.title, COALESCE(a.notes, '')
+		FROM appointments a JOIN support_requests s ON s.id = a.request_id
+		WHERE a.technician_id = ? AND a.starts_at >= NOW() - INTERVAL 30 DAY
+		ORDER BY a.starts_at`, techID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	var list []utils.CalendarEvent
+	for rows.Next() {
+		var id, requestID int
+		var address, status, title, notes string
+		var start, end, updated time.Time
+		if err := rows.Scan(&id, &requestID, &address, &start, &end, &status, &updated, &title, &notes); err != nil {
+			continue
+		}
+		list = append(list, utils.CalendarEvent{
+			UID:         utils.CalendarUID("appointment", id),
+			Summary:     fmt.Sprintf("#%d %s", requestID, title),
+			Description: notes,
+			Location:    address,
+			Start:       start,
+			End:         end,
+			Updated:     updated,
+			Cancelled:   status == models.AppointmentCancelled,
+		})
+	}
+
+	c.Set("Content-Type", "text/calendar; charset=utf-8")
+	c.Set("Content-Disposition", `inline; filename="visits.ics"`)
+	return c.SendString(utils.BuildICS(techName+" - ITHelp visits", list))
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestVisitTechnicianStaysInTenant(t *testing.T) {
+	database := ownerDB(t)
+	visit := models.Appointment{ID: 40, TechnicianID: 20}
+
+	tests := []struct {
+		name      string
+		role      string
+		requested int
+		wantTech  int
+		want      int
+	}{
+		{"keeps the technician", "admin", 0, 20, fiber.StatusOK},
+		{"admin moves to a technician of the tenant", "admin", 20, 20, fiber.StatusOK},
+		{"admin moves to another tenant's technician", "admin", 21, 0, fiber.StatusNotFound},
+		{"admin names an unknown user", "admin", 99, 0, fiber.StatusNotFound},
+		{"customer cannot pick a technician", "user", 21, 20, fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotTech int
+			app := fiber.New()
+			app.Put("/appointments/:id", func(c *fiber.Ctx) error {
+				c.Locals("tenant", models.Tenant{ID: 2})
+				user := models.User{ID: 5, Role: tt.role, TenantID: 2}
+				techID, err := visitTechnician(database, c, user, visit, tt.requested)
+				if err != nil {
+					return err
+				}
+				gotTech = techID
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			resp, err := app.Test(httptest.NewRequest("PUT", "/appointments/40", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if gotTech != tt.wantTech {
+				t.Errorf("technician = %d, want %d", gotTech, tt.wantTech)
+			}
+		})
+	}
+}
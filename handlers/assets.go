@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"ithelp/db"
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const assetColumns = `a.id, a.user_id, a.type, COALESCE(a.make, ''), COALESCE(a.model, ''), COALESCE(a.serial_number, ''),
+	COALESCE(a.os, ''), DATE_FORMAT(a.purchase_date, '%Y-%m-%d'), DATE_FORMAT(a.warranty_until, '%Y-%m-%d'),
+	COALESCE(a.notes, ''), (SELECT COUNT(*) FROM support_requests sr WHERE sr.asset_id = a.id), a.created_at`
+
+func scanAsset(row interface{ Scan(...any) error }) (models.Asset, error) {
+	var a models.Asset
+	err := row.Scan(&a.ID, &a.UserID, &a.Type, &a.Make, &a.Model, &a.SerialNumber, &a.OS,
+		&a.PurchaseDate, &a.WarrantyUntil, &a.Notes, &a.TicketCount, &a.CreatedAt)
+	return a, err
+}
+
+// servesCustomer reports whether a tech has (or had) a ticket of the customer.
+// Techs may manage the assets of those customers on their behalf.
+func servesCustomer(database *sql.DB, techID, customerID int) bool {
+	var ok bool
+	database.QueryRow(`SELECT EXISTS(SELECT 1 FROM support_requests WHERE user_id = ? AND assigned_to = ?)`, customerID, techID).Scan(&ok)
+	return ok
+}
+
+func canAccessAssetsOf(database *sql.DB, user models.User, ownerID int) bool {
+	switch user.Role {
+	case "admin":
+		return resourceInTenant(database, user.TenantID, "users", ownerID) == nil
+	case "tech":
+		return servesCustomer(database, user.ID, ownerID)
+	default:
+		return canManageCustomer(database, user, ownerID)
+	}
+}
+
+// loadAccessibleAsset returns the asset when the user may see it.
+func loadAccessibleAsset(database *sql.DB, user models.User, id int) (models.Asset, error) {
+	a, err := scanAsset(database.QueryRow(`SELECT `+assetColumns+` FROM assets a WHERE a.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return a, fiber.NewError(fiber.StatusNotFound, "Asset not found")
+	}
+	if err != nil {
+		return a, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if !canAccessAssetsOf(database, user, a.UserID) {
+		return a, fiber.NewError(fiber.StatusNotFound, "Asset not found")
+	}
+	return a, nil
+}
+
+type assetInput struct {
+	UserID        int    `json:"user_id"` // tech/admin registering on behalf of a customer
+	Type          string `json:"type"`
+	Make          string `json:"make"`
+	Model         string `json:"model"`
+	SerialNumber  string `json:"serial_number"`
+	OS            string `json:"os"`
+	PurchaseDate  string `json:"purchase_date"`
+	WarrantyUntil string `json:"warranty_until"`
+	Notes         string `json:"notes"`
+}
+
+// dates validates the optional YYYY-MM-DD fields and returns them as nullable values.
+func (in assetInput) dates() (purchase, warranty *string, err error) {
+	for _, d := range []struct {
+		value string
+		dst   **string
+	}{{in.PurchaseDate, &purchase}, {in.WarrantyUntil, &warranty}} {
+		if d.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d.value); err != nil {
+			return nil, nil, fiber.NewError(fiber.StatusBadRequest, "Dates must be in YYYY-MM-DD format")
+		}
+		v := d.value
+		*d.dst = &v
+	}
+	return purchase, warranty, nil
+}
+
+// ListAssets returns the caller's assets. Admins and techs pass ?user_id= to
+// see a customer's assets; admins may also search all assets with ?serial=.
+func ListAssets(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	query := `SELECT ` + assetColumns + ` FROM assets a WHERE a.user_id IN (SELECT id FROM users WHERE tenant_id = ?)`
+	args := []any{user.TenantID}
+	ownerID := user.ID
+	if user.Role != "user" {
+		ownerID = c.QueryInt("user_id")
+	}
+	if ownerID != 0 {
+		if !canAccessAssetsOf(database, user, ownerID) {
+			return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+		}
+		query += ` AND a.user_id = ?`
+		args = append(args, ownerID)
+	} else if user.Role != "admin" {
+		return fiber.NewError(fiber.StatusBadRequest, "user_id is required")
+	}
+	if serial := c.Query("serial"); serial != "" {
+		query += ` AND a.serial_number = ?`
+		args = append(args, serial)
+	}
+	if t := c.Query("type"); t != "" {
+		query += ` AND a.type = ?`
+		args = append(args, t)
+	}
+	query += ` ORDER BY a.type, a.id`
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	assets := []models.Asset{}
+	for rows.Next() {
+		a, err := scanAsset(rows)
+		if err != nil {
+			continue
+		}
+		assets = append(assets, a)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": assets})
+}
+
+func GetAsset(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid asset ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	a, err := loadAccessibleAsset(database, user, id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": a})
+}
+
+func CreateAsset(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	var input assetInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	input.Type = strings.ToLower(strings.TrimSpace(input.Type))
+	if input.Type == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Asset type is required")
+	}
+	purchase, warranty, err := input.dates()
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	ownerID := user.ID
+	if user.Role != "user" {
+		if input.UserID == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "user_id of the customer is required")
+		}
+		ownerID = input.UserID
+		if !canAccessAssetsOf(database, user, ownerID) {
+			return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+		}
+	}
+
+	result, err := database.Exec(`
+		INSERT INTO assets (user_id, type, make, model, serial_number, os, purchase_date, warranty_until, notes, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		ownerID, input.Type, input.Make, input.Model, input.SerialNumber, input.OS, purchase, warranty, input.Notes, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert error")
+	}
+	id, _ := result.LastInsertId()
+
+	return c.JSON(fiber.Map{"success": true, "message": "Asset registered", "id": id})
+}
+
+func UpdateAsset(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid asset ID")
+	}
+
+	var input assetInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	input.Type = strings.ToLower(strings.TrimSpace(input.Type))
+	if input.Type == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Asset type is required")
+	}
+	purchase, warranty, err := input.dates()
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if _, err := loadAccessibleAsset(database, user, id); err != nil {
+		return err
+	}
+
+	_, err = database.Exec(`
+		UPDATE assets SET type = ?, make = ?, model = ?, serial_number = ?, os = ?, purchase_date = ?, warranty_until = ?, notes = ?
+		WHERE id = ?`,
+		input.Type, input.Make, input.Model, input.SerialNumber, input.OS, purchase, warranty, input.Notes, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Asset updated"})
+}
+
+// DeleteAsset is for the owner and admins. Linked tickets keep their history
+// but lose the reference.
+func DeleteAsset(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid asset ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	a, err := loadAccessibleAsset(database, user, id)
+	if err != nil {
+		return err
+	}
+	if user.Role == "tech" {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+
+	if _, err := database.Exec(`DELETE FROM assets WHERE id = ?`, a.ID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Asset deleted"})
+}
+
+// AssetHistory returns every ticket raised for the asset, newest first,
+// together with the parts used on them.
+func AssetHistory(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid asset ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	a, err := loadAccessibleAsset(database, user, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := database.Query(`
+		SELECT id, user_id, title, description, category, status, assigned_to, COALESCE(region, ''), asset_id, created_at, updated_at
+		FROM support_requests WHERE asset_id = ? ORDER BY created_at DESC`, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	type historyEntry struct {
+		models.SupportRequest
+		Parts []models.RequestPart `json:"parts"`
+	}
+	history := []historyEntry{}
+	for rows.Next() {
+		var h historyEntry
+		r := &h.SupportRequest
+		if err := rows.Scan(&r.ID, &r.UserID, &r.Title, &r.Description, &r.Category, &r.Status, &r.AssignedTo, &r.Region, &r.AssetID, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			continue
+		}
+		h.Parts = []models.RequestPart{}
+		history = append(history, h)
+	}
+	rows.Close()
+
+	for i := range history {
+		partRows, err := database.Query(`
+			SELECT rp.id, rp.request_id, rp.part_id, p.name, rp.location_id, rp.quantity, rp.unit_price, rp.billable, rp.created_at
+			FROM request_parts rp JOIN parts p ON p.id = rp.part_id
+			WHERE rp.request_id = ? ORDER BY rp.id`, history[i].ID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+		}
+		for partRows.Next() {
+			var p models.RequestPart
+			if partRows.Scan(&p.ID, &p.RequestID, &p.PartID, &p.PartName, &p.LocationID, &p.Quantity, &p.UnitPrice, &p.Billable, &p.CreatedAt) == nil {
+				history[i].Parts = append(history[i].Parts, p)
+			}
+		}
+		partRows.Close()
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": fiber.Map{"asset": a, "requests": history}})
+}
+
+// checkAssetOwner makes sure a ticket is only linked to an asset of its owner.
+func checkAssetOwner(database *sql.DB, assetID, ownerID int) error {
+	var assetOwner int
+	err := database.QueryRow(`SELECT user_id FROM assets WHERE id = ?`, assetID).Scan(&assetOwner)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusBadRequest, "Asset not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if assetOwner != ownerID {
+		return fiber.NewError(fiber.StatusBadRequest, "Asset does not belong to the request owner")
+	}
+	return nil
+}
+
+// LinkRequestAsset sets or clears (asset_id null) the asset of a ticket.
+// Allowed for the ticket owner, the assigned tech and admins.
+func LinkRequestAsset(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	requestID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request ID")
+	}
+
+	var input struct {
+		AssetID *int `json:"asset_id"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var ownerID int
+	var assignedTo *int
+	err = database.QueryRow(`SELECT user_id, assigned_to FROM support_requests WHERE id = ? AND tenant_id = ?`, requestID, tenantID(c)).Scan(&ownerID, &assignedTo)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Request not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if user.Role != "admin" && !canManageTicket(database, user, requestID) && (assignedTo == nil || *assignedTo != user.ID) {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+
+	if input.AssetID != nil {
+		if err := checkAssetOwner(database, *input.AssetID, ownerID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := database.Exec(`UPDATE support_requests SET asset_id = ? WHERE id = ?`, input.AssetID, requestID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Asset linked"})
+}
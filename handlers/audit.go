@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"ithelp/audit"
+	"ithelp/db"
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// userSnapshot is the audited state of a user, without the password hash;
+// nil when the user does not exist.
+func userSnapshot(database *sql.DB, tenant, id int) any {
+	var name, phone, role string
+	var email, plan sql.NullString
+	err := database.QueryRow(`SELECT name, phone, email, role, subscription_plan FROM users WHERE id = ? AND tenant_id = ?`,
+		id, tenant).Scan(&name, &phone, &email, &role, &plan)
+	if err != nil {
+		return nil
+	}
+	return fiber.Map{
+		"id": id, "name": name, "phone": phone, "email": nullIfEmpty(email.String), "role": role,
+		"subscription_plan": nullIfEmpty(plan.String),
+	}
+}
+
+// planSnapshot is the audited state of a plan, nil when it does not exist.
+func planSnapshot(database *sql.DB, tenant, id int) any {
+	var p models.Plan
+	err := database.QueryRow(`SELECT id, name, price, remote_calls, onsite_calls FROM plans WHERE id = ? AND tenant_id = ?`,
+		id, tenant).Scan(&p.ID, &p.Name, &p.Price, &p.RemoteCalls, &p.OnsiteCalls)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+func rawJSON(s sql.NullString) json.RawMessage {
+	if !s.Valid {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s.String)
+}
+
+// ListAuditLog returns audit log entries, newest first. Filters: ?actor_id=,
+// ?action= (a trailing * matches a prefix, e.g. auth.*), ?entity=,
+// ?entity_id=, ?from= and ?to= (YYYY-MM-DD), ?q= (text in the snapshots).
+// Pages with ?before_id= (the last id of the previous page) and ?limit=
+// (default 50, at most 200).
+func ListAuditLog(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		SELECT a.id, a.actor_id, u.name, a.actor_role, a.action, a.entity, a.entity_id, a.before_data, a.after_data, a.ip,
+			a.user_agent, a.created_at, a.prev_hash, a.hash
+		FROM audit_log a LEFT JOIN users u ON u.id = a.actor_id
+		WHERE a.tenant_id = ?`
+	args := []any{admin.TenantID}
+	if id := c.QueryInt("actor_id"); id != 0 {
+		query += ` AND a.actor_id = ?`
+		args = append(args, id)
+	}
+	if action := c.Query("action"); action != "" {
+		if prefix, ok := strings.CutSuffix(action, "*"); ok {
+			query += ` AND a.action LIKE ?`
+			args = append(args, prefix+"%")
+		} else {
+			query += ` AND a.action = ?`
+			args = append(args, action)
+		}
+	}
+	if entity := c.Query("entity"); entity != "" {
+		query += ` AND a.entity = ?`
+		args = append(args, entity)
+	}
+	if id := c.Query("entity_id"); id != "" {
+		query += ` AND a.entity_id = ?`
+		args = append(args, id)
+	}
+	if c.Query("from") != "" || c.Query("to") != "" {
+		from, to, err := parseRange(c.Query("from"), c.Query("to"))
+		if err != nil {
+			return err
+		}
+		query += ` AND a.created_at >= ? AND a.created_at < ?`
+		args = append(args, from.UTC(), to.UTC())
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		query += ` AND (a.before_data LIKE ? OR a.after_data LIKE ?)`
+		args = append(args, "%"+q+"%", "%"+q+"%")
+	}
+	if id := c.QueryInt("before_id"); id != 0 {
+		query += ` AND a.id < ?`
+		args = append(args, id)
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 200 {
+		limit = 200
+	}
+	query += ` ORDER BY a.id DESC LIMIT ?`
+	args = append(args, limit)
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	list := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.ActorName, &e.ActorRole, &e.Action, &e.Entity, &e.EntityID, &before, &after,
+			&e.IP, &e.UserAgent, &e.CreatedAt, &e.PrevHash, &e.Hash); err != nil {
+			continue
+		}
+		e.Before, e.After = rawJSON(before), rawJSON(after)
+		list = append(list, e)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": list})
+}
+
+// VerifyAuditLog recomputes the hash chain of the tenant's audit log and
+// reports the first entry that was changed, removed or reordered.
+func VerifyAuditLog(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	result, err := audit.Verify(database, admin.TenantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": result})
+}
@@ -3,7 +3,9 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"ithelp/audit"
 	"ithelp/db"
+	"ithelp/events"
 	"ithelp/models"
 	"ithelp/utils"
 	"log"
@@ -46,11 +48,12 @@ func Register(c *fiber.Ctx) error {
 	}
 	defer database.Close()
 	log.Println("Database connection established")
+	tenant := tenantID(c)
 
 	// Check if phone already exists
 	log.Printf("Checking if phone %s already exists", input.Phone)
 	var exists bool
-	err = database.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE phone = ?)", input.Phone).Scan(&exists)
+	err = database.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE phone = ? AND tenant_id = ?)", input.Phone, tenant).Scan(&exists)
 	if err != nil {
 		log.Printf("Database error when checking phone: %v", err)
 		return fiber.NewError(fiber.StatusInternalServerError, "Database error")
@@ -64,7 +67,7 @@ func Register(c *fiber.Ctx) error {
 	// Check if email exists (if provided)
 	if input.Email != "" {
 		log.Printf("Checking if email %s already exists", input.Email)
-		err = database.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ?)", input.Email).Scan(&exists)
+		err = database.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ? AND tenant_id = ?)", input.Email, tenant).Scan(&exists)
 		if err != nil {
 			log.Printf("Database error when checking email: %v", err)
 			return fiber.NewError(fiber.StatusInternalServerError, "Database error")
@@ -93,12 +96,12 @@ func Register(c *fiber.Ctx) error {
 	// Handle empty email by using NULL in database
 	if input.Email == "" {
 		log.Println("Empty email, inserting NULL for email field")
-		query = `INSERT INTO users (name, phone, email, password_hash, role) VALUES (?, ?, NULL, ?, ?)`
-		result, err = database.Exec(query, input.Name, input.Phone, string(hashedPassword), "user")
+		query = `INSERT INTO users (name, phone, email, password_hash, role, tenant_id) VALUES (?, ?, NULL, ?, ?, ?)`
+		result, err = database.Exec(query, input.Name, input.Phone, string(hashedPassword), "user", tenant)
 	} else {
 		log.Println("Inserting user with email")
-		query = `INSERT INTO users (name, phone, email, password_hash, role) VALUES (?, ?, ?, ?, ?)`
-		result, err = database.Exec(query, input.Name, input.Phone, input.Email, string(hashedPassword), "user")
+		query = `INSERT INTO users (name, phone, email, password_hash, role, tenant_id) VALUES (?, ?, ?, ?, ?, ?)`
+		result, err = database.Exec(query, input.Name, input.Phone, input.Email, string(hashedPassword), "user", tenant)
 	}
 	if err != nil {
 		log.Printf("Failed to create user: %v", err)
@@ -108,6 +111,20 @@ func Register(c *fiber.Ctx) error {
 	rowsAffected, _ := result.RowsAffected()
 	log.Printf("User %s with phone %s registered successfully. Rows affected: %d", input.Name, input.Phone, rowsAffected)
 
+	userID, _ := result.LastInsertId()
+	PublishEvent(database, events.Event{
+		TenantID: tenant,
+		Type:     events.UserRegistered,
+		UserID:   int(userID),
+		Data:     fiber.Map{"id": userID, "name": input.Name, "phone": input.Phone, "email": input.Email},
+	})
+
+	entry := audit.FromRequest(c, "auth.register", "users", userID)
+	actorID := int(userID)
+	entry.ActorID, entry.ActorRole = &actorID, "user"
+	entry.After = userSnapshot(database, tenant, actorID)
+	audit.Log(c, database, entry)
+
 	log.Println("Register handler completed successfully")
 	return c.JSON(fiber.Map{
 		"success": true,
@@ -148,11 +165,14 @@ func Login(c *fiber.Ctx) error {
 
     log.Printf("Querying user data for phone: %s", input.Phone)
     var user models.User
-    query := `SELECT id, name, email, password_hash, role FROM users WHERE phone = ?`
-    err = database.QueryRow(query, input.Phone).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.Role)
+    query := `SELECT id, name, email, password_hash, role, tenant_id FROM users WHERE phone = ? AND tenant_id = ?`
+    err = database.QueryRow(query, input.Phone, tenantID(c)).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.Role, &user.TenantID)
     if err != nil {
         if err == sql.ErrNoRows {
             log.Printf("No user found with phone: %s", input.Phone)
+            entry := audit.FromRequest(c, "auth.login_failed", "users", nil)
+            entry.After = fiber.Map{"phone": input.Phone, "reason": "unknown phone"}
+            audit.Log(c, database, entry)
             return fiber.NewError(fiber.StatusUnauthorized, "Invalid phone or password")
         }
         log.Printf("Database error during user query: %v", err)
@@ -163,18 +183,25 @@ func Login(c *fiber.Ctx) error {
     log.Println("Verifying password")
     if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password)); err != nil {
         log.Printf("Password verification failed for user ID: %d", user.ID)
+        entry := audit.FromRequest(c, "auth.login_failed", "users", user.ID)
+        entry.After = fiber.Map{"phone": input.Phone, "reason": "wrong password"}
+        audit.Log(c, database, entry)
         return fiber.NewError(fiber.StatusUnauthorized, "Invalid phone or password")
     }
     log.Println("Password verified successfully")
 
     log.Println("Generating JWT token")
-    token, err := utils.GenerateJWT(user.ID, user.Role)
+    token, err := utils.GenerateJWT(user.ID, user.Role, user.TenantID)
     if err != nil {
         log.Printf("Token generation failed: %v", err)
         return fiber.NewError(fiber.StatusInternalServerError, "Token generation failed")
     }
     log.Printf("JWT token generated successfully for user ID: %d", user.ID)
 
+    entry := audit.FromRequest(c, "auth.login", "users", user.ID)
+    entry.TenantID, entry.ActorID, entry.ActorRole = user.TenantID, &user.ID, user.Role
+    audit.Log(c, database, entry)
+
     elapsed := time.Since(startTime)
     log.Printf("Login handler completed successfully in %v", elapsed)
 	return c.JSON(fiber.Map{
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"ithelp/db"
+	"ithelp/events"
+	"ithelp/models"
+	"ithelp/notifications"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// bulkLimit caps how many requests one bulk call may change.
+const bulkLimit = 500
+
+type bulkInput struct {
+	IDs    []int         `json:"ids"`
+	Filter *ticketFilter `json:"filter"` // instead of ids
+
+	Status     string   `json:"status"`
+	Close      bool     `json:"close"` // same as status closed
+	AssignedTo *int     `json:"assigned_to"`
+	Priority   string   `json:"priority"`
+	AddTags    []string `json:"add_tags"`
+
+	// Atomic rolls everything back when any request fails. By default the
+	// failing requests are skipped and reported.
+	Atomic bool `json:"atomic"`
+}
+
+type bulkResult struct {
+	ID      int    `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// bulkTargets resolves the ids or the filter to request ids of the tenant.
+func bulkTargets(database *sql.DB, tenant int, input bulkInput) ([]int, error) {
+	if input.Filter == nil {
+		if len(input.IDs) == 0 {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "ids or filter is required")
+		}
+		if len(input.IDs) > bulkLimit {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("At most %d requests can be changed at once", bulkLimit))
+		}
+		return input.IDs, nil
+	}
+
+	where, args, err := input.Filter.where(database, tenant)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := database.Query(`SELECT id FROM support_requests WHERE `+where+` ORDER BY id LIMIT ?`, append(args, bulkLimit+1)...)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > bulkLimit {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Filter matches more than %d requests", bulkLimit))
+	}
+	return ids, nil
+}
+
+// errorText is the message of a fiber error, or a generic one.
+func errorText(err error) string {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fe.Message
+	}
+	return "Update failed"
+}
+
+// BulkUpdateSupportRequests changes status, technician, priority and tags of
+// many requests in one transaction. Each request gets its own result and
+// history entries; notifications are batched so a technician receiving 40
+// tickets gets one message.
+func BulkUpdateSupportRequests(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	var input bulkInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	if input.Close {
+		if input.Status != "" && input.Status != models.StatusClosed {
+			return fiber.NewError(fiber.StatusBadRequest, "close cannot be combined with another status")
+		}
+		input.Status = models.StatusClosed
+	}
+	if input.Priority != "" && !validPriority(input.Priority) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid priority")
+	}
+	tags, err := normalizeTags(input.AddTags)
+	if err != nil {
+		return err
+	}
+	if input.Status == "" && input.AssignedTo == nil && input.Priority == "" && len(tags) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Nothing to change")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	ids, err := bulkTargets(database, admin.TenantID, input)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	type change struct {
+		id        int
+		oldStatus string
+		assigned  bool
+	}
+	var changes []change
+	results := make([]bulkResult, 0, len(ids))
+	failed := 0
+	for _, id := range ids {
+		var status, priority string
+		var assignedTo, mergedInto *int
+		err := tx.QueryRow(`SELECT status, priority, assigned_to, merged_into FROM support_requests WHERE id = ? AND tenant_id = ? FOR UPDATE`,
+			id, admin.TenantID).Scan(&status, &priority, &assignedTo, &mergedInto)
+		if err == sql.ErrNoRows || mergedInto != nil {
+			msg := "Request not found"
+			if mergedInto != nil {
+				msg = fmt.Sprintf("Request was merged into #%d", *mergedInto)
+			}
+			results = append(results, bulkResult{ID: id, Error: msg})
+			failed++
+			continue
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+		}
+
+		ch := change{id: id, oldStatus: status}
+		var sets []string
+		var args []any
+		if input.Status != "" && input.Status != status {
+			sets, args = append(sets, "status = ?"), append(args, input.Status)
+		}
+		if input.Priority != "" && input.Priority != priority {
+			sets, args = append(sets, "priority = ?"), append(args, input.Priority)
+		}
+		if input.AssignedTo != nil && (assignedTo == nil || *assignedTo != *input.AssignedTo) {
+			if err := checkTechnicianAssignable(database, *input.AssignedTo, id); err != nil {
+				results = append(results, bulkResult{ID: id, Error: errorText(err)})
+				failed++
+				continue
+			}
+			sets, args = append(sets, "assigned_to = ?"), append(args, *input.AssignedTo)
+			ch.assigned = true
+		}
+
+		if len(sets) > 0 {
+			if _, err := tx.Exec(`UPDATE support_requests SET `+strings.Join(sets, ", ")+` WHERE id = ?`, append(args, id)...); err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+			}
+		}
+		if err := addTags(tx, id, tags); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+		}
+
+		if input.Status != "" && input.Status != status {
+			recordStatusChange(tx, id, admin.ID, status, input.Status)
+		}
+		if ch.assigned {
+			recordHistory(tx, id, admin.ID, "assigned", nil, nil, fmt.Sprintf("technician #%d", *input.AssignedTo))
+		}
+		if input.Priority != "" && input.Priority != priority {
+			recordHistory(tx, id, admin.ID, "priority", nil, nil, priority+" -> "+input.Priority)
+		}
+		if len(tags) > 0 {
+			recordHistory(tx, id, admin.ID, "tagged", nil, nil, strings.Join(tags, ", "))
+		}
+
+		changes = append(changes, ch)
+		results = append(results, bulkResult{ID: id, Success: true})
+	}
+
+	if input.Atomic && failed > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"success": false,
+			"message": fmt.Sprintf("%d of %d requests failed, nothing was changed", failed, len(ids)),
+			"results": results,
+		})
+	}
+	var pending []pendingEvent
+	for _, ch := range changes {
+		pending = append(pending, pendingEvent{events.TicketUpdated, ch.id,
+			fiber.Map{"status": input.Status, "priority": input.Priority, "tags": tags, "bulk": true}})
+		if input.Status != "" && input.Status != ch.oldStatus {
+			pending = append(pending, pendingEvent{events.TicketStatusChanged, ch.id,
+				fiber.Map{"old_status": ch.oldStatus, "status": input.Status, "bulk": true}})
+		}
+		if ch.assigned {
+			pending = append(pending, pendingEvent{events.TicketAssigned, ch.id,
+				fiber.Map{"assigned_to": *input.AssignedTo, "bulk": true}})
+		}
+	}
+	recorded, err := recordTicketEvents(tx, pending)
+	if err == nil {
+		batch := notifications.NewBatch(admin.TenantID)
+		for _, e := range recorded {
+			batch.Add(e)
+		}
+		err = batch.Record(tx)
+	}
+	if err != nil {
+		log.Printf("bulk: recording events failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+	for _, e := range recorded {
+		events.Publish(e)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": fmt.Sprintf("%d of %d requests updated", len(changes), len(ids)),
+		"results": results,
+	})
+}
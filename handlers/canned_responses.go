@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"ithelp/db"
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// renderPlaceholders fills the placeholders of a canned response or macro
+// text for a ticket:
+//
+//	{{customer_name}} {{ticket_id}} {{ticket_title}} {{technician_name}}
+//	{{plan}} {{remote_calls_remaining}} {{onsite_calls_remaining}}
+//
+// Plan placeholders use the quota of the ticket owner, or their organization.
+func renderPlaceholders(database *sql.DB, requestID int, text string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	var ownerID int
+	var title, customer string
+	var technician sql.NullString
+	err := database.QueryRow(`
+		SELECT s.user_id, s.title, u.name, t.name
+		FROM support_requests s
+		JOIN users u ON u.id = s.user_id
+		LEFT JOIN users t ON t.id = s.assigned_to
+		WHERE s.id = ?`, requestID).Scan(&ownerID, &title, &customer, &technician)
+	if err != nil {
+		return "", err
+	}
+
+	plan, remote, onsite := "-", "0", "0"
+	if strings.Contains(text, "{{plan}}") || strings.Contains(text, "_calls_remaining}}") {
+		usage, err := loadPlanUsage(database, ownerID)
+		if err != nil {
+			return "", err
+		}
+		if usage != nil {
+			plan, remote, onsite = usage.Plan, strconv.Itoa(usage.RemoteRemaining), strconv.Itoa(usage.OnsiteRemaining)
+		}
+	}
+
+	return strings.NewReplacer(
+		"{{customer_name}}", customer,
+		"{{ticket_id}}", strconv.Itoa(requestID),
+		"{{ticket_title}}", title,
+		"{{technician_name}}", technician.String,
+		"{{plan}}", plan,
+		"{{remote_calls_remaining}}", remote,
+		"{{onsite_calls_remaining}}", onsite,
+	).Replace(text), nil
+}
+
+// checkTemplateAccess loads the owner of a canned response or macro. Shared
+// ones (no owner) are readable by all staff and writable by admins, personal
+// ones only exist for their owner.
+func checkTemplateAccess(database *sql.DB, user models.User, table string, id int, write bool) error {
+	var ownerID *int
+	err := database.QueryRow(`SELECT owner_id FROM `+table+` WHERE id = ? AND tenant_id = ?`, id, user.TenantID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != nil && *ownerID != user.ID) {
+		return fiber.NewError(fiber.StatusNotFound, "Not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if write && ownerID == nil && user.Role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admins can change shared templates")
+	}
+	return nil
+}
+
+// templateOwner is the owner_id to store: nil for shared, which needs an admin.
+func templateOwner(user models.User, shared bool) (*int, error) {
+	if !shared {
+		return &user.ID, nil
+	}
+	if user.Role != "admin" {
+		return nil, fiber.NewError(fiber.StatusForbidden, "Only admins can create shared templates")
+	}
+	return nil, nil
+}
+
+type cannedResponseInput struct {
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	Shared bool   `json:"shared"`
+}
+
+func (in *cannedResponseInput) validate() error {
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Title == "" || strings.TrimSpace(in.Body) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "title and body are required")
+	}
+	return nil
+}
+
+// ListCannedResponses returns the shared responses and the caller's own.
+func ListCannedResponses(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`
+		SELECT id, owner_id, title, body, created_at, updated_at FROM canned_responses
+		WHERE tenant_id = ? AND (owner_id IS NULL OR owner_id = ?)
+		ORDER BY owner_id IS NOT NULL, title`, user.TenantID, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	list := []models.CannedResponse{}
+	for rows.Next() {
+		var r models.CannedResponse
+		if err := rows.Scan(&r.ID, &r.OwnerID, &r.Title, &r.Body, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			continue
+		}
+		r.Shared = r.OwnerID == nil
+		list = append(list, r)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": list})
+}
+
+func CreateCannedResponse(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+
+	var input cannedResponseInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	if err := input.validate(); err != nil {
+		return err
+	}
+	owner, err := templateOwner(user, input.Shared)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	result, err := database.Exec(`INSERT INTO canned_responses (tenant_id, owner_id, title, body) VALUES (?, ?, ?, ?)`,
+		user.TenantID, owner, input.Title, input.Body)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	id, _ := result.LastInsertId()
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "message": "Canned response created", "id": id})
+}
+
+// UpdateCannedResponse changes title and body. Shared stays as it was.
+func UpdateCannedResponse(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid ID")
+	}
+
+	var input cannedResponseInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	if err := input.validate(); err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := checkTemplateAccess(database, user, "canned_responses", id, true); err != nil {
+		return err
+	}
+	if _, err := database.Exec(`UPDATE canned_responses SET title = ?, body = ? WHERE id = ?`, input.Title, input.Body, id); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Canned response updated"})
+}
+
+func DeleteCannedResponse(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := checkTemplateAccess(database, user, "canned_responses", id, true); err != nil {
+		return err
+	}
+	if _, err := database.Exec(`DELETE FROM canned_responses WHERE id = ?`, id); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Canned response deleted"})
+}
+
+// RenderCannedResponse returns the response body with the placeholders
+// filled for ?request_id=, ready to be sent as a reply.
+func RenderCannedResponse(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid ID")
+	}
+	requestID := c.QueryInt("request_id")
+	if requestID == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "request_id is required")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := checkTemplateAccess(database, user, "canned_responses", id, false); err != nil {
+		return err
+	}
+	if _, _, err := ticketAccess(database, c, user, requestID); err != nil {
+		return err
+	}
+
+	var body string
+	database.QueryRow(`SELECT body FROM canned_responses WHERE id = ?`, id).Scan(&body)
+	rendered, err := renderPlaceholders(database, requestID, body)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": fiber.Map{"body": rendered}})
+}
@@ -0,0 +1,710 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ithelp/db"
+	"ithelp/models"
+	"ithelp/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var fieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+func validPriority(p string) bool {
+	switch p {
+	case models.PriorityLow, models.PriorityNormal, models.PriorityHigh, models.PriorityUrgent:
+		return true
+	}
+	return false
+}
+
+// categoryTree holds all categories of a tenant, indexed by id.
+type categoryTree struct {
+	byID  map[int]*models.Category
+	roots []*models.Category
+}
+
+// loadCategoryTree reads the categories and their fields in two queries and
+// links them into a tree ordered by sort_order and name.
+func loadCategoryTree(database *sql.DB, tenant int) (*categoryTree, error) {
+	rows, err := database.Query(`
+		SELECT id, parent_id, name, default_priority, sla_hours, sort_order, active
+		FROM ticket_categories WHERE tenant_id = ? ORDER BY sort_order, name`, tenant)
+	if err != nil {
+		return nil, err
+	}
+	t := &categoryTree{byID: map[int]*models.Category{}}
+	var ordered []*models.Category
+	for rows.Next() {
+		cat := &models.Category{Fields: []models.CategoryField{}}
+		if err := rows.Scan(&cat.ID, &cat.ParentID, &cat.Name, &cat.DefaultPriority, &cat.SLAHours, &cat.SortOrder, &cat.Active); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		t.byID[cat.ID] = cat
+		ordered = append(ordered, cat)
+	}
+	rows.Close()
+
+	for _, cat := range ordered {
+		if cat.ParentID == nil {
+			t.roots = append(t.roots, cat)
+		} else if parent, ok := t.byID[*cat.ParentID]; ok {
+			parent.Children = append(parent.Children, cat)
+		}
+	}
+
+	rows, err = database.Query(`
+		SELECT f.id, f.category_id, f.field_key, f.label, f.type, f.required, f.options, f.sort_order
+		FROM category_fields f JOIN ticket_categories c ON c.id = f.category_id
+		WHERE c.tenant_id = ? ORDER BY f.sort_order, f.id`, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		f, err := scanCategoryField(rows)
+		if err != nil {
+			return nil, err
+		}
+		if cat, ok := t.byID[f.CategoryID]; ok {
+			cat.Fields = append(cat.Fields, f)
+		}
+	}
+	return t, nil
+}
+
+func scanCategoryField(row interface{ Scan(...any) error }) (models.CategoryField, error) {
+	var f models.CategoryField
+	var options sql.NullString
+	err := row.Scan(&f.ID, &f.CategoryID, &f.Key, &f.Label, &f.Type, &f.Required, &options, &f.SortOrder)
+	if err == nil && options.Valid {
+		json.Unmarshal([]byte(options.String), &f.Options)
+	}
+	return f, err
+}
+
+// chain returns the category and its ancestors, the category first.
+func (t *categoryTree) chain(id int) []*models.Category {
+	var out []*models.Category
+	for cat, ok := t.byID[id]; ok && len(out) <= len(t.byID); {
+		out = append(out, cat)
+		if cat.ParentID == nil {
+			break
+		}
+		cat, ok = t.byID[*cat.ParentID]
+	}
+	return out
+}
+
+// descendants returns the ids of the category and everything below it.
+func (t *categoryTree) descendants(id int) []int {
+	cat, ok := t.byID[id]
+	if !ok {
+		return nil
+	}
+	ids := []int{id}
+	for _, child := range cat.Children {
+		ids = append(ids, t.descendants(child.ID)...)
+	}
+	return ids
+}
+
+// path is the display name stored in support_requests.category, e.g.
+// "Network / Wi-Fi".
+func (t *categoryTree) path(id int) string {
+	chain := t.chain(id)
+	names := make([]string, len(chain))
+	for i, cat := range chain {
+		names[len(chain)-1-i] = cat.Name
+	}
+	return strings.Join(names, " / ")
+}
+
+// settings resolves the fields (own and inherited), priority and SLA of a
+// category. The nearest category defining priority or SLA wins.
+func (t *categoryTree) settings(id int) (fields []models.CategoryField, priority string, slaHours *int) {
+	priority = models.PriorityNormal
+	priorityFound := false
+	for _, cat := range t.chain(id) {
+		fields = append(fields, cat.Fields...)
+		if !priorityFound && cat.DefaultPriority != nil {
+			priority, priorityFound = *cat.DefaultPriority, true
+		}
+		if slaHours == nil && cat.SLAHours != nil {
+			slaHours = cat.SLAHours
+		}
+	}
+	return fields, priority, slaHours
+}
+
+// ticketCategory is what CreateSupportRequest stores for a managed category.
+type ticketCategory struct {
+	Path         string
+	Priority     string
+	DueAt        *time.Time
+	CustomFields []byte // JSON
+}
+
+// resolveTicketCategory validates the custom field values sent with a new
+// ticket against the category's definitions.
+func resolveTicketCategory(database *sql.DB, requester models.User, categoryID int, values map[string]any) (*ticketCategory, error) {
+	tree, err := loadCategoryTree(database, requester.TenantID)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	cat, ok := tree.byID[categoryID]
+	if !ok || !cat.Active {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Unknown category")
+	}
+	if len(activeOnly(cat.Children)) > 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Pick a subcategory of "+cat.Name)
+	}
+
+	fields, priority, slaHours := tree.settings(categoryID)
+	clean := map[string]any{}
+	known := map[string]bool{}
+	for _, f := range fields {
+		known[f.Key] = true
+		v, present := values[f.Key]
+		if s, isString := v.(string); !present || v == nil || (isString && strings.TrimSpace(s) == "") {
+			if f.Required {
+				return nil, fiber.NewError(fiber.StatusBadRequest, f.Label+" is required")
+			}
+			continue
+		}
+		value, err := validateFieldValue(database, requester, f, v)
+		if err != nil {
+			return nil, err
+		}
+		clean[f.Key] = value
+	}
+	for key := range values {
+		if !known[key] {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Unknown field: "+key)
+		}
+	}
+
+	tc := &ticketCategory{Path: tree.path(categoryID), Priority: priority}
+	if slaHours != nil {
+		due := time.Now().Add(time.Duration(*slaHours) * time.Hour)
+		tc.DueAt = &due
+	}
+	if len(clean) > 0 {
+		tc.CustomFields, _ = json.Marshal(clean)
+	}
+	return tc, nil
+}
+
+func validateFieldValue(database *sql.DB, requester models.User, f models.CategoryField, v any) (any, error) {
+	invalid := fiber.NewError(fiber.StatusBadRequest, "Invalid value for "+f.Label)
+	switch f.Type {
+	case models.FieldText:
+		s, ok := v.(string)
+		if !ok || len(s) > 2000 {
+			return nil, invalid
+		}
+		return strings.TrimSpace(s), nil
+	case models.FieldNumber:
+		n, ok := v.(float64)
+		if !ok {
+			return nil, invalid
+		}
+		return n, nil
+	case models.FieldSelect:
+		s, ok := v.(string)
+		if !ok {
+			return nil, invalid
+		}
+		for _, option := range f.Options {
+			if s == option {
+				return s, nil
+			}
+		}
+		return nil, invalid
+	case models.FieldDate:
+		s, ok := v.(string)
+		if !ok {
+			return nil, invalid
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return nil, invalid
+		}
+		return s, nil
+	case models.FieldAsset:
+		n, ok := v.(float64)
+		if !ok || n != float64(int(n)) {
+			return nil, invalid
+		}
+		if err := checkAssetOwner(database, int(n), requester.ID); err != nil {
+			return nil, err
+		}
+		return int(n), nil
+	}
+	return nil, invalid
+}
+
+// ListCategories returns the category tree with field definitions. Inactive
+// categories are only shown to admins.
+func ListCategories(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	tree, err := loadCategoryTree(database, user.TenantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+
+	roots := tree.roots
+	if user.Role != "admin" {
+		roots = activeOnly(roots)
+	}
+	if roots == nil {
+		roots = []*models.Category{}
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": roots})
+}
+
+func activeOnly(cats []*models.Category) []*models.Category {
+	var out []*models.Category
+	for _, cat := range cats {
+		if !cat.Active {
+			continue
+		}
+		copied := *cat
+		copied.Children = activeOnly(cat.Children)
+		out = append(out, &copied)
+	}
+	return out
+}
+
+type categoryInput struct {
+	ParentID        *int    `json:"parent_id"`
+	Name            string  `json:"name"`
+	DefaultPriority *string `json:"default_priority"`
+	SLAHours        *int    `json:"sla_hours"`
+	SortOrder       int     `json:"sort_order"`
+	Active          *bool   `json:"active"`
+}
+
+func (in *categoryInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" || strings.Contains(in.Name, "/") {
+		return fiber.NewError(fiber.StatusBadRequest, "Name is required and cannot contain /")
+	}
+	if in.DefaultPriority != nil && !validPriority(*in.DefaultPriority) {
+		return fiber.NewError(fiber.StatusBadRequest, "Priority must be low, normal, high or urgent")
+	}
+	if in.SLAHours != nil && *in.SLAHours <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "sla_hours must be positive")
+	}
+	return nil
+}
+
+func CreateCategory(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	var input categoryInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	if err := input.validate(); err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if input.ParentID != nil {
+		var exists bool
+		database.QueryRow(`SELECT EXISTS(SELECT 1 FROM ticket_categories WHERE id = ? AND tenant_id = ?)`,
+			*input.ParentID, admin.TenantID).Scan(&exists)
+		if !exists {
+			return fiber.NewError(fiber.StatusBadRequest, "Parent category not found")
+		}
+	}
+
+	result, err := database.Exec(`
+		INSERT INTO ticket_categories (tenant_id, parent_id, name, default_priority, sla_hours, sort_order)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		admin.TenantID, input.ParentID, input.Name, input.DefaultPriority, input.SLAHours, input.SortOrder)
+	if err != nil {
+		return fiber.NewError(fiber.StatusConflict, "A category with this name already exists here")
+	}
+	id, _ := result.LastInsertId()
+
+	return c.JSON(fiber.Map{"success": true, "message": "Category created", "id": id})
+}
+
+// UpdateCategory renames, moves or reconfigures a category. Existing tickets
+// keep the category path they were filed with.
+func UpdateCategory(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid category ID")
+	}
+
+	var input categoryInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	if err := input.validate(); err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	tree, err := loadCategoryTree(database, admin.TenantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if _, ok := tree.byID[id]; !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Category not found")
+	}
+	if input.ParentID != nil {
+		if _, ok := tree.byID[*input.ParentID]; !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "Parent category not found")
+		}
+		for _, d := range tree.descendants(id) {
+			if d == *input.ParentID {
+				return fiber.NewError(fiber.StatusBadRequest, "A category cannot be moved below itself")
+			}
+		}
+	}
+
+	_, err = database.Exec(`
+		UPDATE ticket_categories SET parent_id = ?, name = ?, default_priority = ?, sla_hours = ?, sort_order = ?,
+			active = COALESCE(?, active)
+		WHERE id = ?`,
+		input.ParentID, input.Name, input.DefaultPriority, input.SLAHours, input.SortOrder, input.Active, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusConflict, "A category with this name already exists here")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Category updated"})
+}
+
+// DeleteCategory removes an unused leaf category. Categories with tickets are
+// deactivated instead so reports keep working.
+func DeleteCategory(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid category ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var exists, hasChildren, hasTickets bool
+	database.QueryRow(`SELECT EXISTS(SELECT 1 FROM ticket_categories WHERE id = ? AND tenant_id = ?)`, id, admin.TenantID).Scan(&exists)
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Category not found")
+	}
+	database.QueryRow(`SELECT EXISTS(SELECT 1 FROM ticket_categories WHERE parent_id = ?)`, id).Scan(&hasChildren)
+	if hasChildren {
+		return fiber.NewError(fiber.StatusConflict, "Delete or move the subcategories first")
+	}
+	database.QueryRow(`SELECT EXISTS(SELECT 1 FROM support_requests WHERE category_id = ?)`, id).Scan(&hasTickets)
+
+	if hasTickets {
+		if _, err := database.Exec(`UPDATE ticket_categories SET active = 0 WHERE id = ?`, id); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+		}
+		return c.JSON(fiber.Map{"success": true, "message": "Category has tickets and was deactivated"})
+	}
+	if _, err := database.Exec(`DELETE FROM ticket_categories WHERE id = ?`, id); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Category deleted"})
+}
+
+type categoryFieldInput struct {
+	Key       string   `json:"key"`
+	Label     string   `json:"label"`
+	Type      string   `json:"type"`
+	Required  bool     `json:"required"`
+	Options   []string `json:"options"`
+	SortOrder int      `json:"sort_order"`
+}
+
+// validate checks the definition except the key and returns the options as
+// stored.
+func (in *categoryFieldInput) validate() (*string, error) {
+	in.Label = strings.TrimSpace(in.Label)
+	if in.Label == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Label is required")
+	}
+	switch in.Type {
+	case models.FieldText, models.FieldNumber, models.FieldDate, models.FieldAsset:
+		return nil, nil
+	case models.FieldSelect:
+		if len(in.Options) == 0 {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Select fields need options")
+		}
+		raw, _ := json.Marshal(in.Options)
+		options := string(raw)
+		return &options, nil
+	}
+	return nil, fiber.NewError(fiber.StatusBadRequest, "type must be text, number, select, date or asset")
+}
+
+func CreateCategoryField(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	categoryID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid category ID")
+	}
+
+	var input categoryFieldInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	if !fieldKeyPattern.MatchString(input.Key) {
+		return fiber.NewError(fiber.StatusBadRequest, "key must be lowercase letters, digits and _")
+	}
+	options, err := input.validate()
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	tree, err := loadCategoryTree(database, admin.TenantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if _, ok := tree.byID[categoryID]; !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Category not found")
+	}
+	// a key must be unique along the chain, otherwise the inherited and the
+	// own field would fight over the same value
+	for _, d := range append(tree.descendants(categoryID), ancestorIDs(tree, categoryID)...) {
+		for _, f := range tree.byID[d].Fields {
+			if f.Key == input.Key {
+				return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Field %q already exists in %s", input.Key, tree.path(d)))
+			}
+		}
+	}
+
+	result, err := database.Exec(`
+		INSERT INTO category_fields (category_id, field_key, label, type, required, options, sort_order)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		categoryID, input.Key, input.Label, input.Type, input.Required, options, input.SortOrder)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	id, _ := result.LastInsertId()
+
+	return c.JSON(fiber.Map{"success": true, "message": "Field created", "id": id})
+}
+
+func ancestorIDs(tree *categoryTree, id int) []int {
+	var ids []int
+	for _, cat := range tree.chain(id)[1:] {
+		ids = append(ids, cat.ID)
+	}
+	return ids
+}
+
+// checkTenantField makes fields of other tenants look missing.
+func checkTenantField(database *sql.DB, admin models.User, id int) error {
+	var exists bool
+	database.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM category_fields f JOIN ticket_categories c ON c.id = f.category_id
+		WHERE f.id = ? AND c.tenant_id = ?)`, id, admin.TenantID).Scan(&exists)
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Field not found")
+	}
+	return nil
+}
+
+// UpdateCategoryField changes a field definition. The key is fixed because
+// tickets already store values under it.
+func UpdateCategoryField(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("fieldId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid field ID")
+	}
+
+	var input categoryFieldInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	options, err := input.validate()
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := checkTenantField(database, admin, id); err != nil {
+		return err
+	}
+	_, err = database.Exec(`UPDATE category_fields SET label = ?, type = ?, required = ?, options = ?, sort_order = ? WHERE id = ?`,
+		input.Label, input.Type, input.Required, options, input.SortOrder, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Field updated"})
+}
+
+func DeleteCategoryField(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("fieldId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid field ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := checkTenantField(database, admin, id); err != nil {
+		return err
+	}
+	if _, err := database.Exec(`DELETE FROM category_fields WHERE id = ?`, id); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Field deleted"})
+}
+
+// CategoryReport counts tickets per category, rolled up to every ancestor.
+// ?from= and ?to= (YYYY-MM-DD) limit by creation date.
+func CategoryReport(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	where := `WHERE tenant_id = ? AND category_id IS NOT NULL`
+	args := []any{admin.TenantID}
+	if from, err := time.ParseInLocation("2006-01-02", c.Query("from"), utils.BusinessLocation()); err == nil {
+		where += ` AND created_at >= ?`
+		args = append(args, from)
+	}
+	if to, err := time.ParseInLocation("2006-01-02", c.Query("to"), utils.BusinessLocation()); err == nil {
+		where += ` AND created_at < ?`
+		args = append(args, to.AddDate(0, 0, 1))
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	tree, err := loadCategoryTree(database, admin.TenantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+
+	rows, err := database.Query(`
+		SELECT category_id, priority, COUNT(*),
+			COALESCE(SUM(status NOT IN (?, ?)), 0),
+			COALESCE(SUM(status NOT IN (?, ?) AND due_at < NOW()), 0)
+		FROM support_requests `+where+`
+		GROUP BY category_id, priority`,
+		append([]any{models.StatusResolved, models.StatusClosed, models.StatusResolved, models.StatusClosed}, args...)...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	type line struct {
+		CategoryID int            `json:"category_id"`
+		Path       string         `json:"path"`
+		Total      int            `json:"total"`
+		Open       int            `json:"open"`
+		Overdue    int            `json:"overdue"`
+		ByPriority map[string]int `json:"by_priority"`
+	}
+	lines := map[int]*line{}
+	for rows.Next() {
+		var categoryID, total, open, overdue int
+		var priority string
+		if err := rows.Scan(&categoryID, &priority, &total, &open, &overdue); err != nil {
+			continue
+		}
+		// every ancestor includes the tickets of its subcategories
+		for _, cat := range tree.chain(categoryID) {
+			l, ok := lines[cat.ID]
+			if !ok {
+				l = &line{CategoryID: cat.ID, Path: tree.path(cat.ID), ByPriority: map[string]int{}}
+				lines[cat.ID] = l
+			}
+			l.Total += total
+			l.Open += open
+			l.Overdue += overdue
+			l.ByPriority[priority] += total
+		}
+	}
+
+	report := make([]*line, 0, len(lines))
+	for _, l := range lines {
+		report = append(report, l)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Path < report[j].Path })
+
+	return c.JSON(fiber.Map{"success": true, "data": report})
+}
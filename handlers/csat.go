@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"ithelp/db"
+	"ithelp/models"
+	"ithelp/surveys"
+	"ithelp/tenants"
+	"ithelp/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// surveyFromToken resolves the signed token of a survey link. The token is
+// the only credential, like the calendar feed token.
+func surveyFromToken(c *fiber.Ctx) (int, error) {
+	id, err := utils.VerifyToken(surveys.TokenPurpose, c.Params("token"))
+	if err != nil {
+		return 0, fiber.NewError(fiber.StatusNotFound, "Survey link is invalid or has expired")
+	}
+	return id, nil
+}
+
+// GetSurvey shows what the survey is about. Public, authenticated by the token.
+func GetSurvey(c *fiber.Ctx) error {
+	id, err := surveyFromToken(c)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var tenantID, requestID int
+	var title string
+	var techName sql.NullString
+	var rating *int
+	err = database.QueryRow(`
+		SELECT cs.tenant_id, cs.request_id, s.title, t.name, cs.rating
+		FROM csat_surveys cs
+		JOIN support_requests s ON s.id = cs.request_id
+		LEFT JOIN users t ON t.id = cs.technician_id
+		WHERE cs.id = ?`, id).Scan(&tenantID, &requestID, &title, &techName, &rating)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Survey not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+
+	brand := ""
+	if tenant, err := tenants.ByID(tenantID); err == nil {
+		brand = tenant.DisplayName()
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": fiber.Map{
+		"request_id": requestID,
+		"title":      title,
+		"technician": techName.String,
+		"brand":      brand,
+		"answered":   rating != nil,
+	}})
+}
+
+// SubmitSurvey stores the 1-5 rating and optional comment. A survey can be
+// answered once.
+func SubmitSurvey(c *fiber.Ctx) error {
+	id, err := surveyFromToken(c)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Rating  int    `json:"rating"`
+		Comment string `json:"comment"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	if input.Rating < 1 || input.Rating > 5 {
+		return fiber.NewError(fiber.StatusBadRequest, "Rating must be between 1 and 5")
+	}
+	var comment *string
+	if s := strings.TrimSpace(input.Comment); s != "" {
+		comment = &s
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	result, err := database.Exec(`UPDATE csat_surveys SET rating = ?, comment = ?, responded_at = NOW() WHERE id = ? AND rating IS NULL`,
+		input.Rating, comment, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusConflict, "Survey has already been answered")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Thank you for your feedback"})
+}
+
+// csatPeriod builds the sent_at filter from ?from= and ?to= (YYYY-MM-DD).
+func csatPeriod(c *fiber.Ctx, tenant int) (string, []any) {
+	where := `WHERE cs.tenant_id = ?`
+	args := []any{tenant}
+	if from, err := time.ParseInLocation("2006-01-02", c.Query("from"), utils.BusinessLocation()); err == nil {
+		where += ` AND cs.sent_at >= ?`
+		args = append(args, from)
+	}
+	if to, err := time.ParseInLocation("2006-01-02", c.Query("to"), utils.BusinessLocation()); err == nil {
+		where += ` AND cs.sent_at < ?`
+		args = append(args, to.AddDate(0, 0, 1))
+	}
+	return where, args
+}
+
+// CSATReport aggregates surveys per technician (default) or, with
+// ?group_by=category, per ticket category.
+func CSATReport(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	var group string
+	switch c.Query("group_by", "technician") {
+	case "technician":
+		group = `cs.technician_id, COALESCE(u.name, '')`
+	case "category":
+		group = `cs.category_id, COALESCE(cs.category, '')`
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "group_by must be technician or category")
+	}
+	where, args := csatPeriod(c, admin.TenantID)
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`
+		SELECT `+group+`, COUNT(*), COUNT(cs.rating), COALESCE(AVG(cs.rating), 0), COALESCE(SUM(cs.rating >= 4), 0)
+		FROM csat_surveys cs LEFT JOIN users u ON u.id = cs.technician_id
+		`+where+`
+		GROUP BY `+group+`
+		ORDER BY COALESCE(AVG(cs.rating), 0) DESC`, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	stats := []models.CSATStats{}
+	for rows.Next() {
+		var s models.CSATStats
+		var satisfied int
+		if err := rows.Scan(&s.ID, &s.Name, &s.Sent, &s.Responses, &s.AverageRating, &satisfied); err != nil {
+			continue
+		}
+		if s.Sent > 0 {
+			s.ResponseRate = float64(s.Responses) * 100 / float64(s.Sent)
+		}
+		if s.Responses > 0 {
+			s.CSAT = float64(satisfied) * 100 / float64(s.Responses)
+		}
+		stats = append(stats, s)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": stats})
+}
+
+// ListSurveyResponses returns answered surveys, newest first. Admins filter
+// with ?technician_id=, ?rating= and ?request_id=; technicians see their own.
+func ListSurveyResponses(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+
+	where, args := csatPeriod(c, user.TenantID)
+	where += ` AND cs.rating IS NOT NULL`
+	if user.Role == "tech" {
+		where += ` AND cs.technician_id = ?`
+		args = append(args, user.ID)
+	} else if id := c.QueryInt("technician_id"); id != 0 {
+		where += ` AND cs.technician_id = ?`
+		args = append(args, id)
+	}
+	if rating := c.QueryInt("rating"); rating != 0 {
+		where += ` AND cs.rating = ?`
+		args = append(args, rating)
+	}
+	if id := c.QueryInt("request_id"); id != 0 {
+		where += ` AND cs.request_id = ?`
+		args = append(args, id)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`
+		SELECT cs.id, cs.request_id, cs.customer_id, cs.technician_id, cs.category, cs.rating, cs.comment,
+			cs.sent_at, cs.reminded_at, cs.responded_at
+		FROM csat_surveys cs `+where+` ORDER BY cs.responded_at DESC LIMIT 500`, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	list := []models.CSATSurvey{}
+	for rows.Next() {
+		var s models.CSATSurvey
+		if err := rows.Scan(&s.ID, &s.RequestID, &s.CustomerID, &s.TechnicianID, &s.Category, &s.Rating, &s.Comment,
+			&s.SentAt, &s.RemindedAt, &s.RespondedAt); err != nil {
+			continue
+		}
+		list = append(list, s)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": list})
+}
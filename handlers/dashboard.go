@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"database/sql"
+	"time"
+
+	"ithelp/db"
+	"ithelp/models"
+	"ithelp/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const defaultRangeDays = 30
+
+// dateRange reads ?from= and ?to= (YYYY-MM-DD, both inclusive) in business
+// time and returns the half-open range [from, to). Without them it covers
+// the last 30 days including today.
+func dateRange(c *fiber.Ctx) (time.Time, time.Time, error) {
+	return parseRange(c.Query("from"), c.Query("to"))
+}
+
+// parseRange is dateRange for from and to given as strings.
+func parseRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	loc := utils.BusinessLocation()
+	y, m, d := time.Now().In(loc).Date()
+	to := time.Date(y, m, d, 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	if toStr != "" {
+		t, err := time.ParseInLocation("2006-01-02", toStr, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, fiber.NewError(fiber.StatusBadRequest, "to must be YYYY-MM-DD")
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	from := to.AddDate(0, 0, -defaultRangeDays)
+	if fromStr != "" {
+		t, err := time.ParseInLocation("2006-01-02", fromStr, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, fiber.NewError(fiber.StatusBadRequest, "from must be YYYY-MM-DD")
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fiber.NewError(fiber.StatusBadRequest, "from must not be after to")
+	}
+	return from, to, nil
+}
+
+func scanCounts(rows *sql.Rows, err error) ([]models.CountBy, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []models.CountBy{}
+	for rows.Next() {
+		var cb models.CountBy
+		if err := rows.Scan(&cb.Key, &cb.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, cb)
+	}
+	return out, rows.Err()
+}
+
+// AdminDashboard returns the operations overview of the tenant for
+// ?from= to ?to= (YYYY-MM-DD, default the last 30 days).
+func AdminDashboard(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	from, to, err := dateRange(c)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	tenant := admin.TenantID
+	closed := []any{models.StatusResolved, models.StatusClosed}
+	d := models.Dashboard{From: from.Format("2006-01-02"), To: to.AddDate(0, 0, -1).Format("2006-01-02")}
+	fail := func() error { return fiber.NewError(fiber.StatusInternalServerError, "Query error") }
+
+	// open work right now; merged duplicates are closed already
+	open := `tenant_id = ? AND status NOT IN (?, ?)`
+	openArgs := append([]any{tenant}, closed...)
+
+	if d.OpenByStatus, err = scanCounts(database.Query(`
+		SELECT status, COUNT(*) FROM support_requests WHERE `+open+` GROUP BY status ORDER BY COUNT(*) DESC`, openArgs...)); err != nil {
+		return fail()
+	}
+	if d.OpenByCategory, err = scanCounts(database.Query(`
+		SELECT COALESCE(category, ''), COUNT(*) FROM support_requests WHERE `+open+`
+		GROUP BY COALESCE(category, '') ORDER BY COUNT(*) DESC`, openArgs...)); err != nil {
+		return fail()
+	}
+
+	loc := utils.BusinessLocation()
+	y, m, day := time.Now().In(loc).Date()
+	today := time.Date(y, m, day, 0, 0, 0, 0, loc)
+	err = database.QueryRow(`
+		SELECT
+			COALESCE(SUM(status NOT IN (?, ?) AND assigned_to IS NULL), 0),
+			COALESCE(SUM(due_at >= ? AND due_at < NOW() AND (resolved_at IS NULL OR resolved_at > due_at) AND merged_into IS NULL), 0)
+		FROM support_requests WHERE tenant_id = ?`,
+		models.StatusResolved, models.StatusClosed, today, tenant).Scan(&d.Unassigned, &d.SLABreachesToday)
+	if err != nil {
+		return fail()
+	}
+
+	// first response is the first reply the customer could see
+	err = database.QueryRow(`
+		SELECT COUNT(*), AVG(TIMESTAMPDIFF(MINUTE, s.created_at,
+			(SELECT MIN(n.created_at) FROM tech_notes n WHERE n.request_id = s.id AND n.internal = 0)))
+		FROM support_requests s
+		WHERE s.tenant_id = ? AND s.created_at >= ? AND s.created_at < ? AND s.merged_into IS NULL`,
+		tenant, from, to).Scan(&d.Created, &d.AvgFirstResponseMinutes)
+	if err != nil {
+		return fail()
+	}
+	err = database.QueryRow(`
+		SELECT COUNT(*), AVG(TIMESTAMPDIFF(MINUTE, created_at, resolved_at))
+		FROM support_requests WHERE tenant_id = ? AND resolved_at >= ? AND resolved_at < ?`,
+		tenant, from, to).Scan(&d.Resolved, &d.AvgResolutionMinutes)
+	if err != nil {
+		return fail()
+	}
+
+	rows, err := database.Query(`
+		SELECT u.id, u.name,
+			COUNT(CASE WHEN s.status NOT IN (?, ?) THEN 1 END),
+			COUNT(CASE WHEN s.created_at >= ? AND s.created_at < ? THEN 1 END),
+			COUNT(CASE WHEN s.resolved_at >= ? AND s.resolved_at < ? THEN 1 END)
+		FROM users u
+		LEFT JOIN support_requests s ON s.assigned_to = u.id AND s.merged_into IS NULL
+		WHERE u.tenant_id = ? AND u.role = 'tech'
+		GROUP BY u.id, u.name
+		ORDER BY 3 DESC, u.name`,
+		models.StatusResolved, models.StatusClosed, from, to, from, to, tenant)
+	if err != nil {
+		return fail()
+	}
+	d.Technicians = []models.TechnicianLoad{}
+	for rows.Next() {
+		var t models.TechnicianLoad
+		if err := rows.Scan(&t.ID, &t.Name, &t.Open, &t.Received, &t.Resolved); err == nil {
+			d.Technicians = append(d.Technicians, t)
+		}
+	}
+	rows.Close()
+
+	err = database.QueryRow(`SELECT COUNT(*) FROM users WHERE tenant_id = ? AND role = 'user' AND registered_at >= ? AND registered_at < ?`,
+		tenant, from, to).Scan(&d.NewRegistrations)
+	if err != nil {
+		return fail()
+	}
+
+	rows, err = database.Query(`
+		SELECT COALESCE(plan, ''), SUM(kind = 'user'), SUM(kind = 'organization') FROM (
+			SELECT subscription_plan AS plan, 'user' AS kind FROM users
+			WHERE tenant_id = ? AND subscription_start <= NOW() AND subscription_end >= NOW()
+			UNION ALL
+			SELECT subscription_plan, 'organization' FROM organizations
+			WHERE tenant_id = ? AND subscription_start <= NOW() AND subscription_end >= NOW()
+		) active
+		GROUP BY COALESCE(plan, '') ORDER BY 1`, tenant, tenant)
+	if err != nil {
+		return fail()
+	}
+	defer rows.Close()
+	d.ActiveSubscriptions = []models.PlanSubscriptions{}
+	for rows.Next() {
+		var p models.PlanSubscriptions
+		if err := rows.Scan(&p.Plan, &p.Users, &p.Organizations); err == nil {
+			d.ActiveSubscriptions = append(d.ActiveSubscriptions, p)
+		}
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": d})
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"ithelp/db"
+	"ithelp/models"
+	"ithelp/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// report is what an export streams: the header row and a query returning
+// the rows in the same column order.
+type report struct {
+	name    string
+	headers []string
+	query   string
+	args    []any
+}
+
+type reportBuilder func(database *sql.DB, user models.User, p params) (report, error)
+
+// reportBuilders build the reports of the user's tenant from query-string
+// style parameters, rejecting invalid ones before anything is streamed.
+var reportBuilders = map[string]reportBuilder{
+	"tickets":     ticketsReport,
+	"technicians": techniciansReport,
+	"plan-usage":  planUsageReport,
+	"revenue":     revenueReport,
+}
+
+func buildReport(database *sql.DB, user models.User, name string, p params) (report, error) {
+	build, ok := reportBuilders[name]
+	if !ok {
+		return report{}, fiber.NewError(fiber.StatusNotFound, "Unknown report")
+	}
+	return build(database, user, p)
+}
+
+// ticketsReport takes the filters of the ticket listing (or ?view_id=) and
+// optionally ?from= and ?to= on the creation date.
+func ticketsReport(database *sql.DB, user models.User, p params) (report, error) {
+	filter, sort, order, err := listingFilter(database, user, p)
+	if err != nil {
+		return report{}, err
+	}
+	where, args, err := filter.where(database, user.TenantID)
+	if err != nil {
+		return report{}, err
+	}
+	if p["from"] != "" || p["to"] != "" {
+		from, to, err := parseRange(p["from"], p["to"])
+		if err != nil {
+			return report{}, err
+		}
+		where += " AND created_at >= ? AND created_at < ?"
+		args = append(args, from, to)
+	}
+	orderClause, err := orderBy(sort, order)
+	if err != nil {
+		return report{}, err
+	}
+	if orderClause == "" {
+		orderClause = " ORDER BY id"
+	}
+
+	return report{
+		name: "tickets",
+		headers: []string{"ID", "Created", "Title", "Status", "Priority", "Category", "Region",
+			"Customer", "Customer phone", "Technician", "Tags", "Due", "Resolved", "Reopened"},
+		query: `
+			SELECT id, created_at, title, status, priority, category, region,
+				(SELECT name FROM users WHERE id = s.user_id),
+				(SELECT phone FROM users WHERE id = s.user_id),
+				(SELECT name FROM users WHERE id = s.assigned_to),
+				(SELECT GROUP_CONCAT(tag ORDER BY tag) FROM ticket_tags WHERE request_id = s.id),
+				due_at, resolved_at, reopen_count
+			FROM support_requests s WHERE ` + where + orderClause,
+		args: args,
+	}, nil
+}
+
+// techniciansReport is the performance of each technician between ?from=
+// and ?to= (default the last 30 days), or of ?technician_id= only.
+func techniciansReport(database *sql.DB, user models.User, p params) (report, error) {
+	from, to, err := parseRange(p["from"], p["to"])
+	if err != nil {
+		return report{}, err
+	}
+	where := "u.tenant_id = ? AND u.role = 'tech'"
+	args := []any{
+		from, to, from, to, models.StatusResolved, models.StatusClosed, from, to,
+		from, to, from, to, from, to, from, to,
+		user.TenantID,
+	}
+	if id := p.Int("technician_id"); id != 0 {
+		where += " AND u.id = ?"
+		args = append(args, id)
+	}
+
+	return report{
+		name: "technicians",
+		headers: []string{"ID", "Technician", "Received", "Resolved", "Open", "Avg resolution (min)",
+			"Hours logged", "Onsite visits", "CSAT responses", "CSAT average"},
+		query: `
+			SELECT u.id, u.name,
+				(SELECT COUNT(*) FROM support_requests s WHERE s.assigned_to = u.id AND s.merged_into IS NULL
+					AND s.created_at >= ? AND s.created_at < ?),
+				(SELECT COUNT(*) FROM support_requests s WHERE s.assigned_to = u.id
+					AND s.resolved_at >= ? AND s.resolved_at < ?),
+				(SELECT COUNT(*) FROM support_requests s WHERE s.assigned_to = u.id AND s.merged_into IS NULL
+					AND s.status NOT IN (?, ?)),
+				(SELECT ROUND(AVG(TIMESTAMPDIFF(MINUTE, s.created_at, s.resolved_at))) FROM support_requests s
+					WHERE s.assigned_to = u.id AND s.resolved_at >= ? AND s.resolved_at < ?),
+				(SELECT ROUND(COALESCE(SUM(TIMESTAMPDIFF(MINUTE, e.started_at, e.ended_at)), 0) / 60, 2) FROM time_entries e
+					WHERE e.technician_id = u.id AND e.status <> 'rejected' AND e.started_at >= ? AND e.started_at < ?),
+				(SELECT COUNT(*) FROM appointments a WHERE a.technician_id = u.id AND a.status = 'completed'
+					AND a.starts_at >= ? AND a.starts_at < ?),
+				(SELECT COUNT(*) FROM csat_surveys v WHERE v.technician_id = u.id AND v.rating IS NOT NULL
+					AND v.responded_at >= ? AND v.responded_at < ?),
+				(SELECT ROUND(AVG(v.rating), 2) FROM csat_surveys v WHERE v.technician_id = u.id AND v.rating IS NOT NULL
+					AND v.responded_at >= ? AND v.responded_at < ?)
+			FROM users u WHERE ` + where + ` ORDER BY u.name`,
+		args: args,
+	}, nil
+}
+
+// planUsageReport lists active subscriptions of customers and organizations
+// with their quota use in the current period, counted like loadPlanUsage.
+// Filters: ?plan= and ?type=user|organization.
+func planUsageReport(database *sql.DB, user models.User, p params) (report, error) {
+	where := "1 = 1"
+	var args []any
+	if plan := p["plan"]; plan != "" {
+		where += " AND plan = ?"
+		args = append(args, plan)
+	}
+	switch kind := p["type"]; kind {
+	case "":
+	case "user", "organization":
+		where += " AND kind = ?"
+		args = append(args, kind)
+	default:
+		return report{}, fiber.NewError(fiber.StatusBadRequest, "type must be user or organization")
+	}
+
+	return report{
+		name: "plan-usage",
+		headers: []string{"Type", "ID", "Name", "Plan", "Period start", "Period end",
+			"Remote calls", "Remote used", "Remote remaining", "Onsite calls", "Onsite used", "Onsite remaining"},
+		query: `
+			SELECT kind, id, name, plan, starts, ends,
+				remote_calls, remote_used, GREATEST(remote_calls - remote_used, 0),
+				onsite_calls, onsite_used, GREATEST(onsite_calls - onsite_used, 0)
+			FROM (
+				SELECT 'user' AS kind, u.id, u.name, p.name AS plan, u.subscription_start AS starts, u.subscription_end AS ends,
+					p.remote_calls, p.onsite_calls,
+					(SELECT COUNT(*) FROM support_requests s
+						WHERE s.user_id = u.id AND s.organization_id IS NULL
+						AND s.created_at BETWEEN u.subscription_start AND u.subscription_end
+						AND NOT EXISTS (SELECT 1 FROM appointments a WHERE a.request_id = s.id AND a.status <> 'cancelled')) AS remote_used,
+					(SELECT COUNT(*) FROM appointments a JOIN support_requests s ON s.id = a.request_id
+						WHERE a.customer_id = u.id AND s.organization_id IS NULL AND a.status <> 'cancelled'
+						AND a.starts_at BETWEEN u.subscription_start AND u.subscription_end) AS onsite_used
+				FROM users u
+				JOIN plans p ON p.name = u.subscription_plan AND p.tenant_id = u.tenant_id
+				WHERE u.tenant_id = ? AND u.subscription_start <= NOW() AND u.subscription_end >= NOW()
+				UNION ALL
+				SELECT 'organization', o.id, o.name, p.name, o.subscription_start, o.subscription_end,
+					p.remote_calls, p.onsite_calls,
+					(SELECT COUNT(*) FROM support_requests s
+						WHERE s.organization_id = o.id AND s.created_at BETWEEN o.subscription_start AND o.subscription_end
+						AND NOT EXISTS (SELECT 1 FROM appointments a WHERE a.request_id = s.id AND a.status <> 'cancelled')),
+					(SELECT COUNT(*) FROM appointments a JOIN support_requests s ON s.id = a.request_id
+						WHERE s.organization_id = o.id AND a.status <> 'cancelled'
+						AND a.starts_at BETWEEN o.subscription_start AND o.subscription_end)
+				FROM organizations o
+				JOIN plans p ON p.name = o.subscription_plan AND p.tenant_id = o.tenant_id
+				WHERE o.tenant_id = ? AND o.subscription_start <= NOW() AND o.subscription_end >= NOW()
+			) subscriptions
+			WHERE ` + where + ` ORDER BY kind DESC, name`,
+		args: append([]any{user.TenantID, user.TenantID}, args...),
+	}, nil
+}
+
+// revenueReport lists invoices issued between ?from= and ?to= (default the
+// last 30 days), with the ?user_id= and ?status= filters of ListInvoices.
+func revenueReport(database *sql.DB, user models.User, p params) (report, error) {
+	from, to, err := parseRange(p["from"], p["to"])
+	if err != nil {
+		return report{}, err
+	}
+	where := "u.tenant_id = ? AND i.issued_at >= ? AND i.issued_at < ?"
+	args := []any{user.TenantID, from, to}
+	if id := p.Int("user_id"); id != 0 {
+		where += " AND i.user_id = ?"
+		args = append(args, id)
+	}
+	if status := p["status"]; status != "" {
+		where += " AND i.status = ?"
+		args = append(args, status)
+	}
+
+	return report{
+		name:    "revenue",
+		headers: []string{"Invoice", "Customer ID", "Customer", "Phone", "Status", "Total", "Issued", "Paid"},
+		query: `
+			SELECT i.id, u.id, u.name, u.phone, i.status, i.total, i.issued_at, i.paid_at
+			FROM invoices i JOIN users u ON u.id = i.user_id
+			WHERE ` + where + ` ORDER BY i.issued_at, i.id`,
+		args: args,
+	}, nil
+}
+
+// writeReport runs the report query on its own connection and writes the
+// rows to w as they arrive.
+func writeReport(w io.Writer, format string, r report) error {
+	database, err := db.Connect()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	rows, err := database.Query(r.query, r.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+
+	sheet, err := utils.NewSheetWriter(w, format, r.headers)
+	if err != nil {
+		return err
+	}
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		row := make([]any, len(values))
+		for i, v := range values {
+			row[i] = cellValue(v, columns[i].DatabaseTypeName())
+		}
+		if err := sheet.Write(row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return sheet.Close()
+}
+
+// cellValue turns what the driver scanned into a spreadsheet value, keeping
+// numbers numeric.
+func cellValue(v any, dbType string) any {
+	b, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+	switch dbType {
+	case "DECIMAL", "FLOAT", "DOUBLE":
+		if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+			return f
+		}
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT":
+		if n, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return n
+		}
+	}
+	return string(b)
+}
+
+// ExportReport streams report :name (tickets, technicians, plan-usage or
+// revenue) as ?format=csv (default) or xlsx, taking the filters of the
+// matching listing from the query string.
+func ExportReport(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	format := c.Query("format", "csv")
+	contentType, ok := utils.SheetContentTypes[format]
+	if !ok {
+		return fiber.NewError(fiber.StatusBadRequest, utils.ErrBadFormat.Error())
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	r, err := buildReport(database, admin, c.Params("name"), params(c.Queries()))
+	database.Close()
+	if err != nil {
+		return err
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", r.name, time.Now().In(utils.BusinessLocation()).Format("2006-01-02"), format)
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		if err := writeReport(w, format, r); err != nil {
+			log.Printf("export %s: %v", r.name, err)
+		}
+	}))
+	return nil
+}
@@ -0,0 +1,679 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"ithelp/db"
+	"ithelp/events"
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func requireStaff(c *fiber.Ctx) (models.User, error) {
+	user, ok := currentUser(c)
+	if !ok {
+		return user, fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	if user.Role != "admin" && user.Role != "tech" {
+		return user, fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+	return user, nil
+}
+
+// ListParts returns the catalog to staff. ?q= searches name and SKU.
+func ListParts(c *fiber.Ctx) error {
+	if _, err := requireStaff(c); err != nil {
+		return err
+	}
+
+	query := `SELECT id, sku, name, COALESCE(category, ''), unit_price, low_stock_threshold, active FROM parts WHERE tenant_id = ?`
+	args := []any{tenantID(c)}
+	if q := c.Query("q"); q != "" {
+		query += ` AND (name LIKE ? OR sku LIKE ?)`
+		args = append(args, "%"+q+"%", "%"+q+"%")
+	}
+	if !c.QueryBool("include_inactive") {
+		query += ` AND active = 1`
+	}
+	query += ` ORDER BY name`
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	parts := []models.Part{}
+	for rows.Next() {
+		var p models.Part
+		if err := rows.Scan(&p.ID, &p.SKU, &p.Name, &p.Category, &p.UnitPrice, &p.LowStockThreshold, &p.Active); err != nil {
+			continue
+		}
+		parts = append(parts, p)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": parts})
+}
+
+func CreatePart(c *fiber.Ctx) error {
+	if _, err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	var input models.Part
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+	}
+	if strings.TrimSpace(input.SKU) == "" || strings.TrimSpace(input.Name) == "" || input.UnitPrice < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "SKU, name and a non-negative price are required")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	result, err := database.Exec(`INSERT INTO parts (tenant_id, sku, name, category, unit_price, low_stock_threshold) VALUES (?, ?, ?, ?, ?, ?)`,
+		tenantID(c), input.SKU, input.Name, input.Category, input.UnitPrice, input.LowStockThreshold)
+	if err != nil {
+		return fiber.NewError(fiber.StatusConflict, "Part could not be created, SKU may already exist")
+	}
+	id, _ := result.LastInsertId()
+
+	return c.JSON(fiber.Map{"success": true, "message": "Part created", "id": id})
+}
+
+func UpdatePart(c *fiber.Ctx) error {
+	if _, err := requireAdmin(c); err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid part ID")
+	}
+
+	// a part stays active or inactive unless "active" is sent
+	var input struct {
+		SKU               string  `json:"sku"`
+		Name              string  `json:"name"`
+		Category          string  `json:"category"`
+		UnitPrice         float64 `json:"unit_price"`
+		LowStockThreshold int     `json:"low_stock_threshold"`
+		Active            *bool   `json:"active"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+	}
+	if strings.TrimSpace(input.SKU) == "" || strings.TrimSpace(input.Name) == "" || input.UnitPrice < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "SKU, name and a non-negative price are required")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "parts", id); err != nil {
+		return err
+	}
+
+	_, err = database.Exec(`UPDATE parts SET sku = ?, name = ?, category = ?, unit_price = ?, low_stock_threshold = ?, active = COALESCE(?, active) WHERE id = ?`,
+		input.SKU, input.Name, input.Category, input.UnitPrice, input.LowStockThreshold, input.Active, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Part updated"})
+}
+
+func ListStockLocations(c *fiber.Ctx) error {
+	if _, err := requireStaff(c); err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`SELECT id, name, type, technician_id FROM stock_locations WHERE tenant_id = ? ORDER BY type DESC, name`, tenantID(c))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	locations := []models.StockLocation{}
+	for rows.Next() {
+		var l models.StockLocation
+		if err := rows.Scan(&l.ID, &l.Name, &l.Type, &l.TechnicianID); err != nil {
+			continue
+		}
+		locations = append(locations, l)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": locations})
+}
+
+func CreateStockLocation(c *fiber.Ctx) error {
+	if _, err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	var input models.StockLocation
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+	}
+	switch input.Type {
+	case "warehouse":
+		input.TechnicianID = nil
+	case "van":
+		if input.TechnicianID == nil {
+			return fiber.NewError(fiber.StatusBadRequest, "A van needs a technician_id")
+		}
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "type must be warehouse or van")
+	}
+	if strings.TrimSpace(input.Name) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Name is required")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if input.TechnicianID != nil {
+		if err := inTenant(database, c, "users", *input.TechnicianID); err != nil {
+			return err
+		}
+	}
+
+	result, err := database.Exec(`INSERT INTO stock_locations (tenant_id, name, type, technician_id) VALUES (?, ?, ?, ?)`,
+		tenantID(c), input.Name, input.Type, input.TechnicianID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusConflict, "Location could not be created, the technician may already have a van")
+	}
+	id, _ := result.LastInsertId()
+
+	return c.JSON(fiber.Map{"success": true, "message": "Location created", "id": id})
+}
+
+const stockLevelQuery = `
+	SELECT sl.part_id, p.sku, p.name, sl.location_id, l.name, sl.quantity, p.low_stock_threshold
+	FROM stock_levels sl
+	JOIN parts p ON p.id = sl.part_id
+	JOIN stock_locations l ON l.id = sl.location_id`
+
+func scanStockLevels(rows *sql.Rows) []models.StockLevel {
+	levels := []models.StockLevel{}
+	for rows.Next() {
+		var s models.StockLevel
+		if err := rows.Scan(&s.PartID, &s.SKU, &s.PartName, &s.LocationID, &s.LocationName, &s.Quantity, &s.LowStockThreshold); err != nil {
+			continue
+		}
+		levels = append(levels, s)
+	}
+	return levels
+}
+
+// ListStock returns stock levels. Techs only see their own van.
+// Filters: ?location_id=, ?part_id=.
+func ListStock(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+
+	query := stockLevelQuery + ` WHERE l.tenant_id = ?`
+	args := []any{user.TenantID}
+	if user.Role == "tech" {
+		query += ` AND l.technician_id = ?`
+		args = append(args, user.ID)
+	}
+	if id := c.QueryInt("location_id"); id != 0 {
+		query += ` AND sl.location_id = ?`
+		args = append(args, id)
+	}
+	if id := c.QueryInt("part_id"); id != 0 {
+		query += ` AND sl.part_id = ?`
+		args = append(args, id)
+	}
+	query += ` ORDER BY l.name, p.name`
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	return c.JSON(fiber.Map{"success": true, "data": scanStockLevels(rows)})
+}
+
+// ListLowStock returns every stock level at or below the part's threshold.
+func ListLowStock(c *fiber.Ctx) error {
+	if _, err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(stockLevelQuery+` WHERE l.tenant_id = ? AND p.active = 1 AND sl.quantity <= p.low_stock_threshold ORDER BY sl.quantity`,
+		tenantID(c))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	return c.JSON(fiber.Map{"success": true, "data": scanStockLevels(rows)})
+}
+
+// moveStock takes quantity of a part out of one location and/or puts it into
+// another inside tx. Either location may be 0. It returns what is left at from.
+func moveStock(tx *sql.Tx, partID, from, to, quantity int, reason string, requestID *int, userID int) (int, error) {
+	left := 0
+	if from != 0 {
+		result, err := tx.Exec(`UPDATE stock_levels SET quantity = quantity - ? WHERE part_id = ? AND location_id = ? AND quantity >= ?`,
+			quantity, partID, from, quantity)
+		if err != nil {
+			return 0, fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return 0, fiber.NewError(fiber.StatusConflict, "Not enough stock")
+		}
+		if err := tx.QueryRow(`SELECT quantity FROM stock_levels WHERE part_id = ? AND location_id = ?`, partID, from).Scan(&left); err != nil {
+			return 0, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+		}
+	}
+	if to != 0 {
+		_, err := tx.Exec(`
+			INSERT INTO stock_levels (part_id, location_id, quantity) VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE quantity = quantity + VALUES(quantity)`, partID, to, quantity)
+		if err != nil {
+			return 0, fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+		}
+	}
+
+	var fromID, toID *int
+	if from != 0 {
+		fromID = &from
+	}
+	if to != 0 {
+		toID = &to
+	}
+	_, err := tx.Exec(`INSERT INTO stock_movements (part_id, from_location_id, to_location_id, quantity, reason, request_id, created_by) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		partID, fromID, toID, quantity, reason, requestID, userID)
+	if err != nil {
+		return 0, fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+	return left, nil
+}
+
+// alertIfLowStock publishes stock.low when a movement took the location from
+// above the part's threshold to at or below it, once per drop.
+func alertIfLowStock(database *sql.DB, partID, locationID, before, quantity int) {
+	var threshold, tenant int
+	var partName, locationName string
+	err := database.QueryRow(`
+		SELECT p.low_stock_threshold, p.name, l.name, l.tenant_id
+		FROM parts p JOIN stock_locations l ON l.id = ?
+		WHERE p.id = ?`, locationID, partID).Scan(&threshold, &partName, &locationName, &tenant)
+	if err != nil || before <= threshold || quantity > threshold {
+		return
+	}
+	PublishEvent(database, events.Event{
+		TenantID: tenant,
+		Type:     events.StockLow,
+		Data: fiber.Map{
+			"part_id":       partID,
+			"part_name":     partName,
+			"location_id":   locationID,
+			"location_name": locationName,
+			"quantity":      quantity,
+			"threshold":     threshold,
+		},
+	})
+}
+
+// checkStockTenant makes parts and locations of other tenants look missing.
+// Location ids of 0 are skipped.
+func checkStockTenant(database *sql.DB, c *fiber.Ctx, partID int, locationIDs ...int) error {
+	if err := inTenant(database, c, "parts", partID); err != nil {
+		return err
+	}
+	for _, id := range locationIDs {
+		if id == 0 {
+			continue
+		}
+		if err := inTenant(database, c, "stock_locations", id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReceiveStock books incoming parts into a location.
+func ReceiveStock(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		PartID     int `json:"part_id"`
+		LocationID int `json:"location_id"`
+		Quantity   int `json:"quantity"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Quantity <= 0 || input.PartID == 0 || input.LocationID == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "part_id, location_id and a positive quantity are required")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := checkStockTenant(database, c, input.PartID, input.LocationID); err != nil {
+		return err
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	if _, err := moveStock(tx, input.PartID, 0, input.LocationID, input.Quantity, "receive", nil, admin.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Stock received"})
+}
+
+// TransferStock moves parts between locations, e.g. warehouse to a van.
+func TransferStock(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		PartID         int `json:"part_id"`
+		FromLocationID int `json:"from_location_id"`
+		ToLocationID   int `json:"to_location_id"`
+		Quantity       int `json:"quantity"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Quantity <= 0 || input.PartID == 0 ||
+		input.FromLocationID == 0 || input.ToLocationID == 0 || input.FromLocationID == input.ToLocationID {
+		return fiber.NewError(fiber.StatusBadRequest, "part_id, two different locations and a positive quantity are required")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := checkStockTenant(database, c, input.PartID, input.FromLocationID, input.ToLocationID); err != nil {
+		return err
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	left, err := moveStock(tx, input.PartID, input.FromLocationID, input.ToLocationID, input.Quantity, "transfer", nil, admin.ID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+	alertIfLowStock(database, input.PartID, input.FromLocationID, left+input.Quantity, left)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Stock transferred"})
+}
+
+// AdjustStock sets the counted quantity of a part at a location (stocktaking).
+func AdjustStock(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		PartID     int `json:"part_id"`
+		LocationID int `json:"location_id"`
+		Quantity   int `json:"quantity"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.Quantity < 0 || input.PartID == 0 || input.LocationID == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "part_id, location_id and a non-negative quantity are required")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := checkStockTenant(database, c, input.PartID, input.LocationID); err != nil {
+		return err
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	var current int
+	err = tx.QueryRow(`SELECT quantity FROM stock_levels WHERE part_id = ? AND location_id = ? FOR UPDATE`, input.PartID, input.LocationID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	diff := input.Quantity - current
+	if diff > 0 {
+		_, err = moveStock(tx, input.PartID, 0, input.LocationID, diff, "adjust", nil, admin.ID)
+	} else if diff < 0 {
+		_, err = moveStock(tx, input.PartID, input.LocationID, 0, -diff, "adjust", nil, admin.ID)
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+	alertIfLowStock(database, input.PartID, input.LocationID, current, input.Quantity)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Stock adjusted", "difference": diff})
+}
+
+// ConsumeParts records parts used on a support request. Techs take them from
+// their van unless location_id is given. Billable parts are added to the
+// customer's draft invoice, since parts are not covered by plans.
+func ConsumeParts(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	requestID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request ID")
+	}
+
+	var input struct {
+		PartID     int   `json:"part_id"`
+		LocationID int   `json:"location_id"`
+		Quantity   int   `json:"quantity"`
+		Billable   *bool `json:"billable"` // only admins can waive billing
+	}
+	if err := c.BodyParser(&input); err != nil || input.PartID == 0 || input.Quantity <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "part_id and a positive quantity are required")
+	}
+	billable := true
+	if input.Billable != nil && user.Role == "admin" {
+		billable = *input.Billable
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var customerID int
+	var assignedTo *int
+	err = database.QueryRow(`SELECT user_id, assigned_to FROM support_requests WHERE id = ? AND tenant_id = ?`, requestID, tenantID(c)).Scan(&customerID, &assignedTo)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Request not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if user.Role == "tech" && (assignedTo == nil || *assignedTo != user.ID) {
+		return fiber.NewError(fiber.StatusForbidden, "Request is not assigned to you")
+	}
+
+	// technicians take parts from their own van, admins from any location
+	locationID := input.LocationID
+	if locationID == 0 || user.Role == "tech" {
+		techID := user.ID
+		if user.Role == "admin" && assignedTo != nil {
+			techID = *assignedTo
+		}
+		var vanID int
+		if err := database.QueryRow(`SELECT id FROM stock_locations WHERE technician_id = ?`, techID).Scan(&vanID); err != nil {
+			if user.Role == "tech" {
+				return fiber.NewError(fiber.StatusBadRequest, "No van found for you")
+			}
+			return fiber.NewError(fiber.StatusBadRequest, "No van found for the technician, pass location_id")
+		}
+		if locationID != 0 && locationID != vanID {
+			return fiber.NewError(fiber.StatusForbidden, "Technicians can only use parts from their own van")
+		}
+		locationID = vanID
+	}
+
+	if err := checkStockTenant(database, c, input.PartID, locationID); err != nil {
+		return err
+	}
+
+	var partName string
+	var unitPrice float64
+	var active bool
+	if err := database.QueryRow(`SELECT name, unit_price, active FROM parts WHERE id = ?`, input.PartID).Scan(&partName, &unitPrice, &active); err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Part not found")
+	}
+	if !active {
+		return fiber.NewError(fiber.StatusBadRequest, "Part is inactive")
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	left, err := moveStock(tx, input.PartID, locationID, 0, input.Quantity, "consume", &requestID, user.ID)
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(`INSERT INTO request_parts (request_id, part_id, location_id, quantity, unit_price, billable, created_by) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		requestID, input.PartID, locationID, input.Quantity, unitPrice, billable, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	requestPartID, _ := result.LastInsertId()
+
+	if billable && unitPrice > 0 {
+		description := fmt.Sprintf("%s (müraciət #%d)", partName, requestID)
+		if err := addInvoiceItem(tx, customerID, &requestID, int(requestPartID), description, input.Quantity, unitPrice); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Invoice update failed")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+	alertIfLowStock(database, input.PartID, locationID, left+input.Quantity, left)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Parts recorded", "id": requestPartID})
+}
+
+// ListRequestParts returns the parts used on a support request.
+func ListRequestParts(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	requestID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var ownerID int
+	var assignedTo *int
+	err = database.QueryRow(`SELECT user_id, assigned_to FROM support_requests WHERE id = ? AND tenant_id = ?`, requestID, tenantID(c)).Scan(&ownerID, &assignedTo)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Request not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if user.Role != "admin" && !canManageTicket(database, user, requestID) && (assignedTo == nil || *assignedTo != user.ID) {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+
+	rows, err := database.Query(`
+		SELECT rp.id, rp.request_id, rp.part_id, p.name, rp.location_id, rp.quantity, rp.unit_price, rp.billable, rp.created_at
+		FROM request_parts rp JOIN parts p ON p.id = rp.part_id
+		WHERE rp.request_id = ? ORDER BY rp.id`, requestID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	list := []models.RequestPart{}
+	for rows.Next() {
+		var p models.RequestPart
+		if err := rows.Scan(&p.ID, &p.RequestID, &p.PartID, &p.PartName, &p.LocationID, &p.Quantity, &p.UnitPrice, &p.Billable, &p.CreatedAt); err != nil {
+			continue
+		}
+		list = append(list, p)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": list})
+}
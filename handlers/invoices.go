@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"ithelp/db"
+	"ithelp/events"
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// addInvoiceItem appends a line to the customer's open draft invoice,
+// creating the draft if there is none, and recalculates the total.
+func addInvoiceItem(tx *sql.Tx, userID int, requestID *int, requestPartID int, description string, quantity int, unitPrice float64) error {
+	var invoiceID int64
+	err := tx.QueryRow(`SELECT id FROM invoices WHERE user_id = ? AND status = ? ORDER BY id LIMIT 1 FOR UPDATE`,
+		userID, models.InvoiceDraft).Scan(&invoiceID)
+	if err == sql.ErrNoRows {
+		result, err := tx.Exec(`INSERT INTO invoices (user_id, status) VALUES (?, ?)`, userID, models.InvoiceDraft)
+		if err != nil {
+			return err
+		}
+		invoiceID, _ = result.LastInsertId()
+	} else if err != nil {
+		return err
+	}
+
+	var partID *int
+	if requestPartID != 0 {
+		partID = &requestPartID
+	}
+	_, err = tx.Exec(`INSERT INTO invoice_items (invoice_id, request_id, request_part_id, description, quantity, unit_price, amount) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		invoiceID, requestID, partID, description, quantity, unitPrice, float64(quantity)*unitPrice)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE invoices SET total = (SELECT COALESCE(SUM(amount), 0) FROM invoice_items WHERE invoice_id = ?) WHERE id = ?`,
+		invoiceID, invoiceID)
+	return err
+}
+
+const invoiceColumns = `id, user_id, status, total, issued_at, paid_at, created_at`
+
+func scanInvoice(row interface{ Scan(...any) error }) (models.Invoice, error) {
+	var inv models.Invoice
+	err := row.Scan(&inv.ID, &inv.UserID, &inv.Status, &inv.Total, &inv.IssuedAt, &inv.PaidAt, &inv.CreatedAt)
+	return inv, err
+}
+
+// ListInvoices returns all invoices to admins (?user_id=, ?status= filters)
+// and their own non-draft invoices to customers.
+func ListInvoices(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE user_id IN (SELECT id FROM users WHERE tenant_id = ?)`
+	args := []any{user.TenantID}
+	switch user.Role {
+	case "admin":
+		if id := c.QueryInt("user_id"); id != 0 {
+			query += ` AND user_id = ?`
+			args = append(args, id)
+		}
+		if status := c.Query("status"); status != "" {
+			query += ` AND status = ?`
+			args = append(args, status)
+		}
+	case "tech":
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	default:
+		query += ` AND user_id = ? AND status <> ?`
+		args = append(args, user.ID, models.InvoiceDraft)
+	}
+	query += ` ORDER BY id DESC`
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	invoices := []models.Invoice{}
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			continue
+		}
+		invoices = append(invoices, inv)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": invoices})
+}
+
+func GetInvoice(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid invoice ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "invoices", id); err != nil {
+		return err
+	}
+
+	inv, err := scanInvoice(database.QueryRow(`SELECT `+invoiceColumns+` FROM invoices WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Invoice not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if user.Role != "admin" && (user.ID != inv.UserID || inv.Status == models.InvoiceDraft) {
+		return fiber.NewError(fiber.StatusNotFound, "Invoice not found")
+	}
+
+	rows, err := database.Query(`SELECT id, request_id, description, quantity, unit_price, amount FROM invoice_items WHERE invoice_id = ? ORDER BY id`, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	inv.Items = []models.InvoiceItem{}
+	for rows.Next() {
+		var item models.InvoiceItem
+		if err := rows.Scan(&item.ID, &item.RequestID, &item.Description, &item.Quantity, &item.UnitPrice, &item.Amount); err != nil {
+			continue
+		}
+		inv.Items = append(inv.Items, item)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": inv})
+}
+
+// setInvoiceStatus moves an invoice from one status to the next, stamping
+// column. A non-empty eventType is recorded with the change and published.
+func setInvoiceStatus(c *fiber.Ctx, from, to, column, eventType string) (models.Invoice, error) {
+	var inv models.Invoice
+	if _, err := requireAdmin(c); err != nil {
+		return inv, err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return inv, fiber.NewError(fiber.StatusBadRequest, "Invalid invoice ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return inv, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "invoices", id); err != nil {
+		return inv, err
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return inv, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE invoices SET status = ?, `+column+` = NOW() WHERE id = ? AND status = ?`, to, id, from)
+	if err != nil {
+		return inv, fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return inv, fiber.NewError(fiber.StatusConflict, "Invoice is not "+from)
+	}
+
+	inv, err = scanInvoice(tx.QueryRow(`SELECT `+invoiceColumns+` FROM invoices WHERE id = ?`, id))
+	if err != nil {
+		return inv, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	var e events.Event
+	if eventType != "" {
+		e = events.Event{
+			TenantID:  tenantID(c),
+			Type:      eventType,
+			UserID:    inv.UserID,
+			Data:      fiber.Map{"invoice_id": inv.ID, "total": inv.Total},
+			CreatedAt: time.Now(),
+		}
+		if err := recordEvent(tx, e); err != nil {
+			return inv, fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return inv, fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+	if eventType != "" {
+		events.Publish(e)
+	}
+	return inv, nil
+}
+
+// IssueInvoice closes a draft; the next billable part opens a new draft.
+func IssueInvoice(c *fiber.Ctx) error {
+	inv, err := setInvoiceStatus(c, models.InvoiceDraft, models.InvoiceIssued, "issued_at", "")
+	if err != nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Invoice issued", "data": inv})
+}
+
+func PayInvoice(c *fiber.Ctx) error {
+	inv, err := setInvoiceStatus(c, models.InvoiceIssued, models.InvoicePaid, "paid_at", events.InvoicePaid)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Invoice marked as paid", "data": inv})
+}
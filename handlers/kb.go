@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"ithelp/db"
+	"ithelp/models"
+	"ithelp/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxSuggestions = 5
+
+// articleColumns selects an article; list endpoints pass withBody false to
+// leave the markdown out.
+func articleColumns(withBody bool) string {
+	body := `''`
+	if withBody {
+		body = `a.body`
+	}
+	return `a.id, a.category, a.title, ` + body + `, a.status, a.author_id, a.view_count,
+		a.helpful_count, a.not_helpful_count, a.published_at, a.created_at, a.updated_at`
+}
+
+func scanArticle(row interface{ Scan(...any) error }) (models.Article, error) {
+	var a models.Article
+	err := row.Scan(&a.ID, &a.Category, &a.Title, &a.Body, &a.Status, &a.AuthorID, &a.ViewCount,
+		&a.HelpfulCount, &a.NotHelpfulCount, &a.PublishedAt, &a.CreatedAt, &a.UpdatedAt)
+	return a, err
+}
+
+func isStaff(user models.User) bool {
+	return user.Role == "admin" || user.Role == "tech"
+}
+
+// loadVisibleArticle returns an article of the caller's tenant. Customers
+// only see published articles.
+func loadVisibleArticle(database *sql.DB, user models.User, id int) (models.Article, error) {
+	a, err := scanArticle(database.QueryRow(`SELECT `+articleColumns(true)+` FROM kb_articles a WHERE a.id = ? AND a.tenant_id = ?`,
+		id, user.TenantID))
+	if err == sql.ErrNoRows || (err == nil && a.Status != models.ArticlePublished && !isStaff(user)) {
+		return a, fiber.NewError(fiber.StatusNotFound, "Article not found")
+	}
+	if err != nil {
+		return a, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	return a, nil
+}
+
+// ListArticles searches the knowledge base. ?q= is a full-text search over
+// title and body, ?category= filters. Staff also see drafts (?status=).
+func ListArticles(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	query := `SELECT ` + articleColumns(false) + ` FROM kb_articles a WHERE a.tenant_id = ?`
+	args := []any{user.TenantID}
+	if !isStaff(user) {
+		query += ` AND a.status = ?`
+		args = append(args, models.ArticlePublished)
+	} else if status := c.Query("status"); status != "" {
+		query += ` AND a.status = ?`
+		args = append(args, status)
+	}
+	if category := c.Query("category"); category != "" {
+		query += ` AND a.category = ?`
+		args = append(args, category)
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		query += ` AND MATCH(a.title, a.body) AGAINST (? IN NATURAL LANGUAGE MODE)
+			ORDER BY MATCH(a.title, a.body) AGAINST (? IN NATURAL LANGUAGE MODE) DESC`
+		args = append(args, q, q)
+	} else {
+		query += ` ORDER BY a.category, a.title`
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	articles := []models.Article{}
+	for rows.Next() {
+		a, err := scanArticle(rows)
+		if err != nil {
+			continue
+		}
+		articles = append(articles, a)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": articles})
+}
+
+// GetArticle returns an article with its body rendered to HTML and counts the
+// view. Clients opening it from a suggestion pass ?suggestion_id= so the
+// deflection report knows the suggestion was followed.
+func GetArticle(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid article ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	a, err := loadVisibleArticle(database, user, id)
+	if err != nil {
+		return err
+	}
+	if a.HTML, err = utils.RenderMarkdown(a.Body); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Rendering failed")
+	}
+
+	if a.Status == models.ArticlePublished {
+		database.Exec(`UPDATE kb_articles SET view_count = view_count + 1 WHERE id = ?`, id)
+	}
+	if suggestionID := c.QueryInt("suggestion_id"); suggestionID != 0 {
+		database.Exec(`UPDATE kb_suggestions SET opened_article_id = ? WHERE id = ? AND user_id = ? AND opened_article_id IS NULL`,
+			id, suggestionID, user.ID)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": a})
+}
+
+type articleInput struct {
+	Category string `json:"category"`
+	Title    string `json:"title"`
+	Body     string `json:"body"`
+}
+
+func (in *articleInput) validate() error {
+	in.Category = strings.TrimSpace(in.Category)
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Category == "" || in.Title == "" || strings.TrimSpace(in.Body) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Category, title and body are required")
+	}
+	return nil
+}
+
+// CreateArticle stores a draft. Admins and technicians write articles,
+// admins publish them.
+func CreateArticle(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+
+	var input articleInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	if err := input.validate(); err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	result, err := database.Exec(`INSERT INTO kb_articles (tenant_id, category, title, body, author_id) VALUES (?, ?, ?, ?, ?)`,
+		user.TenantID, input.Category, input.Title, input.Body, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	id, _ := result.LastInsertId()
+
+	return c.JSON(fiber.Map{"success": true, "message": "Article created", "id": id})
+}
+
+func UpdateArticle(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid article ID")
+	}
+
+	var input articleInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	if err := input.validate(); err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	result, err := database.Exec(`UPDATE kb_articles SET category = ?, title = ?, body = ? WHERE id = ? AND tenant_id = ?`,
+		input.Category, input.Title, input.Body, id, user.TenantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := loadVisibleArticle(database, user, id); err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Article updated"})
+}
+
+func setArticleStatus(c *fiber.Ctx, status string) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid article ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if _, err := loadVisibleArticle(database, admin, id); err != nil {
+		return err
+	}
+	// published_at keeps the first publication date across unpublish/publish
+	_, err = database.Exec(`
+		UPDATE kb_articles SET status = ?, published_at = IF(? = 'published', COALESCE(published_at, NOW()), published_at)
+		WHERE id = ?`, status, status, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Article " + status})
+}
+
+func PublishArticle(c *fiber.Ctx) error {
+	return setArticleStatus(c, models.ArticlePublished)
+}
+
+// UnpublishArticle moves an article back to draft.
+func UnpublishArticle(c *fiber.Ctx) error {
+	return setArticleStatus(c, models.ArticleDraft)
+}
+
+func DeleteArticle(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid article ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	result, err := database.Exec(`DELETE FROM kb_articles WHERE id = ? AND tenant_id = ?`, id, admin.TenantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Article not found")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Article deleted"})
+}
+
+// ArticleFeedback records a "was this helpful?" vote.
+func ArticleFeedback(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid article ID")
+	}
+
+	var input struct {
+		Helpful bool `json:"helpful"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+
+	column := "not_helpful_count"
+	if input.Helpful {
+		column = "helpful_count"
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	result, err := database.Exec(`UPDATE kb_articles SET `+column+` = `+column+` + 1 WHERE id = ? AND tenant_id = ? AND status = ?`,
+		id, user.TenantID, models.ArticlePublished)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Article not found")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Thanks for the feedback"})
+}
+
+// SuggestArticles is called by ticket forms with the draft ?title= (and
+// ?category=) before the ticket is submitted. Published articles matching
+// the title are returned, those of the same category first. When there is a
+// match the returned suggestion_id should be passed to GetArticle,
+// ResolveSuggestion or CreateSupportRequest so deflection can be measured.
+func SuggestArticles(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	title := strings.TrimSpace(c.Query("title"))
+	category := strings.TrimSpace(c.Query("category"))
+	articles := []models.Article{}
+	if len([]rune(title)) < 3 {
+		return c.JSON(fiber.Map{"success": true, "data": articles})
+	}
+	if len(title) > 255 {
+		title = title[:255]
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`
+		SELECT `+articleColumns(false)+`
+		FROM kb_articles a
+		WHERE a.tenant_id = ? AND a.status = ? AND MATCH(a.title, a.body) AGAINST (? IN NATURAL LANGUAGE MODE)
+		ORDER BY a.category = ? DESC, MATCH(a.title, a.body) AGAINST (? IN NATURAL LANGUAGE MODE) DESC
+		LIMIT ?`,
+		user.TenantID, models.ArticlePublished, title, category, title, maxSuggestions)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	var ids []string
+	for rows.Next() {
+		a, err := scanArticle(rows)
+		if err != nil {
+			continue
+		}
+		articles = append(articles, a)
+		ids = append(ids, strconv.Itoa(a.ID))
+	}
+	rows.Close()
+
+	if len(articles) == 0 {
+		return c.JSON(fiber.Map{"success": true, "data": articles})
+	}
+
+	var cat *string
+	if category != "" {
+		cat = &category
+	}
+	result, err := database.Exec(`INSERT INTO kb_suggestions (tenant_id, user_id, query, category, article_ids) VALUES (?, ?, ?, ?, ?)`,
+		user.TenantID, user.ID, title, cat, strings.Join(ids, ","))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	suggestionID, _ := result.LastInsertId()
+
+	return c.JSON(fiber.Map{"success": true, "data": articles, "suggestion_id": suggestionID})
+}
+
+// ResolveSuggestion is sent when the customer says an article solved the
+// problem and leaves the ticket form.
+func ResolveSuggestion(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid suggestion ID")
+	}
+
+	var input struct {
+		ArticleID *int `json:"article_id"`
+	}
+	c.BodyParser(&input)
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var exists bool
+	database.QueryRow(`SELECT EXISTS(SELECT 1 FROM kb_suggestions WHERE id = ? AND user_id = ?)`, id, user.ID).Scan(&exists)
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Suggestion not found")
+	}
+
+	_, err = database.Exec(`UPDATE kb_suggestions SET resolved = 1, opened_article_id = COALESCE(opened_article_id, ?) WHERE id = ?`,
+		input.ArticleID, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Glad it helped"})
+}
+
+// linkSuggestionToTicket marks a suggestion as not deflected because the
+// customer filed the ticket anyway.
+func linkSuggestionToTicket(database *sql.DB, suggestionID, userID int, requestID int64) {
+	database.Exec(`UPDATE kb_suggestions SET request_id = ? WHERE id = ? AND user_id = ?`, requestID, suggestionID, userID)
+}
+
+// DeflectionReport shows how often suggestions kept customers from filing a
+// ticket, overall and per opened article. ?from= and ?to= are YYYY-MM-DD.
+func DeflectionReport(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	where := `WHERE s.tenant_id = ?`
+	args := []any{admin.TenantID}
+	if from, err := time.ParseInLocation("2006-01-02", c.Query("from"), utils.BusinessLocation()); err == nil {
+		where += ` AND s.created_at >= ?`
+		args = append(args, from)
+	}
+	if to, err := time.ParseInLocation("2006-01-02", c.Query("to"), utils.BusinessLocation()); err == nil {
+		where += ` AND s.created_at < ?`
+		args = append(args, to.AddDate(0, 0, 1))
+	}
+	const deflected = `(s.request_id IS NULL AND (s.resolved = 1 OR s.opened_article_id IS NOT NULL))`
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var total models.DeflectionStats
+	err = database.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(s.opened_article_id IS NOT NULL), 0), COALESCE(SUM(s.resolved), 0),
+			COALESCE(SUM(s.request_id IS NOT NULL), 0), COALESCE(SUM(`+deflected+`), 0)
+		FROM kb_suggestions s `+where, args...).
+		Scan(&total.Suggestions, &total.Opened, &total.Resolved, &total.TicketsFiled, &total.Deflected)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	if total.Suggestions > 0 {
+		total.DeflectionPct = float64(total.Deflected) * 100 / float64(total.Suggestions)
+	}
+
+	rows, err := database.Query(`
+		SELECT a.id, a.title, COUNT(*), COALESCE(SUM(s.resolved), 0), COALESCE(SUM(s.request_id IS NOT NULL), 0),
+			COALESCE(SUM(`+deflected+`), 0)
+		FROM kb_suggestions s JOIN kb_articles a ON a.id = s.opened_article_id
+		`+where+`
+		GROUP BY a.id, a.title ORDER BY COUNT(*) DESC`, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	byArticle := []fiber.Map{}
+	for rows.Next() {
+		var id, opened, resolved, filed, deflectedCount int
+		var title string
+		if err := rows.Scan(&id, &title, &opened, &resolved, &filed, &deflectedCount); err != nil {
+			continue
+		}
+		byArticle = append(byArticle, fiber.Map{
+			"article_id": id, "title": title, "opened": opened, "resolved": resolved,
+			"tickets_filed": filed, "deflected": deflectedCount,
+		})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": fiber.Map{"total": total, "by_article": byArticle}})
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"ithelp/db"
+	"ithelp/events"
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type macroInput struct {
+	Name    string               `json:"name"`
+	Actions []models.MacroAction `json:"actions"`
+	Shared  bool                 `json:"shared"`
+}
+
+func (in *macroInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "name is required")
+	}
+	if len(in.Actions) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "A macro needs at least one action")
+	}
+	for i, a := range in.Actions {
+		var ok bool
+		switch a.Type {
+		case models.MacroSetStatus:
+			ok = strings.TrimSpace(a.Status) != ""
+		case models.MacroReply, models.MacroNote:
+			ok = strings.TrimSpace(a.Body) != ""
+		case models.MacroAssign:
+			ok = a.TechnicianID != 0
+		default:
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Action %d: unknown type %q", i+1, a.Type))
+		}
+		if !ok {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Action %d (%s) is incomplete", i+1, a.Type))
+		}
+	}
+	return nil
+}
+
+// macroActionAllowed checks one action against the caller's role. Admins may
+// do anything; the assigned technician may change status and write replies
+// and notes, but only admins reassign.
+func macroActionAllowed(user models.User, assignedTo *int, action models.MacroAction) bool {
+	if user.Role == "admin" {
+		return true
+	}
+	if action.Type == models.MacroAssign {
+		return false
+	}
+	return user.Role == "tech" && assignedTo != nil && *assignedTo == user.ID
+}
+
+func loadMacro(database *sql.DB, id int) (models.Macro, error) {
+	var m models.Macro
+	var actions []byte
+	err := database.QueryRow(`SELECT id, owner_id, name, actions, created_at, updated_at FROM macros WHERE id = ?`, id).
+		Scan(&m.ID, &m.OwnerID, &m.Name, &actions, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return m, err
+	}
+	m.Shared = m.OwnerID == nil
+	json.Unmarshal(actions, &m.Actions)
+	return m, nil
+}
+
+// ListMacros returns the shared macros and the caller's own.
+func ListMacros(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`
+		SELECT id, owner_id, name, actions, created_at, updated_at FROM macros
+		WHERE tenant_id = ? AND (owner_id IS NULL OR owner_id = ?)
+		ORDER BY owner_id IS NOT NULL, name`, user.TenantID, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	list := []models.Macro{}
+	for rows.Next() {
+		var m models.Macro
+		var actions []byte
+		if err := rows.Scan(&m.ID, &m.OwnerID, &m.Name, &actions, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			continue
+		}
+		m.Shared = m.OwnerID == nil
+		json.Unmarshal(actions, &m.Actions)
+		list = append(list, m)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": list})
+}
+
+func CreateMacro(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+
+	var input macroInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	if err := input.validate(); err != nil {
+		return err
+	}
+	owner, err := templateOwner(user, input.Shared)
+	if err != nil {
+		return err
+	}
+	actions, _ := json.Marshal(input.Actions)
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	result, err := database.Exec(`INSERT INTO macros (tenant_id, owner_id, name, actions) VALUES (?, ?, ?, ?)`,
+		user.TenantID, owner, input.Name, actions)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	id, _ := result.LastInsertId()
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "message": "Macro created", "id": id})
+}
+
+// UpdateMacro replaces name and actions. Shared stays as it was.
+func UpdateMacro(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid ID")
+	}
+
+	var input macroInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	if err := input.validate(); err != nil {
+		return err
+	}
+	actions, _ := json.Marshal(input.Actions)
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := checkTemplateAccess(database, user, "macros", id, true); err != nil {
+		return err
+	}
+	if _, err := database.Exec(`UPDATE macros SET name = ?, actions = ? WHERE id = ?`, input.Name, actions, id); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Macro updated"})
+}
+
+func DeleteMacro(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := checkTemplateAccess(database, user, "macros", id, true); err != nil {
+		return err
+	}
+	if _, err := database.Exec(`DELETE FROM macros WHERE id = ?`, id); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Macro deleted"})
+}
+
+// ApplyMacro runs every action of a macro on a support request. All actions
+// are checked first and written in one transaction, so a macro applies
+// completely or not at all.
+func ApplyMacro(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid ID")
+	}
+
+	var input struct {
+		RequestID int `json:"request_id"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.RequestID == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "request_id is required")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := checkTemplateAccess(database, user, "macros", id, false); err != nil {
+		return err
+	}
+	macro, err := loadMacro(database, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	_, assignedTo, err := ticketAccess(database, c, user, input.RequestID)
+	if err != nil {
+		return err
+	}
+
+	var status string
+	database.QueryRow(`SELECT status FROM support_requests WHERE id = ?`, input.RequestID).Scan(&status)
+
+	for i, a := range macro.Actions {
+		if !macroActionAllowed(user, assignedTo, a) {
+			return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("Action %d (%s) is not permitted", i+1, a.Type))
+		}
+		switch a.Type {
+		case models.MacroAssign:
+			if err := checkTechnicianAssignable(database, a.TechnicianID, input.RequestID); err != nil {
+				return err
+			}
+		case models.MacroReply, models.MacroNote:
+			body, err := renderPlaceholders(database, input.RequestID, a.Body)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+			}
+			macro.Actions[i].Body = body
+		}
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	var pending []pendingEvent
+	for _, a := range macro.Actions {
+		switch a.Type {
+		case models.MacroSetStatus:
+			if a.Status == status {
+				continue
+			}
+			if _, err := tx.Exec(`UPDATE support_requests SET status = ? WHERE id = ?`, a.Status, input.RequestID); err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+			}
+			recordStatusChange(tx, input.RequestID, user.ID, status, a.Status)
+			pending = append(pending,
+				pendingEvent{events.TicketUpdated, input.RequestID, fiber.Map{"status": a.Status}},
+				pendingEvent{events.TicketStatusChanged, input.RequestID, fiber.Map{"old_status": status, "status": a.Status}})
+			status = a.Status
+		case models.MacroReply, models.MacroNote:
+			internal := a.Type == models.MacroNote
+			if _, err := tx.Exec(`INSERT INTO tech_notes (tenant_id, request_id, technician_id, note, internal) VALUES (?, ?, ?, ?, ?)`,
+				user.TenantID, input.RequestID, user.ID, a.Body, internal); err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+			}
+			pending = append(pending, pendingEvent{events.NoteAdded, input.RequestID, fiber.Map{"technician_id": user.ID, "note": a.Body, "internal": internal}})
+		case models.MacroAssign:
+			if assignedTo != nil && *assignedTo == a.TechnicianID {
+				continue
+			}
+			if _, err := tx.Exec(`UPDATE support_requests SET assigned_to = ? WHERE id = ?`, a.TechnicianID, input.RequestID); err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+			}
+			techID := a.TechnicianID
+			assignedTo = &techID
+			pending = append(pending, pendingEvent{events.TicketAssigned, input.RequestID, fiber.Map{"assigned_to": techID}})
+		}
+	}
+	recordHistory(tx, input.RequestID, user.ID, "macro", nil, nil, macro.Name)
+
+	recorded, err := recordTicketEvents(tx, pending)
+	if err != nil {
+		log.Printf("macros: recording events of request %d failed: %v", input.RequestID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+	for _, e := range recorded {
+		events.Publish(e)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": fmt.Sprintf("Macro %q applied", macro.Name)})
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"strconv"
+
+	"ithelp/db"
+	"ithelp/models"
+	"ithelp/notifications"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// pagination reads ?page= and ?limit= with sane bounds.
+func pagination(c *fiber.Ctx) (page, limit, offset int) {
+	page = c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit = c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	return page, limit, (page - 1) * limit
+}
+
+// ListNotifications returns the caller's notifications, newest first.
+// ?unread=true limits the list to unread ones.
+func ListNotifications(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	page, limit, offset := pagination(c)
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	where := `WHERE user_id = ?`
+	if c.QueryBool("unread") {
+		where += ` AND read_at IS NULL`
+	}
+
+	var total, unread int
+	if err := database.QueryRow(`SELECT COUNT(*) FROM notifications `+where, user.ID).Scan(&total); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	if err := database.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL`, user.ID).Scan(&unread); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+
+	rows, err := database.Query(`
+		SELECT id, user_id, type, title, body, request_id, read_at, created_at
+		FROM notifications `+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?`, user.ID, limit, offset)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	list := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Title, &n.Body, &n.RequestID, &n.ReadAt, &n.CreatedAt); err != nil {
+			continue
+		}
+		list = append(list, n)
+	}
+
+	return c.JSON(fiber.Map{
+		"success":      true,
+		"data":         list,
+		"unread_count": unread,
+		"page":         page,
+		"limit":        limit,
+		"total":        total,
+	})
+}
+
+func UnreadNotificationCount(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var unread int
+	if err := database.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL`, user.ID).Scan(&unread); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "unread_count": unread})
+}
+
+func MarkNotificationRead(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid notification ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var exists bool
+	database.QueryRow(`SELECT EXISTS(SELECT 1 FROM notifications WHERE id = ? AND user_id = ?)`, id, user.ID).Scan(&exists)
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Notification not found")
+	}
+
+	if _, err := database.Exec(`UPDATE notifications SET read_at = NOW() WHERE id = ? AND user_id = ? AND read_at IS NULL`, id, user.ID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Notification marked as read"})
+}
+
+func MarkAllNotificationsRead(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	result, err := database.Exec(`UPDATE notifications SET read_at = NOW() WHERE user_id = ? AND read_at IS NULL`, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+	updated, _ := result.RowsAffected()
+
+	return c.JSON(fiber.Map{"success": true, "message": "All notifications marked as read", "updated": updated})
+}
+
+// GetNotificationPreferences lists one entry per event type, stored or default.
+func GetNotificationPreferences(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	prefs := []models.NotificationPreference{}
+	for _, t := range notifications.EventTypes {
+		p, err := notifications.Preference(database, user.ID, t)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+		}
+		prefs = append(prefs, p)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": prefs})
+}
+
+// UpdateNotificationPreferences stores the given preferences; event types not
+// in the body are left as they are.
+func UpdateNotificationPreferences(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	var input []models.NotificationPreference
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+	}
+	for _, p := range input {
+		if !notifications.IsEventType(p.EventType) {
+			return fiber.NewError(fiber.StatusBadRequest, "Unknown event type: "+p.EventType)
+		}
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	for _, p := range input {
+		_, err := database.Exec(`
+			INSERT INTO notification_preferences (user_id, event_type, in_app, email, sms)
+			VALUES (?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE in_app = VALUES(in_app), email = VALUES(email), sms = VALUES(sms)`,
+			user.ID, p.EventType, p.InApp, p.Email, p.SMS)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+		}
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Preferences updated"})
+}
@@ -0,0 +1,754 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"ithelp/audit"
+	"ithelp/db"
+	"ithelp/models"
+	"ithelp/tenants"
+	"ithelp/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+// orgMembership returns the organization and org role of a user, or 0 when
+// the user is not a member of any organization.
+func orgMembership(database *sql.DB, userID int) (int, string, error) {
+	var orgID int
+	var role string
+	err := database.QueryRow(`SELECT organization_id, role FROM organization_members WHERE user_id = ?`, userID).Scan(&orgID, &role)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	return orgID, role, err
+}
+
+// canManageCustomer reports whether the user may act for a customer, e.g. on
+// their assets: the customer themselves, or an org admin of their
+// organization. Tickets go through canManageTicket.
+func canManageCustomer(database *sql.DB, user models.User, customerID int) bool {
+	if user.ID == customerID {
+		return true
+	}
+	var ok bool
+	database.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM organization_members a
+			JOIN organization_members m ON m.organization_id = a.organization_id
+			WHERE a.user_id = ? AND a.role = ? AND m.user_id = ?)`,
+		user.ID, models.OrgRoleAdmin, customerID).Scan(&ok)
+	return ok
+}
+
+// canManageTicket reports whether the user may act on a ticket as its
+// customer: the owner, or an org admin of the organization it was filed for.
+// Personal tickets of members stay with the member.
+func canManageTicket(database *sql.DB, user models.User, requestID int) bool {
+	var ok bool
+	database.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM support_requests s
+			WHERE s.id = ? AND (s.user_id = ? OR EXISTS(
+				SELECT 1 FROM organization_members a
+				WHERE a.user_id = ? AND a.role = ? AND a.organization_id = s.organization_id)))`,
+		requestID, user.ID, user.ID, models.OrgRoleAdmin).Scan(&ok)
+	return ok
+}
+
+// requireOrgAccess lets admins and members of the organization through.
+// With orgAdmin only admins and org admins pass.
+func requireOrgAccess(c *fiber.Ctx, database *sql.DB, orgAdmin bool) (models.User, int, error) {
+	user, ok := currentUser(c)
+	if !ok {
+		return user, 0, fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	orgID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return user, 0, fiber.NewError(fiber.StatusBadRequest, "Invalid organization ID")
+	}
+
+	var exists bool
+	database.QueryRow(`SELECT EXISTS(SELECT 1 FROM organizations WHERE id = ? AND tenant_id = ?)`, orgID, user.TenantID).Scan(&exists)
+	if !exists {
+		return user, orgID, fiber.NewError(fiber.StatusNotFound, "Organization not found")
+	}
+	if user.Role == "admin" {
+		return user, orgID, nil
+	}
+
+	memberOf, role, err := orgMembership(database, user.ID)
+	if err != nil {
+		return user, orgID, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if memberOf != orgID {
+		return user, orgID, fiber.NewError(fiber.StatusNotFound, "Organization not found")
+	}
+	if orgAdmin && role != models.OrgRoleAdmin {
+		return user, orgID, fiber.NewError(fiber.StatusForbidden, "Only organization admins can do this")
+	}
+	return user, orgID, nil
+}
+
+const orgColumns = `o.id, o.name, o.subscription_plan, o.subscription_start, o.subscription_end,
+	(SELECT COUNT(*) FROM organization_members m WHERE m.organization_id = o.id), o.created_at`
+
+func scanOrganization(row interface{ Scan(...any) error }) (models.Organization, error) {
+	var o models.Organization
+	err := row.Scan(&o.ID, &o.Name, &o.SubscriptionPlan, &o.SubscriptionStart, &o.SubscriptionEnd, &o.MemberCount, &o.CreatedAt)
+	return o, err
+}
+
+func validOrgRole(role string) bool {
+	return role == models.OrgRoleAdmin || role == models.OrgRoleEmployee
+}
+
+// CreateOrganization lets a customer create their company and become its
+// org admin. Admins may create one for a customer via owner_id.
+func CreateOrganization(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	var input struct {
+		Name    string `json:"name"`
+		OwnerID int    `json:"owner_id"`
+	}
+	if err := c.BodyParser(&input); err != nil || strings.TrimSpace(input.Name) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Organization name is required")
+	}
+
+	ownerID := 0
+	switch user.Role {
+	case "admin":
+		ownerID = input.OwnerID
+	case "user":
+		ownerID = user.ID
+	default:
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if ownerID != 0 {
+		if err := inTenant(database, c, "users", ownerID); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Owner not found")
+		}
+		orgID, _, err := orgMembership(database, ownerID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+		}
+		if orgID != 0 {
+			return fiber.NewError(fiber.StatusConflict, "User already belongs to an organization")
+		}
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO organizations (tenant_id, name) VALUES (?, ?)`, user.TenantID, strings.TrimSpace(input.Name))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert error")
+	}
+	id, _ := result.LastInsertId()
+
+	if ownerID != 0 {
+		if _, err := tx.Exec(`INSERT INTO organization_members (organization_id, user_id, role) VALUES (?, ?, ?)`,
+			id, ownerID, models.OrgRoleAdmin); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Owner could not be added")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert error")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Organization created", "id": id})
+}
+
+func ListOrganizations(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`SELECT `+orgColumns+` FROM organizations o WHERE o.tenant_id = ? ORDER BY o.name`, admin.TenantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	orgs := []models.Organization{}
+	for rows.Next() {
+		o, err := scanOrganization(rows)
+		if err != nil {
+			continue
+		}
+		orgs = append(orgs, o)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": orgs})
+}
+
+func organizationResponse(c *fiber.Ctx, database *sql.DB, orgID int, role string) error {
+	o, err := scanOrganization(database.QueryRow(`SELECT `+orgColumns+` FROM organizations o WHERE o.id = ?`, orgID))
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Organization not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	usage, err := loadOrgPlanUsage(database, orgID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": fiber.Map{"organization": o, "role": role, "usage": usage}})
+}
+
+// GetMyOrganization returns the caller's organization, their role and the shared quota.
+func GetMyOrganization(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	orgID, role, err := orgMembership(database, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if orgID == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "You are not a member of an organization")
+	}
+
+	return organizationResponse(c, database, orgID, role)
+}
+
+func GetOrganization(c *fiber.Ctx) error {
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	user, orgID, err := requireOrgAccess(c, database, false)
+	if err != nil {
+		return err
+	}
+	_, role, _ := orgMembership(database, user.ID)
+
+	return organizationResponse(c, database, orgID, role)
+}
+
+func UpdateOrganization(c *fiber.Ctx) error {
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	_, orgID, err := requireOrgAccess(c, database, true)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&input); err != nil || strings.TrimSpace(input.Name) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Organization name is required")
+	}
+
+	if _, err := database.Exec(`UPDATE organizations SET name = ? WHERE id = ?`, strings.TrimSpace(input.Name), orgID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Organization updated"})
+}
+
+// SetOrganizationSubscription is admin only. Dates are YYYY-MM-DD.
+func SetOrganizationSubscription(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	_, orgID, err := requireOrgAccess(c, database, true)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		SubscriptionPlan  string `json:"subscription_plan"`
+		SubscriptionStart string `json:"subscription_start"`
+		SubscriptionEnd   string `json:"subscription_end"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	start, err1 := time.Parse("2006-01-02", input.SubscriptionStart)
+	end, err2 := time.Parse("2006-01-02", input.SubscriptionEnd)
+	if err1 != nil || err2 != nil || end.Before(start) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription period")
+	}
+
+	var planExists bool
+	database.QueryRow(`SELECT EXISTS(SELECT 1 FROM plans WHERE name = ? AND tenant_id = ?)`, input.SubscriptionPlan, tenantID(c)).Scan(&planExists)
+	if !planExists {
+		return fiber.NewError(fiber.StatusBadRequest, "Unknown plan")
+	}
+
+	var oldPlan sql.NullString
+	var wasActive bool
+	database.QueryRow(`SELECT subscription_plan, COALESCE(subscription_end >= NOW() AND subscription_expired_at IS NULL, 0) FROM organizations WHERE id = ?`,
+		orgID).Scan(&oldPlan, &wasActive)
+
+	// the period ends at the end of the last day
+	end = end.Add(24*time.Hour - time.Second)
+	_, err = database.Exec(`
+		UPDATE organizations SET subscription_plan = ?, subscription_start = ?, subscription_end = ?, subscription_expired_at = NULL
+		WHERE id = ?`,
+		input.SubscriptionPlan, start, end, orgID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+	err = recordSubscriptionChange(database, subscriptionChange{
+		tenant: tenantID(c), orgID: &orgID, fromPlan: oldPlan.String, wasActive: wasActive, toPlan: input.SubscriptionPlan,
+		start: &start, end: &end, actorID: &admin.ID,
+	})
+	if err != nil {
+		log.Printf("subscriptions: recording change of organization %d failed: %v", orgID, err)
+	}
+
+	entry := audit.FromRequest(c, "organization.subscription", "organizations", orgID)
+	entry.Before = fiber.Map{"subscription_plan": nullIfEmpty(oldPlan.String), "active": wasActive}
+	entry.After = fiber.Map{"subscription_plan": input.SubscriptionPlan, "subscription_start": start, "subscription_end": end}
+	audit.Log(c, database, entry)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Subscription updated"})
+}
+
+func ListOrganizationMembers(c *fiber.Ctx) error {
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	_, orgID, err := requireOrgAccess(c, database, false)
+	if err != nil {
+		return err
+	}
+
+	rows, err := database.Query(`
+		SELECT u.id, u.name, u.phone, COALESCE(u.email, ''), m.role, m.joined_at
+		FROM organization_members m JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = ? ORDER BY m.role DESC, u.name`, orgID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	members := []models.OrganizationMember{}
+	for rows.Next() {
+		var m models.OrganizationMember
+		if err := rows.Scan(&m.UserID, &m.Name, &m.Phone, &m.Email, &m.Role, &m.JoinedAt); err != nil {
+			continue
+		}
+		members = append(members, m)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": members})
+}
+
+// countOrgAdmins is used to keep at least one org admin in an organization.
+func countOrgAdmins(database *sql.DB, orgID int) int {
+	var n int
+	database.QueryRow(`SELECT COUNT(*) FROM organization_members WHERE organization_id = ? AND role = ?`, orgID, models.OrgRoleAdmin).Scan(&n)
+	return n
+}
+
+func UpdateOrganizationMember(c *fiber.Ctx) error {
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	_, orgID, err := requireOrgAccess(c, database, true)
+	if err != nil {
+		return err
+	}
+	memberID, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidUserID)
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&input); err != nil || !validOrgRole(input.Role) {
+		return fiber.NewError(fiber.StatusBadRequest, "role must be org_admin or employee")
+	}
+
+	memberOf, role, err := orgMembership(database, memberID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if memberOf != orgID {
+		return fiber.NewError(fiber.StatusNotFound, "Member not found")
+	}
+	if role == models.OrgRoleAdmin && input.Role != models.OrgRoleAdmin && countOrgAdmins(database, orgID) <= 1 {
+		return fiber.NewError(fiber.StatusConflict, "An organization needs at least one org admin")
+	}
+
+	if _, err := database.Exec(`UPDATE organization_members SET role = ? WHERE organization_id = ? AND user_id = ?`, input.Role, orgID, memberID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	entry := audit.FromRequest(c, "organization.member_role", "organization_members", memberID)
+	entry.Before = fiber.Map{"organization_id": orgID, "role": role}
+	entry.After = fiber.Map{"organization_id": orgID, "role": input.Role}
+	audit.Log(c, database, entry)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Member updated"})
+}
+
+// RemoveOrganizationMember is for org admins; any member may remove themselves.
+// Their past tickets stay counted against the organization's quota.
+func RemoveOrganizationMember(c *fiber.Ctx) error {
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	user, orgID, err := requireOrgAccess(c, database, false)
+	if err != nil {
+		return err
+	}
+	memberID, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidUserID)
+	}
+	if memberID != user.ID && user.Role != "admin" {
+		if _, role, _ := orgMembership(database, user.ID); role != models.OrgRoleAdmin {
+			return fiber.NewError(fiber.StatusForbidden, "Only organization admins can do this")
+		}
+	}
+
+	memberOf, role, err := orgMembership(database, memberID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if memberOf != orgID {
+		return fiber.NewError(fiber.StatusNotFound, "Member not found")
+	}
+	if role == models.OrgRoleAdmin && countOrgAdmins(database, orgID) <= 1 {
+		return fiber.NewError(fiber.StatusConflict, "An organization needs at least one org admin")
+	}
+
+	if _, err := database.Exec(`DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?`, orgID, memberID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Member removed"})
+}
+
+// InviteOrganizationMember sends an invitation token by SMS and/or email.
+// The invitee accepts it after logging in with the same phone or email.
+func InviteOrganizationMember(c *fiber.Ctx) error {
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	user, orgID, err := requireOrgAccess(c, database, true)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Phone string `json:"phone"`
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	input.Phone = strings.TrimSpace(input.Phone)
+	input.Email = strings.TrimSpace(input.Email)
+	if input.Phone == "" && input.Email == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Phone or email is required")
+	}
+	if input.Role == "" {
+		input.Role = models.OrgRoleEmployee
+	}
+	if !validOrgRole(input.Role) {
+		return fiber.NewError(fiber.StatusBadRequest, "role must be org_admin or employee")
+	}
+
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Token generation failed")
+	}
+	token := hex.EncodeToString(buf)
+
+	var phone, email *string
+	if input.Phone != "" {
+		phone = &input.Phone
+	}
+	if input.Email != "" {
+		email = &input.Email
+	}
+	result, err := database.Exec(`
+		INSERT INTO organization_invitations (organization_id, phone, email, role, token, invited_by, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		orgID, phone, email, input.Role, token, user.ID, time.Now().Add(invitationTTL))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert error")
+	}
+	id, _ := result.LastInsertId()
+
+	var orgName string
+	database.QueryRow(`SELECT name FROM organizations WHERE id = ?`, orgID).Scan(&orgName)
+	message := fmt.Sprintf("Siz %s təşkilatına dəvət olundunuz. Dəvət kodu: %s", orgName, token)
+	if phone != nil {
+		if err := utils.SendSMS(*phone, message); err != nil {
+			log.Printf("organizations: invitation sms failed: %v", err)
+		}
+	}
+	if email != nil {
+		subject, body := "Təşkilata dəvət", message
+		if tenant, ok := c.Locals("tenant").(models.Tenant); ok {
+			subject, body = tenants.BrandEmail(tenant, subject, body)
+		}
+		if err := utils.SendEmail(*email, subject, body); err != nil {
+			log.Printf("organizations: invitation email failed: %v", err)
+		}
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Invitation sent", "id": id})
+}
+
+func ListOrganizationInvitations(c *fiber.Ctx) error {
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	_, orgID, err := requireOrgAccess(c, database, true)
+	if err != nil {
+		return err
+	}
+
+	rows, err := database.Query(`
+		SELECT id, phone, email, role, expires_at, accepted_at, created_at
+		FROM organization_invitations WHERE organization_id = ? ORDER BY id DESC`, orgID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	invitations := []models.OrganizationInvitation{}
+	for rows.Next() {
+		var inv models.OrganizationInvitation
+		if err := rows.Scan(&inv.ID, &inv.Phone, &inv.Email, &inv.Role, &inv.ExpiresAt, &inv.AcceptedAt, &inv.CreatedAt); err != nil {
+			continue
+		}
+		invitations = append(invitations, inv)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": invitations})
+}
+
+func RevokeOrganizationInvitation(c *fiber.Ctx) error {
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	_, orgID, err := requireOrgAccess(c, database, true)
+	if err != nil {
+		return err
+	}
+	invitationID, err := strconv.Atoi(c.Params("invitationId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid invitation ID")
+	}
+
+	result, err := database.Exec(`DELETE FROM organization_invitations WHERE id = ? AND organization_id = ? AND accepted_at IS NULL`, invitationID, orgID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Open invitation not found")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Invitation revoked"})
+}
+
+// AcceptOrganizationInvitation joins the caller to the inviting organization
+// when their phone or email matches the invitation.
+func AcceptOrganizationInvitation(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	if user.Role != "user" {
+		return fiber.NewError(fiber.StatusForbidden, "Only customers can join organizations")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var invitationID, orgID int
+	var phone, email sql.NullString
+	var role string
+	var expiresAt time.Time
+	var acceptedAt sql.NullTime
+	err = database.QueryRow(`
+		SELECT i.id, i.organization_id, i.phone, i.email, i.role, i.expires_at, i.accepted_at
+		FROM organization_invitations i JOIN organizations o ON o.id = i.organization_id
+		WHERE i.token = ? AND o.tenant_id = ?`, c.Params("token"), user.TenantID).
+		Scan(&invitationID, &orgID, &phone, &email, &role, &expiresAt, &acceptedAt)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Invitation not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if acceptedAt.Valid || time.Now().After(expiresAt) {
+		return fiber.NewError(fiber.StatusGone, "Invitation is no longer valid")
+	}
+
+	var userPhone string
+	var userEmail sql.NullString
+	if err := database.QueryRow(`SELECT phone, email FROM users WHERE id = ?`, user.ID).Scan(&userPhone, &userEmail); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	phoneMatches := phone.Valid && phone.String == userPhone
+	emailMatches := email.Valid && userEmail.Valid && strings.EqualFold(email.String, userEmail.String)
+	if !phoneMatches && !emailMatches {
+		return fiber.NewError(fiber.StatusForbidden, "This invitation was sent to someone else")
+	}
+
+	memberOf, _, err := orgMembership(database, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if memberOf != 0 {
+		return fiber.NewError(fiber.StatusConflict, "You already belong to an organization")
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE organization_invitations SET accepted_at = NOW() WHERE id = ? AND accepted_at IS NULL`, invitationID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusGone, "Invitation is no longer valid")
+	}
+	if _, err := tx.Exec(`INSERT INTO organization_members (organization_id, user_id, role) VALUES (?, ?, ?)`, orgID, user.ID, role); err != nil {
+		return fiber.NewError(fiber.StatusConflict, "You already belong to an organization")
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "You joined the organization", "organization_id": orgID})
+}
+
+// ListOrganizationRequests shows org admins the tickets filed for the
+// organization; personal tickets of members stay private.
+// Filters: ?user_id=, ?status=.
+func ListOrganizationRequests(c *fiber.Ctx) error {
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	_, orgID, err := requireOrgAccess(c, database, true)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		SELECT s.id, s.user_id, s.title, s.description, s.category, s.status, s.assigned_to, COALESCE(s.region, ''), s.asset_id, s.created_at, s.updated_at
+		FROM support_requests s
+		WHERE s.organization_id = ?`
+	args := []any{orgID}
+	if id := c.QueryInt("user_id"); id != 0 {
+		query += ` AND s.user_id = ?`
+		args = append(args, id)
+	}
+	if status := c.Query("status"); status != "" {
+		query += ` AND s.status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY s.created_at DESC`
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	requests := []models.SupportRequest{}
+	for rows.Next() {
+		var r models.SupportRequest
+		if err := rows.Scan(&r.ID, &r.UserID, &r.Title, &r.Description, &r.Category, &r.Status, &r.AssignedTo, &r.Region, &r.AssetID, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			continue
+		}
+		requests = append(requests, r)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": requests})
+}
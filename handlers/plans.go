@@ -1,8 +1,9 @@
 package handlers
 
 import (
-	"encoding/json"
+	"database/sql"
 	"fmt"
+	"ithelp/audit"
 	"ithelp/db"
 	"ithelp/models"
 	"strconv"
@@ -26,7 +27,7 @@ func ListPlans(c *fiber.Ctx) error {
 	defer dbConn.Close()
 	logAction("ListPlans: Successfully connected to the database.")
 
-	rows, err := dbConn.Query(`SELECT id, name, price, remote_calls, onsite_calls FROM plans`)
+	rows, err := dbConn.Query(`SELECT id, name, price, remote_calls, onsite_calls FROM plans WHERE tenant_id = ?`, tenantID(c))
 	if err != nil {
 		logAction(fmt.Sprintf("ListPlans: Query execution error: %v", err))
 		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
@@ -50,12 +51,10 @@ func ListPlans(c *fiber.Ctx) error {
 
 func CreatePlan(c *fiber.Ctx) error {
 	logAction("CreatePlan: Starting to create a new plan.")
-	userJson := c.Locals("userJSON").(string)
-	var requester models.User
-	err := json.Unmarshal([]byte(userJson), &requester)
-	if err != nil {
-		logAction(fmt.Sprintf("CreatePlan: Error unmarshalling user from locals: %v", err))
-		return fiber.NewError(fiber.StatusInternalServerError, "Internal server error")
+	requester, ok := currentUser(c)
+	if !ok {
+		logAction("CreatePlan: No authenticated user in locals.")
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
 	}
 	logAction(fmt.Sprintf("CreatePlan: Request made by user with role: %s", requester.Role))
 
@@ -79,14 +78,19 @@ func CreatePlan(c *fiber.Ctx) error {
 	defer dbConn.Close()
 	logAction("CreatePlan: Successfully connected to the database.")
 
-	_, err = dbConn.Exec(`INSERT INTO plans (name, price, remote_calls, onsite_calls) VALUES (?, ?, ?, ?)`,
-		input.Name, input.Price, input.RemoteCalls, input.OnsiteCalls)
+	result, err := dbConn.Exec(`INSERT INTO plans (tenant_id, name, price, remote_calls, onsite_calls) VALUES (?, ?, ?, ?, ?)`,
+		requester.TenantID, input.Name, input.Price, input.RemoteCalls, input.OnsiteCalls)
 	if err != nil {
 		logAction(fmt.Sprintf("CreatePlan: Insert query failed: %v", err))
 		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
 	}
 	logAction(fmt.Sprintf("CreatePlan: Plan '%s' created successfully.", input.Name))
 
+	planID, _ := result.LastInsertId()
+	entry := audit.FromRequest(c, "plan.create", "plans", planID)
+	entry.After = planSnapshot(dbConn, requester.TenantID, int(planID))
+	audit.Log(c, dbConn, entry)
+
 	return c.JSON(fiber.Map{"success": true, "message": "Plan created"})
 }
 
@@ -99,12 +103,10 @@ func UpdatePlan(c *fiber.Ctx) error {
 	}
 	logAction(fmt.Sprintf("UpdatePlan: Starting to update plan with ID: %d", id))
 
-	userJson := c.Locals("userJSON").(string)
-	var requester models.User
-	err = json.Unmarshal([]byte(userJson), &requester)
-	if err != nil {
-		logAction(fmt.Sprintf("UpdatePlan: Error unmarshalling user from locals: %v", err))
-		return fiber.NewError(fiber.StatusInternalServerError, "Internal server error")
+	requester, ok := currentUser(c)
+	if !ok {
+		logAction("UpdatePlan: No authenticated user in locals.")
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
 	}
 	logAction(fmt.Sprintf("UpdatePlan: Request made by user with role: %s", requester.Role))
 
@@ -128,14 +130,19 @@ func UpdatePlan(c *fiber.Ctx) error {
 	defer dbConn.Close()
 	logAction("UpdatePlan: Successfully connected to the database.")
 
-	_, err = dbConn.Exec(`UPDATE plans SET name=?, price=?, remote_calls=?, onsite_calls=? WHERE id=?`,
-		input.Name, input.Price, input.RemoteCalls, input.OnsiteCalls, id)
+	before := planSnapshot(dbConn, requester.TenantID, id)
+	_, err = dbConn.Exec(`UPDATE plans SET name=?, price=?, remote_calls=?, onsite_calls=? WHERE id=? AND tenant_id=?`,
+		input.Name, input.Price, input.RemoteCalls, input.OnsiteCalls, id, requester.TenantID)
 	if err != nil {
 		logAction(fmt.Sprintf("UpdatePlan: Update query failed for plan ID %d: %v", id, err))
 		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
 	}
 	logAction(fmt.Sprintf("UpdatePlan: Plan with ID %d updated successfully.", id))
 
+	entry := audit.FromRequest(c, "plan.update", "plans", id)
+	entry.Before, entry.After = before, planSnapshot(dbConn, requester.TenantID, id)
+	audit.Log(c, dbConn, entry)
+
 	return c.JSON(fiber.Map{"success": true, "message": "Plan updated"})
 }
 
@@ -148,12 +155,10 @@ func DeletePlan(c *fiber.Ctx) error {
 	}
 	logAction(fmt.Sprintf("DeletePlan: Starting to delete plan with ID: %d", id))
 
-	userJson := c.Locals("userJSON").(string)
-	var requester models.User
-	err = json.Unmarshal([]byte(userJson), &requester)
-	if err != nil {
-		logAction(fmt.Sprintf("DeletePlan: Error unmarshalling user from locals: %v", err))
-		return fiber.NewError(fiber.StatusInternalServerError, "Internal server error")
+	requester, ok := currentUser(c)
+	if !ok {
+		logAction("DeletePlan: No authenticated user in locals.")
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
 	}
 	logAction(fmt.Sprintf("DeletePlan: Request made by user with role: %s", requester.Role))
 
@@ -170,12 +175,87 @@ func DeletePlan(c *fiber.Ctx) error {
 	defer dbConn.Close()
 	logAction("DeletePlan: Successfully connected to the database.")
 
-	_, err = dbConn.Exec(`DELETE FROM plans WHERE id=?`, id)
+	before := planSnapshot(dbConn, requester.TenantID, id)
+	_, err = dbConn.Exec(`DELETE FROM plans WHERE id=? AND tenant_id=?`, id, requester.TenantID)
 	if err != nil {
 		logAction(fmt.Sprintf("DeletePlan: Delete query failed for plan ID %d: %v", id, err))
 		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
 	}
 	logAction(fmt.Sprintf("DeletePlan: Plan with ID %d deleted successfully.", id))
 
+	entry := audit.FromRequest(c, "plan.delete", "plans", id)
+	entry.Before = before
+	audit.Log(c, dbConn, entry)
+
 	return c.JSON(fiber.Map{"success": true, "message": "Plan deleted"})
-}
\ No newline at end of file
+}
+
+// loadPlanUsage returns the customer's quota usage, or nil when the user has no
+// active subscription. Onsite calls are non-cancelled appointments, remote calls
+// are tickets without an appointment, both counted inside the subscription period.
+// Members of an organization with an active subscription share its quota.
+func loadPlanUsage(dbConn *sql.DB, userID int) (*models.PlanUsage, error) {
+	orgID, _, err := orgMembership(dbConn, userID)
+	if err != nil {
+		return nil, err
+	}
+	if orgID != 0 {
+		usage, err := loadOrgPlanUsage(dbConn, orgID)
+		if err != nil || usage != nil {
+			return usage, err
+		}
+	}
+
+	var u models.PlanUsage
+	err = dbConn.QueryRow(`
+		SELECT p.name, p.remote_calls, p.onsite_calls,
+			(SELECT COUNT(*) FROM support_requests s
+				WHERE s.user_id = u.id AND s.organization_id IS NULL
+				AND s.created_at BETWEEN u.subscription_start AND u.subscription_end
+				AND NOT EXISTS (SELECT 1 FROM appointments a WHERE a.request_id = s.id AND a.status <> 'cancelled')),
+			(SELECT COUNT(*) FROM appointments a JOIN support_requests s ON s.id = a.request_id
+				WHERE a.customer_id = u.id AND s.organization_id IS NULL AND a.status <> 'cancelled'
+				AND a.starts_at BETWEEN u.subscription_start AND u.subscription_end)
+		FROM users u
+		JOIN plans p ON p.name = u.subscription_plan AND p.tenant_id = u.tenant_id
+		WHERE u.id = ? AND u.subscription_start <= NOW() AND u.subscription_end >= NOW()
+	`, userID).Scan(&u.Plan, &u.RemoteCalls, &u.OnsiteCalls, &u.RemoteUsed, &u.OnsiteUsed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u.RemoteRemaining = max(u.RemoteCalls-u.RemoteUsed, 0)
+	u.OnsiteRemaining = max(u.OnsiteCalls-u.OnsiteUsed, 0)
+	return &u, nil
+}
+
+// loadOrgPlanUsage is loadPlanUsage for the shared quota of an organization,
+// counting the tickets its members raised on the organization's account.
+func loadOrgPlanUsage(dbConn *sql.DB, orgID int) (*models.PlanUsage, error) {
+	u := models.PlanUsage{OrganizationID: &orgID}
+	err := dbConn.QueryRow(`
+		SELECT p.name, p.remote_calls, p.onsite_calls,
+			(SELECT COUNT(*) FROM support_requests s
+				WHERE s.organization_id = o.id AND s.created_at BETWEEN o.subscription_start AND o.subscription_end
+				AND NOT EXISTS (SELECT 1 FROM appointments a WHERE a.request_id = s.id AND a.status <> 'cancelled')),
+			(SELECT COUNT(*) FROM appointments a JOIN support_requests s ON s.id = a.request_id
+				WHERE s.organization_id = o.id AND a.status <> 'cancelled'
+				AND a.starts_at BETWEEN o.subscription_start AND o.subscription_end)
+		FROM organizations o
+		JOIN plans p ON p.name = o.subscription_plan AND p.tenant_id = o.tenant_id
+		WHERE o.id = ? AND o.subscription_start <= NOW() AND o.subscription_end >= NOW()
+	`, orgID).Scan(&u.Plan, &u.RemoteCalls, &u.OnsiteCalls, &u.RemoteUsed, &u.OnsiteUsed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u.RemoteRemaining = max(u.RemoteCalls-u.RemoteUsed, 0)
+	u.OnsiteRemaining = max(u.OnsiteCalls-u.OnsiteUsed, 0)
+	return &u, nil
+}
@@ -0,0 +1,526 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"ithelp/db"
+	"ithelp/events"
+	"ithelp/models"
+	"ithelp/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const recurringColumns = `id, tenant_id, customer_id, organization_id, title, description, category_id, custom_fields, region,
+	technician_id, schedule, starts_at, lead_days, onsite, address, visit_minutes, active, next_run_at, last_run_at,
+	last_error, created_at`
+
+func scanRecurring(scan func(dest ...any) error) (models.RecurringTicket, error) {
+	var r models.RecurringTicket
+	var customFields []byte
+	err := scan(&r.ID, &r.TenantID, &r.CustomerID, &r.OrganizationID, &r.Title, &r.Description, &r.CategoryID, &customFields, &r.Region,
+		&r.TechnicianID, &r.Schedule, &r.StartsAt, &r.LeadDays, &r.Onsite, &r.Address, &r.VisitMinutes, &r.Active, &r.NextRunAt, &r.LastRunAt,
+		&r.LastError, &r.CreatedAt)
+	if err == nil && customFields != nil {
+		json.Unmarshal(customFields, &r.CustomFields)
+	}
+	return r, err
+}
+
+type recurringInput struct {
+	CustomerID     int            `json:"customer_id"`
+	OrganizationID *int           `json:"organization_id"` // optional, customer must be a member
+	Title          string         `json:"title"`
+	Description    string         `json:"description"`
+	CategoryID     *int           `json:"category_id"`
+	CustomFields   map[string]any `json:"custom_fields"`
+	Region         string         `json:"region"`
+	TechnicianID   *int           `json:"technician_id"`
+	Schedule       string         `json:"schedule"`
+	StartsAt       string         `json:"starts_at"` // RFC3339, defaults to now
+	LeadDays       *int           `json:"lead_days"`
+	Onsite         *bool          `json:"onsite"`
+	Address        string         `json:"address"`
+	VisitMinutes   int            `json:"visit_minutes"`
+	Active         *bool          `json:"active"`
+}
+
+// recurringValues is a validated recurringInput ready to be stored.
+type recurringValues struct {
+	in           recurringInput
+	startsAt     time.Time
+	nextRunAt    *time.Time
+	customFields any
+}
+
+func (in recurringInput) validate(database *sql.DB, admin models.User) (*recurringValues, error) {
+	v := &recurringValues{in: in}
+	v.in.Title = strings.TrimSpace(in.Title)
+	if v.in.Title == "" || in.CustomerID == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "customer_id and title are required")
+	}
+
+	customer := models.User{ID: in.CustomerID}
+	err := database.QueryRow(`SELECT tenant_id FROM users WHERE id = ? AND tenant_id = ?`, in.CustomerID, admin.TenantID).Scan(&customer.TenantID)
+	if err == sql.ErrNoRows {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Customer not found")
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if in.OrganizationID != nil {
+		var member bool
+		database.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM organization_members m JOIN organizations o ON o.id = m.organization_id
+				WHERE m.organization_id = ? AND m.user_id = ? AND o.tenant_id = ?)`,
+			*in.OrganizationID, in.CustomerID, admin.TenantID).Scan(&member)
+		if !member {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Customer is not a member of the organization")
+		}
+	}
+
+	if in.CategoryID != nil {
+		tc, err := resolveTicketCategory(database, customer, *in.CategoryID, in.CustomFields)
+		if err != nil {
+			return nil, err
+		}
+		if tc.CustomFields != nil {
+			v.customFields = string(tc.CustomFields)
+		}
+	}
+
+	if in.TechnicianID != nil {
+		var techTenant int
+		err := database.QueryRow(`SELECT tenant_id FROM users WHERE id = ? AND role = 'tech'`, *in.TechnicianID).Scan(&techTenant)
+		if err != nil || techTenant != admin.TenantID {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Technician not found")
+		}
+	}
+
+	v.startsAt = time.Now()
+	if in.StartsAt != "" {
+		if v.startsAt, err = time.Parse(time.RFC3339, in.StartsAt); err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "starts_at must be RFC3339")
+		}
+	}
+	schedule, err := utils.ParseSchedule(in.Schedule, v.startsAt)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		v.nextRunAt = &next
+	}
+
+	if v.in.LeadDays == nil {
+		lead := 3
+		v.in.LeadDays = &lead
+	}
+	if *v.in.LeadDays < 0 || *v.in.LeadDays > 60 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "lead_days must be between 0 and 60")
+	}
+	if v.in.Onsite == nil {
+		onsite := true
+		v.in.Onsite = &onsite
+	}
+	if *v.in.Onsite && strings.TrimSpace(in.Address) == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "address is required for onsite visits")
+	}
+	if v.in.VisitMinutes <= 0 {
+		v.in.VisitMinutes = 60
+	}
+	if v.in.Active == nil {
+		active := true
+		v.in.Active = &active
+	}
+	return v, nil
+}
+
+// ListRecurringTickets lists the schedules. Filters: ?customer_id=, ?organization_id=.
+func ListRecurringTickets(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	query := `SELECT ` + recurringColumns + ` FROM recurring_tickets WHERE tenant_id = ?`
+	args := []any{admin.TenantID}
+	if id := c.QueryInt("customer_id"); id != 0 {
+		query += ` AND customer_id = ?`
+		args = append(args, id)
+	}
+	if id := c.QueryInt("organization_id"); id != 0 {
+		query += ` AND organization_id = ?`
+		args = append(args, id)
+	}
+	query += ` ORDER BY active DESC, next_run_at`
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	list := []models.RecurringTicket{}
+	for rows.Next() {
+		r, err := scanRecurring(rows.Scan)
+		if err != nil {
+			continue
+		}
+		list = append(list, r)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": list})
+}
+
+// GetRecurringTicket returns a schedule with its next five occurrences.
+func GetRecurringTicket(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid schedule ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	r, err := scanRecurring(database.QueryRow(`SELECT `+recurringColumns+` FROM recurring_tickets WHERE id = ? AND tenant_id = ?`,
+		id, admin.TenantID).Scan)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Schedule not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+
+	upcoming := []time.Time{}
+	if schedule, err := utils.ParseSchedule(r.Schedule, r.StartsAt); err == nil && r.Active {
+		upcoming = append(upcoming, schedule.Upcoming(time.Now(), 5)...)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": r, "upcoming": upcoming})
+}
+
+func CreateRecurringTicket(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	var input recurringInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	v, err := input.validate(database, admin)
+	if err != nil {
+		return err
+	}
+
+	result, err := database.Exec(`
+		INSERT INTO recurring_tickets (tenant_id, customer_id, organization_id, title, description, category_id, custom_fields,
+			region, technician_id, schedule, starts_at, lead_days, onsite, address, visit_minutes, active, next_run_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		admin.TenantID, v.in.CustomerID, v.in.OrganizationID, v.in.Title, v.in.Description, v.in.CategoryID, v.customFields,
+		nullIfEmpty(v.in.Region), v.in.TechnicianID, strings.TrimSpace(v.in.Schedule), v.startsAt, *v.in.LeadDays, *v.in.Onsite,
+		nullIfEmpty(v.in.Address), v.in.VisitMinutes, *v.in.Active, v.nextRunAt, admin.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	id, _ := result.LastInsertId()
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "message": "Schedule created", "id": id, "next_run_at": v.nextRunAt})
+}
+
+// UpdateRecurringTicket replaces the template and schedule; the next
+// occurrence is computed again from now.
+func UpdateRecurringTicket(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid schedule ID")
+	}
+
+	var input recurringInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := inTenant(database, c, "recurring_tickets", id); err != nil {
+		return err
+	}
+	v, err := input.validate(database, admin)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Exec(`
+		UPDATE recurring_tickets SET customer_id = ?, organization_id = ?, title = ?, description = ?, category_id = ?,
+			custom_fields = ?, region = ?, technician_id = ?, schedule = ?, starts_at = ?, lead_days = ?, onsite = ?,
+			address = ?, visit_minutes = ?, active = ?, next_run_at = ?, last_error = NULL
+		WHERE id = ?`,
+		v.in.CustomerID, v.in.OrganizationID, v.in.Title, v.in.Description, v.in.CategoryID,
+		v.customFields, nullIfEmpty(v.in.Region), v.in.TechnicianID, strings.TrimSpace(v.in.Schedule), v.startsAt, *v.in.LeadDays, *v.in.Onsite,
+		nullIfEmpty(v.in.Address), v.in.VisitMinutes, *v.in.Active, v.nextRunAt, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Schedule updated", "next_run_at": v.nextRunAt})
+}
+
+// DeleteRecurringTicket removes a schedule. Tickets it created stay.
+func DeleteRecurringTicket(c *fiber.Ctx) error {
+	if _, err := requireAdmin(c); err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid schedule ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := inTenant(database, c, "recurring_tickets", id); err != nil {
+		return err
+	}
+	if _, err := database.Exec(`DELETE FROM recurring_tickets WHERE id = ?`, id); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Schedule deleted"})
+}
+
+// RunRecurringTickets creates the tickets of every schedule whose next
+// occurrence is within its lead time. Called by the jobs scheduler.
+func RunRecurringTickets() error {
+	database, err := db.Connect()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`
+		SELECT id FROM recurring_tickets
+		WHERE active = 1 AND next_run_at IS NOT NULL AND next_run_at <= NOW() + INTERVAL lead_days DAY`)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		// a schedule that fell behind catches up one occurrence per run
+		if err := runRecurringTicket(database, id); err != nil {
+			log.Printf("recurring: schedule %d failed: %v", id, err)
+			database.Exec(`UPDATE recurring_tickets SET last_error = ? WHERE id = ?`, truncate(err.Error(), 500), id)
+		}
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// claimOccurrence moves the schedule to its next occurrence and returns the
+// one being created. The row lock keeps two app instances from both creating it.
+func claimOccurrence(database *sql.DB, id int) (models.RecurringTicket, time.Time, bool, error) {
+	var r models.RecurringTicket
+	tx, err := database.Begin()
+	if err != nil {
+		return r, time.Time{}, false, err
+	}
+	defer tx.Rollback()
+
+	r, err = scanRecurring(tx.QueryRow(`SELECT `+recurringColumns+` FROM recurring_tickets
+		WHERE id = ? AND active = 1 AND next_run_at <= NOW() + INTERVAL lead_days DAY FOR UPDATE`, id).Scan)
+	if err == sql.ErrNoRows {
+		return r, time.Time{}, false, nil
+	}
+	if err != nil {
+		return r, time.Time{}, false, err
+	}
+
+	// a schedule that no longer parses stops after this occurrence and says why
+	occurrence := *r.NextRunAt
+	var next *time.Time
+	var lastError *string
+	if schedule, err := utils.ParseSchedule(r.Schedule, r.StartsAt); err != nil {
+		msg := truncate("invalid schedule: "+err.Error(), 500)
+		lastError = &msg
+	} else if n := schedule.Next(occurrence); !n.IsZero() {
+		next = &n
+	}
+	if _, err := tx.Exec(`UPDATE recurring_tickets SET next_run_at = ?, last_run_at = NOW(), last_error = ? WHERE id = ?`, next, lastError, id); err != nil {
+		return r, time.Time{}, false, err
+	}
+	return r, occurrence, true, tx.Commit()
+}
+
+func runRecurringTicket(database *sql.DB, id int) error {
+	r, occurrence, ok, err := claimOccurrence(database, id)
+	if err != nil || !ok {
+		return err
+	}
+	tenant := r.TenantID
+
+	title := fmt.Sprintf("%s (%s)", r.Title, occurrence.In(utils.BusinessLocation()).Format("02.01.2006"))
+	category, priority := "", models.PriorityNormal
+	var dueAt any
+	if r.CategoryID != nil {
+		if tree, err := loadCategoryTree(database, tenant); err == nil {
+			if _, known := tree.byID[*r.CategoryID]; known {
+				var slaHours *int
+				_, priority, slaHours = tree.settings(*r.CategoryID)
+				category = tree.path(*r.CategoryID)
+				if slaHours != nil {
+					dueAt = occurrence.Add(time.Duration(*slaHours) * time.Hour)
+				}
+			}
+		}
+	}
+	var customFields any
+	if r.CustomFields != nil {
+		b, _ := json.Marshal(r.CustomFields)
+		customFields = string(b)
+	}
+
+	// tickets go on the organization's quota like the customer's own tickets
+	orgID := r.OrganizationID
+	usage, err := loadPlanUsage(database, r.CustomerID)
+	if err != nil {
+		return err
+	}
+	if orgID == nil && usage != nil {
+		orgID = usage.OrganizationID
+	}
+
+	result, err := database.Exec(`
+		INSERT INTO support_requests (tenant_id, user_id, title, description, category, region, organization_id, category_id,
+			priority, due_at, custom_fields, recurring_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		tenant, r.CustomerID, title, r.Description, category, r.Region, orgID, r.CategoryID, priority, dueAt, customFields, r.ID)
+	if err != nil {
+		return err
+	}
+	id64, _ := result.LastInsertId()
+	requestID := int(id64)
+	recordHistory(database, requestID, 0, "recurring", nil, nil, fmt.Sprintf("Created by schedule #%d", r.ID))
+	PublishEvent(database, events.Event{
+		TenantID:  tenant,
+		Type:      events.TicketCreated,
+		RequestID: requestID,
+		UserID:    r.CustomerID,
+		Data:      fiber.Map{"title": title, "category": category, "priority": priority, "recurring_id": r.ID},
+	})
+
+	// problems from here on leave the ticket for a dispatcher and show on the schedule
+	var problems []string
+	assigned := false
+	if r.TechnicianID != nil {
+		if err := checkTechnicianAssignable(database, *r.TechnicianID, requestID); err != nil {
+			problems = append(problems, "technician not assigned: "+errorText(err))
+		} else if _, err := database.Exec(`UPDATE support_requests SET assigned_to = ? WHERE id = ?`, *r.TechnicianID, requestID); err == nil {
+			assigned = true
+			publishTicketEvent(database, events.TicketAssigned, requestID, fiber.Map{"assigned_to": *r.TechnicianID})
+		}
+	}
+
+	if r.Onsite {
+		start := occurrence
+		end := start.Add(time.Duration(r.VisitMinutes) * time.Minute)
+		switch {
+		case !assigned:
+			problems = append(problems, "visit not booked: no technician")
+		case usage == nil:
+			problems = append(problems, "visit not booked: no active subscription")
+		case usage.OnsiteRemaining <= 0:
+			problems = append(problems, "visit not booked: onsite quota used up")
+		default:
+			tx, err := database.Begin()
+			if err != nil {
+				return err
+			}
+			if err := checkVisitWindow(database, tx, *r.TechnicianID, start, end, 0); err != nil {
+				tx.Rollback()
+				problems = append(problems, "visit not booked: "+errorText(err))
+				break
+			}
+			address := ""
+			if r.Address != nil {
+				address = *r.Address
+			}
+			var createdBy int
+			database.QueryRow(`SELECT created_by FROM recurring_tickets WHERE id = ?`, r.ID).Scan(&createdBy)
+			result, err := tx.Exec(`
+				INSERT INTO appointments (request_id, technician_id, customer_id, address, starts_at, ends_at, notes, created_by)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				requestID, *r.TechnicianID, r.CustomerID, address, start, end, "Preventive maintenance", createdBy)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+			appointmentID, _ := result.LastInsertId()
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			if a, err := loadAppointment(database, int(appointmentID)); err == nil {
+				publishAppointmentEvent(database, events.AppointmentScheduled, a)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		detail := strings.Join(problems, "; ")
+		recordHistory(database, requestID, 0, "recurring", nil, nil, detail)
+		// keeps an invalid schedule noted by claimOccurrence
+		database.Exec(`UPDATE recurring_tickets SET last_error = LEFT(CONCAT_WS('; ', last_error, ?), 500) WHERE id = ?`, detail, r.ID)
+	}
+	return nil
+}
@@ -0,0 +1,473 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"ithelp/db"
+	"ithelp/models"
+	"ithelp/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxReportAttachment keeps emailed reports under what mail servers accept.
+const maxReportAttachment = 10 << 20
+
+const subscriptionColumns = `id, name, report, filters, format, recipients, schedule, period_days, active,
+	next_run_at, last_run_at, last_error, created_by, created_at`
+
+func scanSubscription(scan func(dest ...any) error) (models.ReportSubscription, error) {
+	var s models.ReportSubscription
+	var filters, recipients []byte
+	err := scan(&s.ID, &s.Name, &s.Report, &filters, &s.Format, &recipients, &s.Schedule, &s.PeriodDays, &s.Active,
+		&s.NextRunAt, &s.LastRunAt, &s.LastError, &s.CreatedBy, &s.CreatedAt)
+	if err == nil {
+		json.Unmarshal(filters, &s.Filters)
+		json.Unmarshal(recipients, &s.Recipients)
+	}
+	return s, err
+}
+
+type subscriptionInput struct {
+	Name       string            `json:"name"`
+	Report     string            `json:"report"`
+	Filters    map[string]string `json:"filters"` // as in the query string of the export
+	Format     string            `json:"format"`  // csv or xlsx (default)
+	Recipients []string          `json:"recipients"`
+	Schedule   string            `json:"schedule"`
+	PeriodDays *int              `json:"period_days"`
+	Active     *bool             `json:"active"`
+}
+
+// validate normalizes the input, builds the report once to check its
+// filters and returns the first run.
+func (in *subscriptionInput) validate(database *sql.DB, admin models.User) (*time.Time, error) {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "name is required")
+	}
+	if in.Format == "" {
+		in.Format = "xlsx"
+	}
+	if _, ok := utils.SheetContentTypes[in.Format]; !ok {
+		return nil, fiber.NewError(fiber.StatusBadRequest, utils.ErrBadFormat.Error())
+	}
+	if len(in.Recipients) == 0 || len(in.Recipients) > 20 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "1 to 20 recipients are required")
+	}
+	for i, r := range in.Recipients {
+		addr, err := mail.ParseAddress(r)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid recipient %q", r))
+		}
+		in.Recipients[i] = addr.Address
+	}
+	if in.PeriodDays == nil {
+		days := 7
+		in.PeriodDays = &days
+	}
+	if *in.PeriodDays < 0 || *in.PeriodDays > 366 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "period_days must be between 0 and 366")
+	}
+	if in.Active == nil {
+		active := true
+		in.Active = &active
+	}
+	if in.Filters == nil {
+		in.Filters = map[string]string{}
+	}
+	if _, err := buildReport(database, admin, in.Report, reportParams(in.Filters, *in.PeriodDays, time.Now())); err != nil {
+		return nil, err
+	}
+
+	in.Schedule = strings.TrimSpace(in.Schedule)
+	schedule, err := utils.ParseSchedule(in.Schedule, time.Now())
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		return &next, nil
+	}
+	return nil, nil
+}
+
+// reportParams are the stored filters with ?from= and ?to= set to the
+// periodDays days before at, unless periodDays is 0.
+func reportParams(filters map[string]string, periodDays int, at time.Time) params {
+	p := params{}
+	for k, v := range filters {
+		p[k] = v
+	}
+	if periodDays > 0 {
+		to := at.In(utils.BusinessLocation()).AddDate(0, 0, -1)
+		p["from"] = to.AddDate(0, 0, 1-periodDays).Format("2006-01-02")
+		p["to"] = to.Format("2006-01-02")
+	}
+	return p
+}
+
+func ListReportSubscriptions(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`SELECT `+subscriptionColumns+` FROM report_subscriptions WHERE tenant_id = ?
+		ORDER BY active DESC, name`, admin.TenantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	list := []models.ReportSubscription{}
+	for rows.Next() {
+		s, err := scanSubscription(rows.Scan)
+		if err != nil {
+			continue
+		}
+		list = append(list, s)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": list})
+}
+
+func CreateReportSubscription(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	var input subscriptionInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	next, err := input.validate(database, admin)
+	if err != nil {
+		return err
+	}
+	filters, _ := json.Marshal(input.Filters)
+	recipients, _ := json.Marshal(input.Recipients)
+
+	result, err := database.Exec(`
+		INSERT INTO report_subscriptions (tenant_id, name, report, filters, format, recipients, schedule, period_days, active, next_run_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		admin.TenantID, input.Name, input.Report, filters, input.Format, recipients, input.Schedule, *input.PeriodDays, *input.Active, next, admin.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	id, _ := result.LastInsertId()
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "message": "Subscription created", "id": id, "next_run_at": next})
+}
+
+// UpdateReportSubscription replaces a subscription; the next run is computed
+// again from now.
+func UpdateReportSubscription(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+	}
+
+	var input subscriptionInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := inTenant(database, c, "report_subscriptions", id); err != nil {
+		return err
+	}
+	next, err := input.validate(database, admin)
+	if err != nil {
+		return err
+	}
+	filters, _ := json.Marshal(input.Filters)
+	recipients, _ := json.Marshal(input.Recipients)
+
+	_, err = database.Exec(`
+		UPDATE report_subscriptions SET name = ?, report = ?, filters = ?, format = ?, recipients = ?, schedule = ?,
+			period_days = ?, active = ?, next_run_at = ?, last_error = NULL
+		WHERE id = ?`,
+		input.Name, input.Report, filters, input.Format, recipients, input.Schedule, *input.PeriodDays, *input.Active, next, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Subscription updated", "next_run_at": next})
+}
+
+func DeleteReportSubscription(c *fiber.Ctx) error {
+	if _, err := requireAdmin(c); err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := inTenant(database, c, "report_subscriptions", id); err != nil {
+		return err
+	}
+	if _, err := database.Exec(`DELETE FROM report_subscriptions WHERE id = ?`, id); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Subscription deleted"})
+}
+
+// ListReportRuns returns the latest runs of the tenant's subscriptions, of
+// subscription :id when given. Filter: ?status=running|sent|failed.
+func ListReportRuns(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	query := `SELECT r.id, r.subscription_id, r.status, r.manual, DATE_FORMAT(r.period_from, '%Y-%m-%d'),
+			DATE_FORMAT(r.period_to, '%Y-%m-%d'), r.size_bytes, r.error, r.started_at, r.finished_at
+		FROM report_runs r JOIN report_subscriptions s ON s.id = r.subscription_id
+		WHERE s.tenant_id = ?`
+	args := []any{admin.TenantID}
+	if c.Params("id") != "" {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+		}
+		query += ` AND r.subscription_id = ?`
+		args = append(args, id)
+	}
+	if status := c.Query("status"); status != "" {
+		query += ` AND r.status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY r.started_at DESC, r.id DESC LIMIT 100`
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	runs := []models.ReportRun{}
+	for rows.Next() {
+		var r models.ReportRun
+		if err := rows.Scan(&r.ID, &r.SubscriptionID, &r.Status, &r.Manual, &r.PeriodFrom, &r.PeriodTo, &r.SizeBytes,
+			&r.Error, &r.StartedAt, &r.FinishedAt); err != nil {
+			continue
+		}
+		runs = append(runs, r)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": runs})
+}
+
+// RunReportSubscription generates and sends a subscription now, outside its
+// schedule, and returns the outcome.
+func RunReportSubscription(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	s, err := scanSubscription(database.QueryRow(`SELECT `+subscriptionColumns+` FROM report_subscriptions WHERE id = ? AND tenant_id = ?`,
+		id, admin.TenantID).Scan)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Subscription not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+
+	runID, err := deliverReport(database, s, admin.TenantID, true)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"success": false, "message": err.Error(), "run_id": runID})
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Report sent", "run_id": runID})
+}
+
+// RunReportSubscriptions emails every report that is due. Called by the
+// jobs scheduler.
+func RunReportSubscriptions() error {
+	database, err := db.Connect()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`SELECT id FROM report_subscriptions WHERE active = 1 AND next_run_at IS NOT NULL AND next_run_at <= NOW()`)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		s, tenant, ok, err := claimSubscription(database, id)
+		if err != nil {
+			log.Printf("reports: subscription %d failed: %v", id, err)
+			continue
+		}
+		if ok {
+			// failures are kept on the run and the subscription
+			deliverReport(database, s, tenant, false)
+		}
+	}
+	return nil
+}
+
+// claimSubscription moves a due subscription to its next run, skipping the
+// ones missed while the app was down. The row lock keeps two app instances
+// from both sending it.
+func claimSubscription(database *sql.DB, id int) (models.ReportSubscription, int, bool, error) {
+	var s models.ReportSubscription
+	var tenant int
+	tx, err := database.Begin()
+	if err != nil {
+		return s, 0, false, err
+	}
+	defer tx.Rollback()
+
+	s, err = scanSubscription(tx.QueryRow(`SELECT `+subscriptionColumns+` FROM report_subscriptions
+		WHERE id = ? AND active = 1 AND next_run_at <= NOW() FOR UPDATE`, id).Scan)
+	if err == sql.ErrNoRows {
+		return s, 0, false, nil
+	}
+	if err != nil {
+		return s, 0, false, err
+	}
+	tx.QueryRow(`SELECT tenant_id FROM report_subscriptions WHERE id = ?`, id).Scan(&tenant)
+
+	var next *time.Time
+	if schedule, err := utils.ParseSchedule(s.Schedule, *s.NextRunAt); err == nil {
+		if n := schedule.Next(time.Now()); !n.IsZero() {
+			next = &n
+		}
+	}
+	if _, err := tx.Exec(`UPDATE report_subscriptions SET next_run_at = ? WHERE id = ?`, next, id); err != nil {
+		return s, 0, false, err
+	}
+	return s, tenant, true, tx.Commit()
+}
+
+// deliverReport generates the report of a subscription and emails it to
+// every recipient, recording the run. The error is also stored on the run
+// and as the subscription's last_error.
+func deliverReport(database *sql.DB, s models.ReportSubscription, tenant int, manual bool) (int, error) {
+	now := time.Now()
+	p := reportParams(s.Filters, s.PeriodDays, now)
+	result, err := database.Exec(`INSERT INTO report_runs (subscription_id, manual, period_from, period_to) VALUES (?, ?, ?, ?)`,
+		s.ID, manual, nullIfEmpty(p["from"]), nullIfEmpty(p["to"]))
+	if err != nil {
+		return 0, err
+	}
+	id64, _ := result.LastInsertId()
+	runID := int(id64)
+
+	size, err := sendReport(database, s, tenant, p, now)
+	status := "sent"
+	var errText *string
+	if err != nil {
+		status = "failed"
+		msg := truncate(err.Error(), 1000)
+		errText = &msg
+		log.Printf("reports: subscription %d run %d failed: %v", s.ID, runID, err)
+	}
+	database.Exec(`UPDATE report_runs SET status = ?, size_bytes = ?, error = ?, finished_at = NOW() WHERE id = ?`,
+		status, size, errText, runID)
+	database.Exec(`UPDATE report_subscriptions SET last_run_at = NOW(), last_error = ? WHERE id = ?`, errText, s.ID)
+	return runID, err
+}
+
+func sendReport(database *sql.DB, s models.ReportSubscription, tenant int, p params, now time.Time) (*int, error) {
+	// the report runs with the rights of an admin of the tenant, like the export
+	owner := models.User{ID: s.CreatedBy, TenantID: tenant, Role: "admin"}
+	r, err := buildReport(database, owner, s.Report, p)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := writeReport(&buf, s.Format, r); err != nil {
+		return nil, err
+	}
+	size := buf.Len()
+	if size > maxReportAttachment {
+		return &size, fmt.Errorf("report is %.1f MB, over the %d MB email limit; narrow its filters", float64(size)/(1<<20), maxReportAttachment>>20)
+	}
+
+	period := now.In(utils.BusinessLocation()).Format("2006-01-02")
+	if p["from"] != "" {
+		period = p["from"] + " – " + p["to"]
+	}
+	filename := fmt.Sprintf("%s-%s.%s", r.name, now.In(utils.BusinessLocation()).Format("2006-01-02"), s.Format)
+	subject := fmt.Sprintf("%s (%s)", s.Name, period)
+	body := fmt.Sprintf("Attached is the %s report for %s.\n\nYou receive it through the report subscription \"%s\".\n", r.name, period, s.Name)
+
+	var failed []string
+	for _, to := range s.Recipients {
+		if err := utils.SendEmailAttachment(to, subject, body, filename, utils.SheetContentTypes[s.Format], buf.Bytes()); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", to, err))
+		}
+	}
+	if len(failed) > 0 {
+		return &size, fmt.Errorf("%d of %d recipients failed: %s", len(failed), len(s.Recipients), strings.Join(failed, "; "))
+	}
+	return &size, nil
+}
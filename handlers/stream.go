@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"ithelp/events"
+	"ithelp/models"
+	"ithelp/notifications"
+	"ithelp/webhooks"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const streamHeartbeat = 25 * time.Second
+
+// querier is satisfied by *sql.DB and *sql.Tx.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// ticketEvent loads the owner and technician of a request so the hub can
+// scope the event.
+func ticketEvent(database querier, eventType string, requestID int, data map[string]any) (events.Event, error) {
+	e := events.Event{Type: eventType, RequestID: requestID, Data: data, CreatedAt: time.Now()}
+	err := database.QueryRow("SELECT tenant_id, user_id, assigned_to FROM support_requests WHERE id = ?", requestID).Scan(&e.TenantID, &e.UserID, &e.AssignedTo)
+	return e, err
+}
+
+// recordEvent stores the consumers' work for an event that must not get lost
+// when the hub drops it: webhook deliveries and notifications. Inside a
+// transaction pass the transaction and publish the event only after the
+// commit.
+func recordEvent(q querier, e events.Event) error {
+	if err := webhooks.Enqueue(q, e); err != nil {
+		return err
+	}
+	return notifications.Enqueue(q, e)
+}
+
+// PublishEvent records an event with recordEvent and publishes it on the
+// hub, for changes that are already committed. Jobs use it too.
+func PublishEvent(database *sql.DB, e events.Event) {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	if err := recordEvent(database, e); err != nil {
+		log.Printf("events: recording %s failed: %v", e.Type, err)
+	}
+	events.Publish(e)
+}
+
+// pendingEvent is a ticket event of a change still inside a transaction.
+type pendingEvent struct {
+	eventType string
+	requestID int
+	data      map[string]any
+}
+
+// recordTicketEvents builds and records ticket events inside the transaction
+// of their change. Publish the returned events after the commit.
+func recordTicketEvents(tx querier, pending []pendingEvent) ([]events.Event, error) {
+	list := make([]events.Event, 0, len(pending))
+	for _, p := range pending {
+		e, err := ticketEvent(tx, p.eventType, p.requestID, p.data)
+		if err != nil {
+			return nil, err
+		}
+		if err := recordEvent(tx, e); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, nil
+}
+
+// publishTicketEvent builds a ticketEvent and publishes it.
+func publishTicketEvent(database *sql.DB, eventType string, requestID int, data map[string]any) {
+	e, err := ticketEvent(database, eventType, requestID, data)
+	if err != nil {
+		log.Printf("publishTicketEvent: request %d lookup failed: %v", requestID, err)
+		return
+	}
+	PublishEvent(database, e)
+}
+
+func visibleFilter(user models.User) func(events.Event) bool {
+	return func(e events.Event) bool {
+		return e.VisibleTo(user)
+	}
+}
+
+// StreamEvents is the Server-Sent Events endpoint (GET /api/stream).
+func StreamEvents(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	sub := events.Subscribe(visibleFilter(user))
+
+	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		defer events.Unsubscribe(sub)
+
+		ticker := time.NewTicker(streamHeartbeat)
+		defer ticker.Stop()
+
+		fmt.Fprint(w, ": connected\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				payload, err := json.Marshal(e)
+				if err != nil {
+					log.Printf("StreamEvents: marshal failed: %v", err)
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, payload)
+			case <-ticker.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			// Flush fails once the client has gone away
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}))
+
+	return nil
+}
+
+// WebSocketUpgrade rejects plain HTTP requests on the WebSocket route.
+func WebSocketUpgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+	return c.Next()
+}
+
+// StreamWebSocket pushes the same events as StreamEvents over a WebSocket (GET /api/ws).
+func StreamWebSocket(conn *websocket.Conn) {
+	user, ok := conn.Locals("user").(models.User)
+	if !ok || user.ID == 0 {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, ErrInvalidAuth))
+		return
+	}
+
+	sub := events.Subscribe(visibleFilter(user))
+	defer events.Unsubscribe(sub)
+
+	// Reader goroutine only exists to notice the client closing the socket
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(e); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
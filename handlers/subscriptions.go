@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"ithelp/audit"
+	"ithelp/db"
+	"ithelp/models"
+	"ithelp/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// subscriptionChange is a change of the subscription of a user or an
+// organization. An empty plan means none.
+type subscriptionChange struct {
+	tenant    int
+	userID    *int
+	orgID     *int
+	fromPlan  string
+	wasActive bool // fromPlan was running until now
+	toPlan    string
+	start     *time.Time
+	end       *time.Time
+	actorID   *int
+	expired   bool      // the period ran out instead of being cancelled
+	at        time.Time // default now
+}
+
+func planPrice(database *sql.DB, tenant int, plan string) float64 {
+	var price float64
+	database.QueryRow(`SELECT price FROM plans WHERE name = ? AND tenant_id = ?`, plan, tenant).Scan(&price)
+	return price
+}
+
+// recordSubscriptionChange adds the change to the subscription ledger,
+// classified by the monthly price of the plans. Nothing is recorded when
+// there was and is no subscription.
+func recordSubscriptionChange(database *sql.DB, ch subscriptionChange) error {
+	from, to := ch.fromPlan, ch.toPlan
+	if !ch.wasActive {
+		from = ""
+	}
+	var before, after float64
+	if from != "" {
+		before = planPrice(database, ch.tenant, from)
+	}
+	if to != "" {
+		after = planPrice(database, ch.tenant, to)
+	}
+
+	var eventType string
+	switch {
+	case from == "" && to == "":
+		return nil
+	case to == "" && ch.expired:
+		eventType = models.SubExpired
+	case to == "":
+		eventType = models.SubCancelled
+	case from == "":
+		eventType = models.SubStarted
+	case from == to:
+		eventType = models.SubRenewed
+	case after > before:
+		eventType = models.SubUpgraded
+	case after < before:
+		eventType = models.SubDowngraded
+	default:
+		eventType = models.SubChanged
+	}
+	at := ch.at
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	_, err := database.Exec(`
+		INSERT INTO subscription_events (tenant_id, user_id, organization_id, type, from_plan, to_plan, mrr_before, mrr_after,
+			period_start, period_end, actor_id, occurred_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		ch.tenant, ch.userID, ch.orgID, eventType, nullIfEmpty(from), nullIfEmpty(to), before, after,
+		ch.start, ch.end, ch.actorID, at)
+	return err
+}
+
+// RecordSubscriptionExpiry records that the subscription of a user or an
+// organization ran out at end. Called by the expiry job.
+func RecordSubscriptionExpiry(database *sql.DB, tenant int, userID, orgID *int, plan string, end time.Time) error {
+	return recordSubscriptionChange(database, subscriptionChange{
+		tenant: tenant, userID: userID, orgID: orgID, fromPlan: plan, wasActive: true, expired: true, at: end,
+	})
+}
+
+// SetUserSubscription sets the plan and period of a customer's own
+// subscription, records it in the ledger and re-arms the expiry
+// notification. Admin only.
+func SetUserSubscription(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidUserID)
+	}
+
+	var input struct {
+		SubscriptionPlan  string `json:"subscription_plan"`
+		SubscriptionStart string `json:"subscription_start"`
+		SubscriptionEnd   string `json:"subscription_end"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	start, err1 := time.Parse("2006-01-02", input.SubscriptionStart)
+	end, err2 := time.Parse("2006-01-02", input.SubscriptionEnd)
+	if err1 != nil || err2 != nil || end.Before(start) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid subscription period")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "users", userID); err != nil {
+		return err
+	}
+
+	var planExists bool
+	database.QueryRow(`SELECT EXISTS(SELECT 1 FROM plans WHERE name = ? AND tenant_id = ?)`, input.SubscriptionPlan, tenantID(c)).Scan(&planExists)
+	if !planExists {
+		return fiber.NewError(fiber.StatusBadRequest, "Unknown plan")
+	}
+
+	var oldPlan sql.NullString
+	var wasActive bool
+	database.QueryRow(`SELECT subscription_plan, COALESCE(subscription_end >= NOW() AND subscription_expired_at IS NULL, 0) FROM users WHERE id = ?`,
+		userID).Scan(&oldPlan, &wasActive)
+
+	// the period ends at the end of the last day
+	end = end.Add(24*time.Hour - time.Second)
+	_, err = database.Exec(`
+		UPDATE users SET subscription_plan = ?, subscription_start = ?, subscription_end = ?, subscription_expired_at = NULL
+		WHERE id = ?`,
+		input.SubscriptionPlan, start, end, userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+	err = recordSubscriptionChange(database, subscriptionChange{
+		tenant: tenantID(c), userID: &userID, fromPlan: oldPlan.String, wasActive: wasActive, toPlan: input.SubscriptionPlan,
+		start: &start, end: &end, actorID: &admin.ID,
+	})
+	if err != nil {
+		log.Printf("subscriptions: recording change of user %d failed: %v", userID, err)
+	}
+
+	entry := audit.FromRequest(c, "user.subscription", "users", userID)
+	entry.Before = fiber.Map{"subscription_plan": nullIfEmpty(oldPlan.String), "active": wasActive}
+	entry.After = fiber.Map{"subscription_plan": input.SubscriptionPlan, "subscription_start": start, "subscription_end": end}
+	audit.Log(c, database, entry)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Subscription updated"})
+}
+
+// ListSubscriptionEvents returns the latest 200 ledger entries. Filters:
+// ?user_id=, ?organization_id=, ?type=.
+func ListSubscriptionEvents(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	query := `SELECT id, user_id, organization_id, type, from_plan, to_plan, mrr_before, mrr_after, period_start, period_end,
+		actor_id, occurred_at FROM subscription_events WHERE tenant_id = ?`
+	args := []any{admin.TenantID}
+	if id := c.QueryInt("user_id"); id != 0 {
+		query += ` AND user_id = ?`
+		args = append(args, id)
+	}
+	if id := c.QueryInt("organization_id"); id != 0 {
+		query += ` AND organization_id = ?`
+		args = append(args, id)
+	}
+	if t := c.Query("type"); t != "" {
+		query += ` AND type = ?`
+		args = append(args, t)
+	}
+	query += ` ORDER BY occurred_at DESC, id DESC LIMIT 200`
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	list := []models.SubscriptionEvent{}
+	for rows.Next() {
+		var e models.SubscriptionEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.OrganizationID, &e.Type, &e.FromPlan, &e.ToPlan, &e.MRRBefore, &e.MRRAfter,
+			&e.PeriodStart, &e.PeriodEnd, &e.ActorID, &e.OccurredAt); err != nil {
+			continue
+		}
+		list = append(list, e)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": list})
+}
+
+const maxAnalyticsMonths = 36
+
+// monthRange reads ?from= and ?to= (YYYY-MM, both inclusive) in business
+// time, by default the last 12 months including this one, and returns the
+// first instant of every month plus the end of the last.
+func monthRange(c *fiber.Ctx) ([]time.Time, error) {
+	loc := utils.BusinessLocation()
+	y, m, _ := time.Now().In(loc).Date()
+	last := time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	if s := c.Query("to"); s != "" {
+		t, err := time.ParseInLocation("2006-01", s, loc)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "to must be YYYY-MM")
+		}
+		last = t
+	}
+	first := last.AddDate(0, -11, 0)
+	if s := c.Query("from"); s != "" {
+		t, err := time.ParseInLocation("2006-01", s, loc)
+		if err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "from must be YYYY-MM")
+		}
+		first = t
+	}
+	if first.After(last) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "from must not be after to")
+	}
+
+	var bounds []time.Time
+	for t := first; !t.After(last); t = t.AddDate(0, 1, 0) {
+		bounds = append(bounds, t)
+		if len(bounds) > maxAnalyticsMonths {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("At most %d months at once", maxAnalyticsMonths))
+		}
+	}
+	return append(bounds, last.AddDate(0, 1, 0)), nil
+}
+
+type subscriberState struct {
+	plan   string
+	mrr    float64
+	active bool
+}
+
+func money(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// subscriptionMonth compares the subscribers at the start and the end of a
+// month.
+func subscriptionMonth(month time.Time, start, end map[string]subscriberState) models.SubscriptionMonth {
+	m := models.SubscriptionMonth{Month: month.Format("2006-01")}
+	retained := 0.0
+	for key, s := range start {
+		if !s.active {
+			continue
+		}
+		m.SubscribersStart++
+		m.MRRStart += s.mrr
+		e := end[key]
+		if !e.active {
+			m.ChurnedSubscribers++
+			m.ChurnedMRR += s.mrr
+			continue
+		}
+		retained += e.mrr
+		if diff := e.mrr - s.mrr; diff > 0 {
+			m.ExpansionMRR += diff
+		} else {
+			m.ContractionMRR -= diff
+		}
+	}
+
+	plans := map[string]*models.PlanMonth{}
+	for key, e := range end {
+		if !e.active {
+			continue
+		}
+		m.SubscribersEnd++
+		m.MRREnd += e.mrr
+		if !start[key].active {
+			m.NewSubscribers++
+			m.NewMRR += e.mrr
+		}
+		p, ok := plans[e.plan]
+		if !ok {
+			p = &models.PlanMonth{Plan: e.plan}
+			plans[e.plan] = p
+		}
+		p.Subscribers++
+		p.MRR += e.mrr
+	}
+	m.Plans = []models.PlanMonth{}
+	for _, p := range plans {
+		p.MRR = money(p.MRR)
+		m.Plans = append(m.Plans, *p)
+	}
+	sort.Slice(m.Plans, func(i, j int) bool {
+		if m.Plans[i].MRR != m.Plans[j].MRR {
+			return m.Plans[i].MRR > m.Plans[j].MRR
+		}
+		return m.Plans[i].Plan < m.Plans[j].Plan
+	})
+
+	m.ChurnRate = percent(m.ChurnedSubscribers, m.SubscribersStart)
+	if m.MRRStart > 0 {
+		nrr := math.Round(retained*1000/m.MRRStart) / 10
+		m.NetRevenueRetention = &nrr
+	}
+	m.MRRStart, m.MRREnd = money(m.MRRStart), money(m.MRREnd)
+	m.NewMRR, m.ChurnedMRR = money(m.NewMRR), money(m.ChurnedMRR)
+	m.ExpansionMRR, m.ContractionMRR = money(m.ExpansionMRR), money(m.ContractionMRR)
+	return m
+}
+
+// SubscriptionAnalytics returns MRR with its movements, subscribers per plan,
+// churn and net revenue retention for every month from ?from= to ?to=
+// (YYYY-MM), replayed from the subscription ledger.
+func SubscriptionAnalytics(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	bounds, err := monthRange(c)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`
+		SELECT user_id, organization_id, type, COALESCE(to_plan, ''), mrr_after, occurred_at
+		FROM subscription_events WHERE tenant_id = ? AND occurred_at < ?
+		ORDER BY occurred_at, id`, admin.TenantID, bounds[len(bounds)-1])
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	type event struct {
+		key       string
+		eventType string
+		plan      string
+		mrr       float64
+		at        time.Time
+	}
+	var ledger []event
+	for rows.Next() {
+		var e event
+		var userID, orgID *int
+		if err := rows.Scan(&userID, &orgID, &e.eventType, &e.plan, &e.mrr, &e.at); err != nil {
+			continue
+		}
+		if userID != nil {
+			e.key = fmt.Sprintf("user:%d", *userID)
+		} else if orgID != nil {
+			e.key = fmt.Sprintf("organization:%d", *orgID)
+		} else {
+			continue
+		}
+		ledger = append(ledger, e)
+	}
+	rows.Close()
+
+	state := map[string]subscriberState{}
+	apply := func(e event) {
+		state[e.key] = subscriberState{
+			plan:   e.plan,
+			mrr:    e.mrr,
+			active: e.eventType != models.SubCancelled && e.eventType != models.SubExpired,
+		}
+	}
+
+	months := []models.SubscriptionMonth{}
+	next := 0
+	for i := 0; i < len(bounds)-1; i++ {
+		for next < len(ledger) && ledger[next].at.Before(bounds[i]) {
+			apply(ledger[next])
+			next++
+		}
+		start := make(map[string]subscriberState, len(state))
+		for k, v := range state {
+			start[k] = v
+		}
+		upgrades, downgrades := 0, 0
+		for next < len(ledger) && ledger[next].at.Before(bounds[i+1]) {
+			switch ledger[next].eventType {
+			case models.SubUpgraded:
+				upgrades++
+			case models.SubDowngraded:
+				downgrades++
+			}
+			apply(ledger[next])
+			next++
+		}
+		m := subscriptionMonth(bounds[i], start, state)
+		m.Upgrades, m.Downgrades = upgrades, downgrades
+		months = append(months, m)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": months})
+}
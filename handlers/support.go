@@ -1,25 +1,32 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
-	"fmt"
 	"ithelp/db"
+	"ithelp/events"
 	"ithelp/models"
-	"ithelp/utils"
 	"strconv"
+	"strings"
 	"log"
 	"github.com/gofiber/fiber/v2"
 )
 
 func CreateSupportRequest(c *fiber.Ctx) error {
-	userJson := c.Locals("userJSON").(string)
-	var requester models.User
-	json.Unmarshal([]byte(userJson), &requester)
+	requester, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
 
 	var input struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		Category    string `json:"category"`
+		Title        string         `json:"title"`
+		Description  string         `json:"description"`
+		Category     string         `json:"category"`
+		Region       string         `json:"region"`           // optional, used for onsite assignment
+		AssetID      *int           `json:"asset_id"`         // optional, one of the requester's assets
+		Suggestion   int            `json:"kb_suggestion_id"` // optional, from GET /api/kb/suggest
+		CategoryID   *int           `json:"category_id"`      // managed category, replaces category
+		CustomFields map[string]any `json:"custom_fields"`    // values for the category's fields
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -32,13 +39,60 @@ func CreateSupportRequest(c *fiber.Ctx) error {
 	}
 	defer database.Close()
 
-	query := `INSERT INTO support_requests (user_id, title, description, category) VALUES (?, ?, ?, ?)`
-	_, err = database.Exec(query, requester.ID, input.Title, input.Description, input.Category)
+	var region *string
+	if input.Region != "" {
+		region = &input.Region
+	}
+
+	if input.AssetID != nil {
+		if err := checkAssetOwner(database, *input.AssetID, requester.ID); err != nil {
+			return err
+		}
+	}
+
+	// A managed category sets the category path, priority and SLA due date
+	priority := models.PriorityNormal
+	var dueAt any
+	var customFields any
+	if input.CategoryID != nil {
+		tc, err := resolveTicketCategory(database, requester, *input.CategoryID, input.CustomFields)
+		if err != nil {
+			return err
+		}
+		input.Category, priority = tc.Path, tc.Priority
+		if tc.DueAt != nil {
+			dueAt = *tc.DueAt
+		}
+		if tc.CustomFields != nil {
+			customFields = string(tc.CustomFields)
+		}
+	}
+
+	// Tickets of organization members count against the organization's quota
+	var orgID *int
+	if usage, err := loadPlanUsage(database, requester.ID); err == nil && usage != nil {
+		orgID = usage.OrganizationID
+	}
+
+	query := `INSERT INTO support_requests (tenant_id, user_id, title, description, category, region, asset_id, organization_id, category_id, priority, due_at, custom_fields) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := database.Exec(query, requester.TenantID, requester.ID, input.Title, input.Description, input.Category, region, input.AssetID, orgID, input.CategoryID, priority, dueAt, customFields)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Insert error")
 	}
 
-	return c.JSON(fiber.Map{"success": true, "message": "Request created"})
+	requestID, _ := result.LastInsertId()
+	if input.Suggestion != 0 {
+		linkSuggestionToTicket(database, input.Suggestion, requester.ID, requestID)
+	}
+	PublishEvent(database, events.Event{
+		TenantID:  requester.TenantID,
+		Type:      events.TicketCreated,
+		RequestID: int(requestID),
+		UserID:    requester.ID,
+		Data:      fiber.Map{"title": input.Title, "category": input.Category, "priority": priority},
+	})
+
+	return c.JSON(fiber.Map{"success": true, "message": "Request created", "id": requestID})
 }
 
 // handlers/support.go
@@ -104,11 +158,13 @@ func ListMySupportRequests(c *fiber.Ctx) error {
 }
 
 func ListAllSupportRequests(c *fiber.Ctx) error {
-	userJson := c.Locals("userJSON").(string)
-	var requester models.User
-	json.Unmarshal([]byte(userJson), &requester)
+	requester, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
 
-	if requester.Role != "admin" {
+	// technicians can run saved views, limited to their own tickets
+	if requester.Role != "admin" && (requester.Role != "tech" || c.Query("view_id") == "") {
 		return fiber.NewError(fiber.StatusForbidden, "Access denied")
 	}
 
@@ -118,7 +174,23 @@ func ListAllSupportRequests(c *fiber.Ctx) error {
 	}
 	defer database.Close()
 
-	rows, err := database.Query("SELECT id, user_id, title, description, category, status, assigned_to, created_at, updated_at FROM support_requests")
+	// filters: ?status= ?assigned_to= ?unassigned= ?category_id= (with subcategories) ?priority= ?region= ?overdue=
+	// ?tag=a,b ?onsite= ?older_than_hours=, or the stored filter of ?view_id=; ?sort= and ?order= override the view's
+	filter, sort, order, err := listingFilter(database, requester, params(c.Queries()))
+	if err != nil {
+		return err
+	}
+	where, args, err := filter.where(database, tenantID(c))
+	if err != nil {
+		return err
+	}
+	orderClause, err := orderBy(sort, order)
+	if err != nil {
+		return err
+	}
+	query := "SELECT id, user_id, title, description, category, status, assigned_to, COALESCE(region, ''), asset_id, category_id, priority, due_at, custom_fields, (SELECT GROUP_CONCAT(tag ORDER BY tag) FROM ticket_tags WHERE request_id = support_requests.id), created_at, updated_at FROM support_requests WHERE " + where + orderClause
+
+	rows, err := database.Query(query, args...)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
 	}
@@ -127,10 +199,16 @@ func ListAllSupportRequests(c *fiber.Ctx) error {
 	var requests []models.SupportRequest
 	for rows.Next() {
 		var r models.SupportRequest
-		err := rows.Scan(&r.ID, &r.UserID, &r.Title, &r.Description, &r.Category, &r.Status, &r.AssignedTo, &r.CreatedAt, &r.UpdatedAt)
+		var customFields []byte
+		var tags sql.NullString
+		err := rows.Scan(&r.ID, &r.UserID, &r.Title, &r.Description, &r.Category, &r.Status, &r.AssignedTo, &r.Region, &r.AssetID, &r.CategoryID, &r.Priority, &r.DueAt, &customFields, &tags, &r.CreatedAt, &r.UpdatedAt)
 		if err != nil {
 			continue
 		}
+		json.Unmarshal(customFields, &r.CustomFields)
+		if tags.Valid {
+			r.Tags = strings.Split(tags.String, ",")
+		}
 		requests = append(requests, r)
 	}
 
@@ -141,9 +219,10 @@ func UpdateSupportRequest(c *fiber.Ctx) error {
 	idParam := c.Params("id")
 	requestID, _ := strconv.Atoi(idParam)
 
-	userJson := c.Locals("userJSON").(string)
-	var requester models.User
-	json.Unmarshal([]byte(userJson), &requester)
+	requester, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
 
 	if requester.Role != "admin" {
 		return fiber.NewError(fiber.StatusForbidden, "Access denied")
@@ -164,36 +243,47 @@ func UpdateSupportRequest(c *fiber.Ctx) error {
 	}
 	defer database.Close()
 
-	// texnik və istifadəçi email-ləri üçün məlumat al
+	if err := inTenant(database, c, "support_requests", requestID); err != nil {
+		return err
+	}
+
+	// köhnə texnik və status dəyişikliyi yoxlamaq üçün
 	var oldAssigned *int
-	_ = database.QueryRow("SELECT assigned_to FROM support_requests WHERE id = ?", requestID).Scan(&oldAssigned)
+	var oldStatus string
+	_ = database.QueryRow("SELECT assigned_to, status FROM support_requests WHERE id = ?", requestID).Scan(&oldAssigned, &oldStatus)
+
+	if input.AssignedTo != nil && (oldAssigned == nil || *oldAssigned != *input.AssignedTo) {
+		if err := checkTechnicianAssignable(database, *input.AssignedTo, requestID); err != nil {
+			return err
+		}
+	}
 
 	_, err = database.Exec(`UPDATE support_requests SET status = ?, assigned_to = ? WHERE id = ?`, input.Status, input.AssignedTo, requestID)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
 	}
 
-	if input.AssignedTo != nil && (oldAssigned == nil || *oldAssigned != *input.AssignedTo) {
-		var techEmail string
-		err := database.QueryRow("SELECT email FROM users WHERE id = ?", *input.AssignedTo).Scan(&techEmail)
-		if err == nil && techEmail != "" {
-			utils.SendEmail(techEmail, "Sizə yeni texniki müraciət təyin olundu", fmt.Sprintf("Müraciət ID #%d sizə təyin edildi.", requestID))
-		}
+	publishTicketEvent(database, events.TicketUpdated, requestID, fiber.Map{"status": input.Status})
+	if oldStatus != input.Status {
+		recordStatusChange(database, requestID, requester.ID, oldStatus, input.Status)
+		publishTicketEvent(database, events.TicketStatusChanged, requestID, fiber.Map{"old_status": oldStatus, "status": input.Status})
 	}
 
-	var userEmail string
-	err = database.QueryRow("SELECT u.email FROM users u JOIN support_requests s ON u.id = s.user_id WHERE s.id = ?", requestID).Scan(&userEmail)
-	if err == nil && userEmail != "" {
-		utils.SendEmail(userEmail, "Müraciətinizin statusu dəyişdi", fmt.Sprintf("Müraciət #%d statusu dəyişdirildi: %s", requestID, input.Status))
+	if input.AssignedTo != nil && (oldAssigned == nil || *oldAssigned != *input.AssignedTo) {
+		publishTicketEvent(database, events.TicketAssigned, requestID, fiber.Map{"assigned_to": *input.AssignedTo})
 	}
 
+	// technician and customer emails are sent by the notifications package
+	// according to each user's preferences
+
 	return c.JSON(fiber.Map{"success": true, "message": "Request updated"})
 }
 
 func ListAssignedSupportRequests(c *fiber.Ctx) error {
-	userJson := c.Locals("userJSON").(string)
-	var tech models.User
-	json.Unmarshal([]byte(userJson), &tech)
+	tech, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
 
 	if tech.Role != "tech" {
 		return fiber.NewError(fiber.StatusForbidden, "Only technicians allowed")
@@ -205,7 +295,7 @@ func ListAssignedSupportRequests(c *fiber.Ctx) error {
 	}
 	defer database.Close()
 
-	rows, err := database.Query("SELECT id, user_id, title, description, category, status, assigned_to, created_at, updated_at FROM support_requests WHERE assigned_to = ?", tech.ID)
+	rows, err := database.Query("SELECT id, user_id, title, description, category, status, assigned_to, COALESCE(region, ''), asset_id, category_id, priority, due_at, custom_fields, created_at, updated_at FROM support_requests WHERE assigned_to = ?", tech.ID)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
 	}
@@ -214,10 +304,12 @@ func ListAssignedSupportRequests(c *fiber.Ctx) error {
 	var requests []models.SupportRequest
 	for rows.Next() {
 		var r models.SupportRequest
-		err := rows.Scan(&r.ID, &r.UserID, &r.Title, &r.Description, &r.Category, &r.Status, &r.AssignedTo, &r.CreatedAt, &r.UpdatedAt)
+		var customFields []byte
+		err := rows.Scan(&r.ID, &r.UserID, &r.Title, &r.Description, &r.Category, &r.Status, &r.AssignedTo, &r.Region, &r.AssetID, &r.CategoryID, &r.Priority, &r.DueAt, &customFields, &r.CreatedAt, &r.UpdatedAt)
 		if err != nil {
 			continue
 		}
+		json.Unmarshal(customFields, &r.CustomFields)
 		requests = append(requests, r)
 	}
 
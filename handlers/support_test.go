@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"ithelp/middleware"
+	"ithelp/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestSupportListsReadTokenUser calls the listings through JWTMiddleware. The
+// database is unreachable, so a 500 means the handler got past the user and
+// role checks to its first query.
+func TestSupportListsReadTokenUser(t *testing.T) {
+	t.Setenv("DB_HOST", "127.0.0.1")
+	t.Setenv("DB_PORT", "1")
+
+	app := fiber.New()
+	support := app.Group("/api/support", middleware.JWTMiddleware())
+	support.Get("/", ListAllSupportRequests)
+	support.Get("/assigned", ListAssignedSupportRequests)
+
+	tests := []struct {
+		name string
+		path string
+		role string // "" sends no token
+		want int
+	}{
+		{"no token", "/api/support/", "", fiber.StatusUnauthorized},
+		{"admin lists all", "/api/support/", "admin", fiber.StatusInternalServerError},
+		{"tech runs a view", "/api/support/?view_id=3", "tech", fiber.StatusInternalServerError},
+		{"tech without a view", "/api/support/", "tech", fiber.StatusForbidden},
+		{"customer", "/api/support/?view_id=3", "user", fiber.StatusForbidden},
+		{"tech lists assigned", "/api/support/assigned", "tech", fiber.StatusInternalServerError},
+		{"customer lists assigned", "/api/support/assigned", "user", fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.role != "" {
+				token, err := utils.GenerateJWT(7, tt.role, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ithelp/db"
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxTagLength = 50
+
+// normalizeTags trims and lowercases tags and drops duplicates. Commas are
+// rejected since lists of tags are comma separated.
+func normalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	var out []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if strings.Contains(t, ",") {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Tags cannot contain commas")
+		}
+		if len(t) > maxTagLength {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Tag %q is longer than %d characters", t, maxTagLength))
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// addTags tags a request, ignoring tags it already has.
+func addTags(database execer, requestID int, tags []string) error {
+	for _, t := range tags {
+		if _, err := database.Exec(`INSERT IGNORE INTO ticket_tags (request_id, tag) VALUES (?, ?)`, requestID, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTags returns the tags of a request in alphabetical order.
+func loadTags(database *sql.DB, requestID int) []string {
+	tags := []string{}
+	rows, err := database.Query(`SELECT tag FROM ticket_tags WHERE request_id = ? ORDER BY tag`, requestID)
+	if err != nil {
+		return tags
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t string
+		if rows.Scan(&t) == nil {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// ListTags returns the tags used in the tenant with how many requests carry
+// each, for autocompletion.
+func ListTags(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`
+		SELECT t.tag, COUNT(*) FROM ticket_tags t
+		JOIN support_requests s ON s.id = t.request_id
+		WHERE s.tenant_id = ?
+		GROUP BY t.tag ORDER BY COUNT(*) DESC, t.tag`, user.TenantID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	list := []models.TagCount{}
+	for rows.Next() {
+		var t models.TagCount
+		if rows.Scan(&t.Tag, &t.Count) == nil {
+			list = append(list, t)
+		}
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": list})
+}
+
+// AddRequestTags adds tags to a request. Admins and the assigned technician.
+func AddRequestTags(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request ID")
+	}
+
+	var input struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	tags, err := normalizeTags(input.Tags)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "tags is required")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if _, _, err := ticketAccess(database, c, user, id); err != nil {
+		return err
+	}
+	if err := addTags(database, id, tags); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+	recordHistory(database, id, user.ID, "tagged", nil, nil, strings.Join(tags, ", "))
+
+	return c.JSON(fiber.Map{"success": true, "data": loadTags(database, id)})
+}
+
+func RemoveRequestTag(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request ID")
+	}
+	tag, err := url.PathUnescape(c.Params("tag"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid tag")
+	}
+	tag = strings.ToLower(tag)
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if _, _, err := ticketAccess(database, c, user, id); err != nil {
+		return err
+	}
+	result, err := database.Exec(`DELETE FROM ticket_tags WHERE request_id = ? AND tag = ?`, id, tag)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		recordHistory(database, id, user.ID, "untagged", nil, nil, tag)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": loadTags(database, id)})
+}
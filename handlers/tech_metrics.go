@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"ithelp/db"
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// loadTechnicianMetrics computes the metrics of the tenant's technicians, or
+// of techID only when it is not 0, for [from, to). Resolutions and reopens
+// come from the ticket history and count for the technician who resolved,
+// first responses from tech_notes.
+func loadTechnicianMetrics(database *sql.DB, tenant, techID int, from, to time.Time) ([]models.TechnicianMetrics, error) {
+	where := "u.tenant_id = ? AND u.role = 'tech'"
+	args := []any{
+		models.StatusResolved, from, to,
+		models.StatusResolved, from, to,
+		from, to,
+		from, to,
+		from, to,
+		from, to,
+		from, to,
+		from, to,
+		from, to,
+		from, to,
+		tenant,
+	}
+	if techID != 0 {
+		where += " AND u.id = ?"
+		args = append(args, techID)
+	}
+
+	rows, err := database.Query(`
+		SELECT u.id, u.name,
+			(SELECT COUNT(DISTINCT h.request_id) FROM ticket_history h
+				WHERE h.actor_id = u.id AND h.action = 'status' AND h.to_status = ? AND h.created_at >= ? AND h.created_at < ?),
+			(SELECT COUNT(DISTINCT h.request_id) FROM ticket_history h
+				WHERE h.actor_id = u.id AND h.action = 'status' AND h.to_status = ? AND h.created_at >= ? AND h.created_at < ?
+				AND EXISTS (SELECT 1 FROM ticket_history r WHERE r.request_id = h.request_id AND r.action = 'reopened' AND r.created_at >= h.created_at)),
+			(SELECT ROUND(AVG(TIMESTAMPDIFF(MINUTE, s.created_at,
+				(SELECT MIN(n.created_at) FROM tech_notes n WHERE n.request_id = s.id AND n.technician_id = u.id AND n.internal = 0))), 1)
+				FROM support_requests s WHERE s.assigned_to = u.id AND s.merged_into IS NULL AND s.created_at >= ? AND s.created_at < ?),
+			(SELECT ROUND(AVG(TIMESTAMPDIFF(MINUTE, s.created_at, s.resolved_at)), 1) FROM support_requests s
+				WHERE s.assigned_to = u.id AND s.resolved_at >= ? AND s.resolved_at < ?),
+			(SELECT COUNT(*) FROM support_requests s WHERE s.assigned_to = u.id AND s.merged_into IS NULL
+				AND s.due_at >= ? AND s.due_at < ? AND s.resolved_at <= s.due_at),
+			(SELECT COUNT(*) FROM support_requests s WHERE s.assigned_to = u.id AND s.merged_into IS NULL
+				AND s.due_at >= ? AND s.due_at < ?
+				AND (s.resolved_at > s.due_at OR (s.resolved_at IS NULL AND s.status <> 'closed' AND s.due_at < NOW()))),
+			(SELECT COUNT(*) FROM csat_surveys v WHERE v.technician_id = u.id AND v.rating IS NOT NULL
+				AND v.responded_at >= ? AND v.responded_at < ?),
+			(SELECT ROUND(AVG(v.rating), 2) FROM csat_surveys v WHERE v.technician_id = u.id AND v.rating IS NOT NULL
+				AND v.responded_at >= ? AND v.responded_at < ?),
+			(SELECT ROUND(COALESCE(SUM(TIMESTAMPDIFF(MINUTE, e.started_at, e.ended_at)), 0) / 60, 2) FROM time_entries e
+				WHERE e.technician_id = u.id AND e.status <> 'rejected' AND e.started_at >= ? AND e.started_at < ?),
+			(SELECT COUNT(*) FROM appointments a WHERE a.technician_id = u.id AND a.status = 'completed'
+				AND a.starts_at >= ? AND a.starts_at < ?)
+		FROM users u WHERE `+where+` ORDER BY u.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.TechnicianMetrics{}
+	for rows.Next() {
+		var m models.TechnicianMetrics
+		if err := rows.Scan(&m.TechnicianID, &m.Name, &m.Resolved, &m.Reopened, &m.AvgFirstResponseMinutes, &m.AvgResolutionMinutes,
+			&m.SLAMet, &m.SLABreached, &m.CSATResponses, &m.CSATAverage, &m.HoursLogged, &m.OnsiteVisits); err != nil {
+			return nil, err
+		}
+		m.ReopenRate = percent(m.Reopened, m.Resolved)
+		m.SLACompliance = percent(m.SLAMet, m.SLAMet+m.SLABreached)
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// percent is part of whole in percent with one decimal, nil for an empty whole.
+func percent(part, whole int) *float64 {
+	if whole == 0 {
+		return nil
+	}
+	p := math.Round(float64(part)*1000/float64(whole)) / 10
+	return &p
+}
+
+// TechnicianMetrics returns the metrics of technician :id for ?from= to ?to=
+// (YYYY-MM-DD, default the last 30 days) to admins and the technician.
+func TechnicianMetrics(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	techID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidUserID)
+	}
+	if user.Role != "admin" && user.ID != techID {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+	from, to, err := dateRange(c)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	list, err := loadTechnicianMetrics(database, user.TenantID, techID, from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	if len(list) == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Technician not found")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    list[0],
+		"from":    from.Format("2006-01-02"),
+		"to":      to.AddDate(0, 0, -1).Format("2006-01-02"),
+	})
+}
+
+// leaderboardSorts maps ?sort= to the metric ranked and whether lower is better.
+var leaderboardSorts = map[string]struct {
+	value func(m models.TechnicianMetrics) *float64
+	asc   bool
+}{
+	"resolved":       {func(m models.TechnicianMetrics) *float64 { v := float64(m.Resolved); return &v }, false},
+	"reopen_rate":    {func(m models.TechnicianMetrics) *float64 { return m.ReopenRate }, true},
+	"first_response": {func(m models.TechnicianMetrics) *float64 { return m.AvgFirstResponseMinutes }, true},
+	"resolution":     {func(m models.TechnicianMetrics) *float64 { return m.AvgResolutionMinutes }, true},
+	"sla":            {func(m models.TechnicianMetrics) *float64 { return m.SLACompliance }, false},
+	"csat":           {func(m models.TechnicianMetrics) *float64 { return m.CSATAverage }, false},
+	"hours":          {func(m models.TechnicianMetrics) *float64 { return &m.HoursLogged }, false},
+	"visits":         {func(m models.TechnicianMetrics) *float64 { v := float64(m.OnsiteVisits); return &v }, false},
+}
+
+// TechnicianLeaderboard ranks the technicians by ?sort= (resolved by default,
+// or reopen_rate, first_response, resolution, sla, csat, hours, visits) for
+// ?from= to ?to=. Technicians without a value for the metric come last.
+func TechnicianLeaderboard(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	key := c.Query("sort", "resolved")
+	metric, ok := leaderboardSorts[key]
+	if !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "sort must be resolved, reopen_rate, first_response, resolution, sla, csat, hours or visits")
+	}
+	from, to, err := dateRange(c)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	list, err := loadTechnicianMetrics(database, admin.TenantID, 0, from, to)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := metric.value(list[i]), metric.value(list[j])
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		if metric.asc {
+			return *a < *b
+		}
+		return *a > *b
+	})
+	for i := range list {
+		list[i].Rank = i + 1
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    list,
+		"sort":    key,
+		"from":    from.Format("2006-01-02"),
+		"to":      to.AddDate(0, 0, -1).Format("2006-01-02"),
+	})
+}
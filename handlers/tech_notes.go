@@ -1,8 +1,8 @@
 package handlers
 
 import (
-	"encoding/json"
 	"ithelp/db"
+	"ithelp/events"
 	"ithelp/models"
 	"strconv"
 
@@ -10,9 +10,10 @@ import (
 )
 
 func AddTechNote(c *fiber.Ctx) error {
-	userJson := c.Locals("userJSON").(string)
-	var tech models.User
-	json.Unmarshal([]byte(userJson), &tech)
+	tech, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
 
 	if tech.Role != "tech" {
 		return fiber.NewError(fiber.StatusForbidden, "Only technicians allowed")
@@ -21,6 +22,7 @@ func AddTechNote(c *fiber.Ctx) error {
 	var input struct {
 		RequestID int    `json:"request_id"`
 		Note      string `json:"note"`
+		Internal  bool   `json:"internal"` // staff-only note instead of a reply to the customer
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -33,25 +35,41 @@ func AddTechNote(c *fiber.Ctx) error {
 	}
 	defer dbConn.Close()
 
-	query := `INSERT INTO tech_notes (request_id, technician_id, note) VALUES (?, ?, ?)`
-	_, err = dbConn.Exec(query, input.RequestID, tech.ID, input.Note)
+	if err := inTenant(dbConn, c, "support_requests", input.RequestID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO tech_notes (tenant_id, request_id, technician_id, note, internal) VALUES (?, ?, ?, ?, ?)`
+	_, err = dbConn.Exec(query, tech.TenantID, input.RequestID, tech.ID, input.Note, input.Internal)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
 	}
 
+	publishTicketEvent(dbConn, events.NoteAdded, input.RequestID, fiber.Map{"technician_id": tech.ID, "note": input.Note, "internal": input.Internal})
+
 	return c.JSON(fiber.Map{"success": true, "message": "Note added"})
 }
 
 func ListNotesByRequest(c *fiber.Ctx) error {
 	requestID, _ := strconv.Atoi(c.Params("id"))
 
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
 	dbConn, err := db.Connect()
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
 	}
 	defer dbConn.Close()
 
-	rows, err := dbConn.Query(`SELECT id, request_id, technician_id, note, created_at FROM tech_notes WHERE request_id = ?`, requestID)
+	// customers only see replies, not internal notes
+	query := `SELECT id, request_id, technician_id, note, internal, created_at FROM tech_notes WHERE request_id = ? AND tenant_id = ?`
+	if !isStaff(user) {
+		query += ` AND internal = 0`
+	}
+	rows, err := dbConn.Query(query, requestID, tenantID(c))
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
 	}
@@ -60,7 +78,7 @@ func ListNotesByRequest(c *fiber.Ctx) error {
 	var notes []models.TechNote
 	for rows.Next() {
 		var n models.TechNote
-		err := rows.Scan(&n.ID, &n.RequestID, &n.TechnicianID, &n.Note, &n.CreatedAt)
+		err := rows.Scan(&n.ID, &n.RequestID, &n.TechnicianID, &n.Note, &n.Internal, &n.CreatedAt)
 		if err != nil {
 			continue
 		}
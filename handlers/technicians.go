@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ithelp/db"
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const defaultMaxConcurrentTickets = 5
+
+// loadTechnicianProfile returns the profile of a tech user. Techs without a
+// profile row get the defaults: active, 5 concurrent tickets, no skills.
+func loadTechnicianProfile(database *sql.DB, userID int) (models.TechnicianProfile, error) {
+	var p models.TechnicianProfile
+	var status, bio sql.NullString
+	var maxTickets sql.NullInt64
+	err := database.QueryRow(`
+		SELECT u.id, u.name, u.phone, tp.status, tp.max_concurrent_tickets, tp.bio
+		FROM users u
+		LEFT JOIN technician_profiles tp ON tp.user_id = u.id
+		WHERE u.id = ? AND u.role = 'tech'
+	`, userID).Scan(&p.UserID, &p.Name, &p.Phone, &status, &maxTickets, &bio)
+	if err != nil {
+		return p, err
+	}
+
+	p.Status = models.TechStatusActive
+	if status.Valid {
+		p.Status = status.String
+	}
+	p.MaxConcurrentTickets = defaultMaxConcurrentTickets
+	if maxTickets.Valid {
+		p.MaxConcurrentTickets = int(maxTickets.Int64)
+	}
+	p.Bio = bio.String
+
+	p.Skills = []string{}
+	rows, err := database.Query(`SELECT category FROM technician_skills WHERE user_id = ? ORDER BY category`, userID)
+	if err != nil {
+		return p, err
+	}
+	for rows.Next() {
+		var s string
+		if rows.Scan(&s) == nil {
+			p.Skills = append(p.Skills, s)
+		}
+	}
+	rows.Close()
+
+	p.Regions = []string{}
+	rows, err = database.Query(`SELECT region FROM technician_regions WHERE user_id = ? ORDER BY region`, userID)
+	if err != nil {
+		return p, err
+	}
+	for rows.Next() {
+		var r string
+		if rows.Scan(&r) == nil {
+			p.Regions = append(p.Regions, r)
+		}
+	}
+	rows.Close()
+
+	p.WorkingHours, err = techWorkingHours(database, userID)
+	if err != nil {
+		return p, err
+	}
+
+	err = database.QueryRow(`SELECT COUNT(*) FROM support_requests WHERE assigned_to = ? AND status NOT IN (?, ?)`,
+		userID, models.StatusResolved, models.StatusClosed).Scan(&p.OpenTickets)
+	return p, err
+}
+
+func techWorkingHours(database *sql.DB, userID int) ([]models.WorkingHours, error) {
+	hours := []models.WorkingHours{}
+	rows, err := database.Query(`
+		SELECT weekday, TIME_FORMAT(start_time, '%H:%i'), TIME_FORMAT(end_time, '%H:%i')
+		FROM technician_working_hours WHERE user_id = ? ORDER BY weekday
+	`, userID)
+	if err != nil {
+		return hours, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h models.WorkingHours
+		if rows.Scan(&h.Weekday, &h.StartTime, &h.EndTime) == nil {
+			hours = append(hours, h)
+		}
+	}
+	return hours, nil
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// canTake reports why a technician cannot take a ticket of the given category
+// and region, or "" when they can. Empty skills/regions mean "any".
+func canTake(p models.TechnicianProfile, category, region string) string {
+	if p.Status != models.TechStatusActive {
+		return "Technician is not active"
+	}
+	if p.OpenTickets >= p.MaxConcurrentTickets {
+		return "Technician has reached the maximum number of open tickets"
+	}
+	if category != "" && len(p.Skills) > 0 && !containsFold(p.Skills, category) {
+		return "Technician has no skill for category " + category
+	}
+	if region != "" && len(p.Regions) > 0 && !containsFold(p.Regions, region) {
+		return "Technician does not serve region " + region
+	}
+	return ""
+}
+
+// checkTechnicianAssignable is used before a ticket is (re)assigned.
+func checkTechnicianAssignable(database *sql.DB, techID int, requestID int) error {
+	p, err := loadTechnicianProfile(database, techID)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusBadRequest, "Assigned user is not a technician")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+
+	var category, region string
+	var sameTenant bool
+	err = database.QueryRow(`
+		SELECT s.category, COALESCE(s.region, ''), s.tenant_id = u.tenant_id
+		FROM support_requests s JOIN users u ON u.id = ?
+		WHERE s.id = ?`, techID, requestID).Scan(&category, &region, &sameTenant)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Request not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+
+	if !sameTenant {
+		return fiber.NewError(fiber.StatusBadRequest, "Assigned user is not a technician")
+	}
+
+	if reason := canTake(p, category, region); reason != "" {
+		return fiber.NewError(fiber.StatusConflict, reason)
+	}
+	return nil
+}
+
+// ListTechnicians is admin only. Filters: ?status=, ?category=, ?region=,
+// ?available=true (only techs that can take a ticket of that category/region,
+// least loaded first).
+func ListTechnicians(c *fiber.Ctx) error {
+	if _, err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`SELECT id FROM users WHERE role = 'tech' AND tenant_id = ? ORDER BY name`, tenantID(c))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	status := c.Query("status")
+	category := c.Query("category")
+	region := c.Query("region")
+	available := c.QueryBool("available")
+
+	techs := []models.TechnicianProfile{}
+	for _, id := range ids {
+		p, err := loadTechnicianProfile(database, id)
+		if err != nil {
+			continue
+		}
+		if status != "" && p.Status != status {
+			continue
+		}
+		if available {
+			if canTake(p, category, region) != "" {
+				continue
+			}
+		} else {
+			if category != "" && !containsFold(p.Skills, category) {
+				continue
+			}
+			if region != "" && !containsFold(p.Regions, region) {
+				continue
+			}
+		}
+		techs = append(techs, p)
+	}
+
+	if available {
+		sort.SliceStable(techs, func(i, j int) bool {
+			return techs[i].OpenTickets < techs[j].OpenTickets
+		})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": techs})
+}
+
+// GetTechnician returns a profile to admins and to the technician themselves.
+func GetTechnician(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidUserID)
+	}
+	if user.Role != "admin" && user.ID != id {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := inTenant(database, c, "users", id); err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Technician not found")
+	}
+
+	p, err := loadTechnicianProfile(database, id)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Technician not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": p})
+}
+
+// UpdateTechnicianProfile replaces the profile, skills, regions and working hours of a tech.
+func UpdateTechnicianProfile(c *fiber.Ctx) error {
+	if _, err := requireAdmin(c); err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidUserID)
+	}
+
+	var input struct {
+		Status               string                `json:"status"`
+		MaxConcurrentTickets int                   `json:"max_concurrent_tickets"`
+		Bio                  string                `json:"bio"`
+		Skills               []string              `json:"skills"`
+		Regions              []string              `json:"regions"`
+		WorkingHours         []models.WorkingHours `json:"working_hours"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+
+	switch input.Status {
+	case "":
+		input.Status = models.TechStatusActive
+	case models.TechStatusActive, models.TechStatusOnLeave, models.TechStatusInactive:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid status")
+	}
+	if input.MaxConcurrentTickets <= 0 {
+		input.MaxConcurrentTickets = defaultMaxConcurrentTickets
+	}
+	for _, h := range input.WorkingHours {
+		start, err1 := time.Parse("15:04", h.StartTime)
+		end, err2 := time.Parse("15:04", h.EndTime)
+		if h.Weekday < 0 || h.Weekday > 6 || err1 != nil || err2 != nil || !end.After(start) {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid working hours")
+		}
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var isTech bool
+	database.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = ? AND role = 'tech' AND tenant_id = ?)`, id, tenantID(c)).Scan(&isTech)
+	if !isTech {
+		return fiber.NewError(fiber.StatusNotFound, "Technician not found")
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO technician_profiles (user_id, status, max_concurrent_tickets, bio) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE status = VALUES(status), max_concurrent_tickets = VALUES(max_concurrent_tickets), bio = VALUES(bio)`,
+		id, input.Status, input.MaxConcurrentTickets, input.Bio)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	for _, table := range []string{"technician_skills", "technician_regions", "technician_working_hours"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, id); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+		}
+	}
+	for _, s := range input.Skills {
+		if _, err := tx.Exec(`INSERT IGNORE INTO technician_skills (user_id, category) VALUES (?, ?)`, id, strings.TrimSpace(s)); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+		}
+	}
+	for _, r := range input.Regions {
+		if _, err := tx.Exec(`INSERT IGNORE INTO technician_regions (user_id, region) VALUES (?, ?)`, id, strings.TrimSpace(r)); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+		}
+	}
+	for _, h := range input.WorkingHours {
+		if _, err := tx.Exec(`REPLACE INTO technician_working_hours (user_id, weekday, start_time, end_time) VALUES (?, ?, ?, ?)`,
+			id, h.Weekday, h.StartTime, h.EndTime); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Technician profile updated"})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+
+	"ithelp/models"
+	"ithelp/tenants"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// tenantID returns the tenant the request resolved to. Every query on tenant
+// data is filtered by it.
+func tenantID(c *fiber.Ctx) int {
+	if t, ok := c.Locals("tenant").(models.Tenant); ok {
+		return t.ID
+	}
+	if user, ok := currentUser(c); ok && user.TenantID != 0 {
+		return user.TenantID
+	}
+	return tenants.DefaultID
+}
+
+// tenantResources maps every resource that can be addressed by id to the
+// query returning its tenant. Tables without a tenant_id column are resolved
+// through the ticket or user they belong to.
+var tenantResources = map[string]string{
+	"users":             `SELECT tenant_id FROM users WHERE id = ?`,
+	"support_requests":  `SELECT tenant_id FROM support_requests WHERE id = ?`,
+	"plans":             `SELECT tenant_id FROM plans WHERE id = ?`,
+	"tech_notes":        `SELECT tenant_id FROM tech_notes WHERE id = ?`,
+	"organizations":     `SELECT tenant_id FROM organizations WHERE id = ?`,
+	"webhook_endpoints": `SELECT tenant_id FROM webhook_endpoints WHERE id = ?`,
+	"webhook_deliveries": `SELECT e.tenant_id FROM webhook_deliveries d
+		JOIN webhook_endpoints e ON e.id = d.endpoint_id WHERE d.id = ?`,
+	"parts":                `SELECT tenant_id FROM parts WHERE id = ?`,
+	"stock_locations":      `SELECT tenant_id FROM stock_locations WHERE id = ?`,
+	"recurring_tickets":    `SELECT tenant_id FROM recurring_tickets WHERE id = ?`,
+	"report_subscriptions": `SELECT tenant_id FROM report_subscriptions WHERE id = ?`,
+	"appointments": `SELECT s.tenant_id FROM appointments a
+		JOIN support_requests s ON s.id = a.request_id WHERE a.id = ?`,
+	"time_entries": `SELECT s.tenant_id FROM time_entries t
+		JOIN support_requests s ON s.id = t.request_id WHERE t.id = ?`,
+	"work_orders": `SELECT s.tenant_id FROM work_orders w
+		JOIN support_requests s ON s.id = w.request_id WHERE w.id = ?`,
+	"invoices": `SELECT u.tenant_id FROM invoices i
+		JOIN users u ON u.id = i.user_id WHERE i.id = ?`,
+	"assets": `SELECT u.tenant_id FROM assets a
+		JOIN users u ON u.id = a.user_id WHERE a.id = ?`,
+}
+
+// inTenant makes a resource of another tenant look like it does not exist.
+// Handlers call it before acting on an id taken from the request.
+func inTenant(database *sql.DB, c *fiber.Ctx, resource string, id int) error {
+	return resourceInTenant(database, tenantID(c), resource, id)
+}
+
+// resourceInTenant is inTenant for helpers that only have the caller's user.
+func resourceInTenant(database *sql.DB, tenant int, resource string, id int) error {
+	query, ok := tenantResources[resource]
+	if !ok {
+		log.Printf("resourceInTenant: no tenant lookup for %q", resource)
+		return fiber.NewError(fiber.StatusInternalServerError, "Unknown resource")
+	}
+
+	var owner int
+	err := database.QueryRow(query, id).Scan(&owner)
+	if err == sql.ErrNoRows || (err == nil && owner != tenant) {
+		return fiber.NewError(fiber.StatusNotFound, "Not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ownerDriver answers the tenant lookups of tenantResources from owners:
+// resource -> id -> tenant.
+type ownerDriver struct{}
+
+var owners = map[string]map[int64]int64{}
+
+func (ownerDriver) Open(string) (driver.Conn, error) { return ownerConn{}, nil }
+
+type ownerConn struct{}
+
+func (ownerConn) Prepare(query string) (driver.Stmt, error) {
+	for resource, q := range tenantResources {
+		if q == query {
+			return ownerStmt{resource}, nil
+		}
+	}
+	return nil, errors.New("unexpected query: " + query)
+}
+func (ownerConn) Close() error              { return nil }
+func (ownerConn) Begin() (driver.Tx, error) { return nil, errors.New("no transactions") }
+
+type ownerStmt struct{ resource string }
+
+func (ownerStmt) Close() error  { return nil }
+func (ownerStmt) NumInput() int { return 1 }
+func (ownerStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("read only")
+}
+func (s ownerStmt) Query(args []driver.Value) (driver.Rows, error) {
+	tenant, ok := owners[s.resource][args[0].(int64)]
+	return &ownerRows{tenant: tenant, done: !ok}, nil
+}
+
+type ownerRows struct {
+	tenant int64
+	done   bool
+}
+
+func (*ownerRows) Columns() []string { return []string{"tenant_id"} }
+func (*ownerRows) Close() error      { return nil }
+func (r *ownerRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	dest[0], r.done = r.tenant, true
+	return nil
+}
+
+func init() {
+	sql.Register("owners", ownerDriver{})
+}
+
+func ownerDB(t *testing.T) *sql.DB {
+	t.Helper()
+	owners = map[string]map[int64]int64{
+		"support_requests": {10: 2, 11: 3},
+		"users":            {20: 2, 21: 3},
+		"invoices":         {30: 2, 31: 3},
+		"appointments":     {40: 3},
+	}
+	database, err := sql.Open("owners", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func statusOf(err error) int {
+	if err == nil {
+		return fiber.StatusOK
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fe.Code
+	}
+	return -1
+}
+
+func TestResourceInTenant(t *testing.T) {
+	database := ownerDB(t)
+
+	tests := []struct {
+		name     string
+		tenant   int
+		resource string
+		id       int
+		want     int
+	}{
+		{"own ticket", 2, "support_requests", 10, fiber.StatusOK},
+		{"ticket of another tenant", 2, "support_requests", 11, fiber.StatusNotFound},
+		{"ticket of another tenant, other way round", 3, "support_requests", 10, fiber.StatusNotFound},
+		{"missing ticket", 2, "support_requests", 99, fiber.StatusNotFound},
+		{"own user", 3, "users", 21, fiber.StatusOK},
+		{"user of another tenant", 3, "users", 20, fiber.StatusNotFound},
+		{"invoice of another tenant", 2, "invoices", 31, fiber.StatusNotFound},
+		{"appointment of another tenant", 2, "appointments", 40, fiber.StatusNotFound},
+		{"unknown resource", 2, "no_such_table", 10, fiber.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := resourceInTenant(database, tt.tenant, tt.resource, tt.id)
+			if got := statusOf(err); got != tt.want {
+				t.Errorf("resourceInTenant(%d, %q, %d) = %v, want status %d", tt.tenant, tt.resource, tt.id, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInTenantUsesRequestTenant(t *testing.T) {
+	database := ownerDB(t)
+
+	tests := []struct {
+		name   string
+		tenant *models.Tenant // resolved from the host
+		user   *models.User   // from the token
+		id     int
+		want   int
+	}{
+		{"resolved tenant owns the ticket", &models.Tenant{ID: 2}, nil, 10, fiber.StatusOK},
+		{"resolved tenant does not own the ticket", &models.Tenant{ID: 2}, nil, 11, fiber.StatusNotFound},
+		{"token tenant without resolved tenant", nil, &models.User{ID: 5, TenantID: 3}, 11, fiber.StatusOK},
+		{"token tenant, ticket of another tenant", nil, &models.User{ID: 5, TenantID: 3}, 10, fiber.StatusNotFound},
+		{"default tenant owns neither", nil, nil, 10, fiber.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/tickets/:id", func(c *fiber.Ctx) error {
+				if tt.tenant != nil {
+					c.Locals("tenant", *tt.tenant)
+				}
+				if tt.user != nil {
+					c.Locals("user", *tt.user)
+				}
+				id, _ := strconv.Atoi(c.Params("id"))
+				if err := inTenant(database, c, "support_requests", id); err != nil {
+					return err
+				}
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/tickets/"+strconv.Itoa(tt.id), nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+// handlerFuncs parses the package and returns its top-level functions by name.
+func handlerFuncs(t *testing.T) map[string]*ast.FuncDecl {
+	t.Helper()
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs := map[string]*ast.FuncDecl{}
+	for _, f := range pkgs["handlers"].Files {
+		for _, d := range f.Decls {
+			if fn, ok := d.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Body != nil {
+				funcs[fn.Name.Name] = fn
+			}
+		}
+	}
+	return funcs
+}
+
+func TestTenantResourceKeysExist(t *testing.T) {
+	for name, fn := range handlerFuncs(t) {
+		if name == "inTenant" {
+			continue // passes its caller's resource on
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			callee, ok := call.Fun.(*ast.Ident)
+			if !ok || (callee.Name != "inTenant" && callee.Name != "resourceInTenant") || len(call.Args) < 3 {
+				return true
+			}
+			lit, ok := call.Args[2].(*ast.BasicLit)
+			if !ok {
+				t.Errorf("%s: %s must be called with a literal resource", name, callee.Name)
+				return true
+			}
+			if key, _ := strconv.Unquote(lit.Value); tenantResources[key] == "" {
+				t.Errorf("%s: %s(%s) has no entry in tenantResources", name, callee.Name, lit.Value)
+			}
+			return true
+		})
+	}
+}
+
+// unscopedByDesign are handlers that take an id from the path but are not
+// tenant data lookups.
+var unscopedByDesign = map[string]string{
+	"GetTenant":            "superadmins manage all tenants",
+	"UpdateTenant":         "superadmins manage all tenants",
+	"TechnicianCalendar":   "the unguessable calendar token is the credential",
+	"surveyFromToken":      "the signed survey token is the credential",
+	"MarkNotificationRead": "notifications are filtered by the caller's user id",
+	"ResolveSuggestion":    "suggestions are filtered by the caller's user id",
+	"ExportReport":         ":name picks a report builder, which filters by tenant",
+}
+
+// TestHandlersScopeIDsToTenant fails when a function reads an id from the
+// path without reaching a tenant check: a query filtering on tenant_id, or a
+// call of inTenant, resourceInTenant or a helper that does either. Any
+// tenant_id query counts, so ids taken from the body, or a second id next to
+// the path's, need tests of their own like TestVisitTechnicianStaysInTenant.
+func TestHandlersScopeIDsToTenant(t *testing.T) {
+	funcs := handlerFuncs(t)
+
+	type facts struct {
+		params bool
+		calls  []string
+	}
+	info := map[string]facts{}
+	scoped := map[string]bool{"inTenant": true, "resourceInTenant": true}
+	for name, fn := range funcs {
+		var f facts
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				if sel, ok := n.Fun.(*ast.SelectorExpr); ok && (sel.Sel.Name == "Params" || sel.Sel.Name == "ParamsInt") {
+					f.params = true
+				}
+				if id, ok := n.Fun.(*ast.Ident); ok {
+					f.calls = append(f.calls, id.Name)
+				}
+			case *ast.BasicLit:
+				if n.Kind == token.STRING && strings.Contains(n.Value, "tenant_id") {
+					scoped[name] = true
+				}
+			}
+			return true
+		})
+		info[name] = f
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, f := range info {
+			if scoped[name] {
+				continue
+			}
+			for _, callee := range f.calls {
+				if scoped[callee] {
+					scoped[name], changed = true, true
+					break
+				}
+			}
+		}
+	}
+
+	for name, f := range info {
+		if f.params && !scoped[name] && unscopedByDesign[name] == "" {
+			t.Errorf("%s reads a path parameter but never checks the tenant", name)
+		}
+	}
+	for name := range unscopedByDesign {
+		if _, ok := funcs[name]; !ok {
+			t.Errorf("unscopedByDesign lists %s, which no longer exists", name)
+		}
+	}
+}
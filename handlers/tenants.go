@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"ithelp/db"
+	"ithelp/models"
+	"ithelp/tenants"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var tenantSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// requireSuperAdmin allows platform operators only. Super-admins live in the
+// default tenant and are never created through the API.
+func requireSuperAdmin(c *fiber.Ctx) (models.User, error) {
+	user, ok := currentUser(c)
+	if !ok {
+		return user, fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	if user.Role != "superadmin" {
+		return user, fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+	return user, nil
+}
+
+type tenantInput struct {
+	Name         string `json:"name"`
+	Domain       string `json:"domain"`
+	BrandName    string `json:"brand_name"`
+	LogoURL      string `json:"logo_url"`
+	PrimaryColor string `json:"primary_color"`
+	SupportEmail string `json:"support_email"`
+	SupportPhone string `json:"support_phone"`
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func ListTenants(c *fiber.Ctx) error {
+	if _, err := requireSuperAdmin(c); err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`SELECT ` + tenants.Columns() + ` FROM tenants ORDER BY id`)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	list := []models.Tenant{}
+	for rows.Next() {
+		t, err := tenants.Scan(rows)
+		if err != nil {
+			continue
+		}
+		list = append(list, t)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": list})
+}
+
+func GetTenant(c *fiber.Ctx) error {
+	if _, err := requireSuperAdmin(c); err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid tenant ID")
+	}
+
+	t, err := tenants.ByID(id)
+	if err == tenants.ErrUnknown {
+		return fiber.NewError(fiber.StatusNotFound, "Tenant not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": t})
+}
+
+// CreateTenant provisions a partner: the tenant row, its first admin and,
+// unless copy_plans is false, a copy of the default tenant's plans.
+func CreateTenant(c *fiber.Ctx) error {
+	if _, err := requireSuperAdmin(c); err != nil {
+		return err
+	}
+
+	var input struct {
+		tenantInput
+		Slug      string `json:"slug"`
+		CopyPlans *bool  `json:"copy_plans"`
+		Admin     struct {
+			Name     string `json:"name"`
+			Phone    string `json:"phone"`
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		} `json:"admin"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	input.Slug = strings.ToLower(strings.TrimSpace(input.Slug))
+	if !tenantSlugPattern.MatchString(input.Slug) || input.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Valid slug and name are required")
+	}
+	if input.Admin.Name == "" || input.Admin.Phone == "" || input.Admin.Password == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Admin name, phone and password are required")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Admin.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Password hashing error")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var exists bool
+	err = database.QueryRow(`SELECT EXISTS(SELECT 1 FROM tenants WHERE slug = ? OR (domain IS NOT NULL AND domain = ?))`,
+		input.Slug, strings.ToLower(input.Domain)).Scan(&exists)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if exists {
+		return fiber.NewError(fiber.StatusConflict, "Slug or domain already in use")
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO tenants (slug, name, domain, brand_name, logo_url, primary_color, support_email, support_phone)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		input.Slug, input.Name, nullIfEmpty(strings.ToLower(input.Domain)), nullIfEmpty(input.BrandName),
+		nullIfEmpty(input.LogoURL), nullIfEmpty(input.PrimaryColor), nullIfEmpty(input.SupportEmail), nullIfEmpty(input.SupportPhone))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	id, _ := result.LastInsertId()
+
+	result, err = tx.Exec(`INSERT INTO users (name, phone, email, password_hash, role, tenant_id) VALUES (?, ?, ?, ?, 'admin', ?)`,
+		input.Admin.Name, input.Admin.Phone, nullIfEmpty(input.Admin.Email), string(hash), id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create admin")
+	}
+	adminID, _ := result.LastInsertId()
+
+	if input.CopyPlans == nil || *input.CopyPlans {
+		_, err = tx.Exec(`
+			INSERT INTO plans (tenant_id, name, price, remote_calls, onsite_calls)
+			SELECT ?, name, price, remote_calls, onsite_calls FROM plans WHERE tenant_id = ?`,
+			id, tenants.DefaultID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to copy plans")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Tenant created", "id": id, "admin_id": adminID})
+}
+
+// UpdateTenant changes branding, domain and the active flag. The slug is
+// fixed because partners' API clients send it in the X-Tenant header.
+func UpdateTenant(c *fiber.Ctx) error {
+	if _, err := requireSuperAdmin(c); err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid tenant ID")
+	}
+
+	var input struct {
+		tenantInput
+		Active *bool `json:"active"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+	if input.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Name is required")
+	}
+	if id == tenants.DefaultID && input.Active != nil && !*input.Active {
+		return fiber.NewError(fiber.StatusBadRequest, "The default tenant cannot be suspended")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if _, err := tenants.ByID(id); err == tenants.ErrUnknown {
+		return fiber.NewError(fiber.StatusNotFound, "Tenant not found")
+	} else if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+
+	var taken bool
+	database.QueryRow(`SELECT EXISTS(SELECT 1 FROM tenants WHERE domain = ? AND id <> ?)`,
+		strings.ToLower(input.Domain), id).Scan(&taken)
+	if taken {
+		return fiber.NewError(fiber.StatusConflict, "Domain already in use")
+	}
+
+	_, err = database.Exec(`
+		UPDATE tenants SET name = ?, domain = ?, brand_name = ?, logo_url = ?, primary_color = ?,
+			support_email = ?, support_phone = ?, active = COALESCE(?, active)
+		WHERE id = ?`,
+		input.Name, nullIfEmpty(strings.ToLower(input.Domain)), nullIfEmpty(input.BrandName), nullIfEmpty(input.LogoURL),
+		nullIfEmpty(input.PrimaryColor), nullIfEmpty(input.SupportEmail), nullIfEmpty(input.SupportPhone), input.Active, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+	tenants.Forget(id)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Tenant updated"})
+}
+
+// GetBranding is public: the web and mobile apps call it before login to
+// theme themselves for the tenant the host name resolved to.
+func GetBranding(c *fiber.Ctx) error {
+	t, ok := c.Locals("tenant").(models.Tenant)
+	if !ok {
+		var err error
+		if t, err = tenants.ByID(tenants.DefaultID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+		}
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": fiber.Map{
+		"slug":          t.Slug,
+		"name":          t.DisplayName(),
+		"logo_url":      t.LogoURL,
+		"primary_color": t.PrimaryColor,
+		"support_email": t.SupportEmail,
+		"support_phone": t.SupportPhone,
+	}})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ticketFilter selects support requests of a tenant. The ticket listing reads
+// it from the query string, bulk operations from the request body.
+type ticketFilter struct {
+	Status     string `json:"status"`
+	AssignedTo int    `json:"assigned_to"`
+	Unassigned bool   `json:"unassigned"`
+	CategoryID int    `json:"category_id"` // includes subcategories
+	Priority   string `json:"priority"`
+	Region     string `json:"region"`
+	Overdue    bool   `json:"overdue"` // open tickets past their SLA
+
+	Tags           []string `json:"tags"`             // requests having all of them
+	Onsite         *bool    `json:"onsite"`           // with or without an onsite visit
+	OlderThanHours int      `json:"older_than_hours"` // created before now minus this
+}
+
+// params are query-string values, from a request or stored with a report
+// subscription. Invalid numbers and booleans read as zero, like fiber's
+// QueryInt and QueryBool.
+type params map[string]string
+
+func (p params) Int(key string) int {
+	v, _ := strconv.Atoi(p[key])
+	return v
+}
+
+func (p params) Bool(key string) bool {
+	v, _ := strconv.ParseBool(p[key])
+	return v
+}
+
+func filterFromParams(p params) ticketFilter {
+	f := ticketFilter{
+		Status:     p["status"],
+		AssignedTo: p.Int("assigned_to"),
+		Unassigned: p.Bool("unassigned"),
+		CategoryID: p.Int("category_id"),
+		Priority:   p["priority"],
+		Region:     p["region"],
+		Overdue:    p.Bool("overdue"),
+
+		OlderThanHours: p.Int("older_than_hours"),
+	}
+	if tags := p["tag"]; tags != "" {
+		f.Tags = strings.Split(tags, ",")
+	}
+	if onsite := p["onsite"]; onsite != "" {
+		v := p.Bool("onsite")
+		f.Onsite = &v
+	}
+	return f
+}
+
+// listingFilter is the filter and sort of the ticket listing: the filters in
+// p, or the stored filter of ?view_id=, whose sort ?sort= and ?order= override.
+func listingFilter(database *sql.DB, user models.User, p params) (ticketFilter, string, string, error) {
+	filter := filterFromParams(p)
+	sort, order := p["sort"], p["order"]
+	if viewID := p.Int("view_id"); viewID != 0 {
+		view, err := loadView(database, user, viewID)
+		if err != nil {
+			return filter, "", "", err
+		}
+		filter = viewFilter(user, view)
+		if sort == "" {
+			sort, order = view.Sort, view.Order
+		}
+	}
+	return filter, sort, order, nil
+}
+
+// where returns the conditions for support_requests of the tenant, to be
+// appended after WHERE.
+func (f ticketFilter) where(database *sql.DB, tenant int) (string, []any, error) {
+	where := "tenant_id = ?"
+	args := []any{tenant}
+	if f.Status != "" {
+		where += " AND status = ?"
+		args = append(args, f.Status)
+	}
+	if f.AssignedTo != 0 {
+		where += " AND assigned_to = ?"
+		args = append(args, f.AssignedTo)
+	}
+	if f.Unassigned {
+		where += " AND assigned_to IS NULL"
+	}
+	if f.CategoryID != 0 {
+		tree, err := loadCategoryTree(database, tenant)
+		if err != nil {
+			return "", nil, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+		}
+		ids := tree.descendants(f.CategoryID)
+		if len(ids) == 0 {
+			return "", nil, fiber.NewError(fiber.StatusNotFound, "Category not found")
+		}
+		where += " AND category_id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	if f.Priority != "" {
+		where += " AND priority = ?"
+		args = append(args, f.Priority)
+	}
+	if f.Region != "" {
+		where += " AND region = ?"
+		args = append(args, f.Region)
+	}
+	if f.Overdue {
+		where += " AND due_at < NOW() AND status NOT IN (?, ?)"
+		args = append(args, models.StatusResolved, models.StatusClosed)
+	}
+	tags, err := normalizeTags(f.Tags)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, t := range tags {
+		where += " AND id IN (SELECT request_id FROM ticket_tags WHERE tag = ?)"
+		args = append(args, t)
+	}
+	if f.Onsite != nil {
+		not := ""
+		if !*f.Onsite {
+			not = "NOT "
+		}
+		where += " AND id " + not + "IN (SELECT request_id FROM appointments WHERE status <> 'cancelled')"
+	}
+	if f.OlderThanHours > 0 {
+		where += " AND created_at < NOW() - INTERVAL ? HOUR"
+		args = append(args, f.OlderThanHours)
+	}
+	return where, args, nil
+}
+
+// ticketSorts are the columns tickets can be ordered by.
+var ticketSorts = map[string]string{
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"due_at":     "due_at IS NULL, due_at",                             // tickets without SLA last
+	"priority":   "FIELD(priority, 'low', 'normal', 'high', 'urgent')", // desc is most urgent first
+	"status":     "status",
+}
+
+// orderBy builds the ORDER BY clause for a sort key and asc/desc (default desc).
+func orderBy(sort, order string) (string, error) {
+	if sort == "" {
+		return "", nil
+	}
+	column, ok := ticketSorts[sort]
+	if !ok {
+		return "", fiber.NewError(fiber.StatusBadRequest, "sort must be created_at, updated_at, due_at, priority or status")
+	}
+	switch order {
+	case "", "desc":
+		order = "DESC"
+	case "asc":
+		order = "ASC"
+	default:
+		return "", fiber.NewError(fiber.StatusBadRequest, "order must be asc or desc")
+	}
+	return " ORDER BY " + column + " " + order + ", id " + order, nil
+}
@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"ithelp/db"
+	"ithelp/events"
+	"ithelp/models"
+	"ithelp/surveys"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const defaultReopenDays = 7
+
+// reopenWindow is how long after resolution customers may reopen a ticket
+// (TICKET_REOPEN_DAYS).
+func reopenWindow() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("TICKET_REOPEN_DAYS"))
+	if err != nil || days < 0 {
+		days = defaultReopenDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func recordHistory(database execer, requestID, actorID int, action string, from, to *string, detail string) {
+	var actor *int
+	if actorID != 0 {
+		actor = &actorID
+	}
+	var d *string
+	if detail != "" {
+		d = &detail
+	}
+	database.Exec(`INSERT INTO ticket_history (request_id, actor_id, action, from_status, to_status, detail) VALUES (?, ?, ?, ?, ?, ?)`,
+		requestID, actor, action, from, to, d)
+}
+
+// recordStatusChange logs a status change and stamps resolved_at, which the
+// reopen window is measured from.
+func recordStatusChange(database execer, requestID, actorID int, oldStatus, newStatus string) {
+	recordHistory(database, requestID, actorID, "status", &oldStatus, &newStatus, "")
+	if newStatus != models.StatusResolved {
+		return
+	}
+	database.Exec(`UPDATE support_requests SET resolved_at = NOW() WHERE id = ?`, requestID)
+
+	surveyID, err := surveys.Create(database, requestID)
+	if err != nil {
+		log.Printf("surveys: survey for request %d failed: %v", requestID, err)
+		return
+	}
+	// inside a transaction the survey waits for the commit and the surveys worker
+	if _, inTx := database.(*sql.Tx); surveyID != 0 && !inTx {
+		go func() {
+			if err := surveys.Deliver(surveyID); err != nil {
+				log.Printf("surveys: survey %d failed: %v", surveyID, err)
+			}
+		}()
+	}
+}
+
+// ticketAccess checks the caller may see the ticket: admins of the tenant,
+// the owner (or an org admin of the organization it was filed for) and the
+// assigned technician.
+func ticketAccess(database *sql.DB, c *fiber.Ctx, user models.User, id int) (ownerID int, assignedTo *int, err error) {
+	err = database.QueryRow(`SELECT user_id, assigned_to FROM support_requests WHERE id = ? AND tenant_id = ?`, id, tenantID(c)).
+		Scan(&ownerID, &assignedTo)
+	if err == sql.ErrNoRows {
+		return 0, nil, fiber.NewError(fiber.StatusNotFound, "Request not found")
+	}
+	if err != nil {
+		return 0, nil, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if user.Role != "admin" && !canManageTicket(database, user, id) && (assignedTo == nil || *assignedTo != user.ID) {
+		return 0, nil, fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+	return ownerID, assignedTo, nil
+}
+
+// GetSupportRequest returns a ticket with its links, merged duplicates and history.
+func GetSupportRequest(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if _, _, err := ticketAccess(database, c, user, id); err != nil {
+		return err
+	}
+
+	var r models.SupportRequest
+	var customFields []byte
+	err = database.QueryRow(`
+		SELECT id, user_id, title, description, category, status, assigned_to, COALESCE(region, ''), asset_id,
+			category_id, priority, due_at, custom_fields, resolved_at, reopen_count, merged_into, created_at, updated_at
+		FROM support_requests WHERE id = ?`, id).
+		Scan(&r.ID, &r.UserID, &r.Title, &r.Description, &r.Category, &r.Status, &r.AssignedTo, &r.Region, &r.AssetID,
+			&r.CategoryID, &r.Priority, &r.DueAt, &customFields, &r.ResolvedAt, &r.ReopenCount, &r.MergedInto, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	json.Unmarshal(customFields, &r.CustomFields)
+	r.Tags = loadTags(database, id)
+
+	// a parent link reads "parent" from the child and "child" from the parent
+	links := []models.TicketLink{}
+	rows, err := database.Query(`
+		SELECT l.id, s.id, CASE WHEN l.type = 'related' THEN 'related' WHEN l.request_id = ? THEN 'parent' ELSE 'child' END,
+			s.title, s.status, l.created_at
+		FROM ticket_links l
+		JOIN support_requests s ON s.id = IF(l.request_id = ?, l.linked_request_id, l.request_id)
+		WHERE l.request_id = ? OR l.linked_request_id = ?
+		ORDER BY l.id`, id, id, id, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	for rows.Next() {
+		var l models.TicketLink
+		if err := rows.Scan(&l.ID, &l.RequestID, &l.Type, &l.Title, &l.Status, &l.CreatedAt); err == nil {
+			links = append(links, l)
+		}
+	}
+	rows.Close()
+
+	merged := []int{}
+	rows, err = database.Query(`SELECT id FROM support_requests WHERE merged_into = ? ORDER BY id`, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	for rows.Next() {
+		var mergedID int
+		if rows.Scan(&mergedID) == nil {
+			merged = append(merged, mergedID)
+		}
+	}
+	rows.Close()
+
+	history := []models.TicketHistory{}
+	rows, err = database.Query(`
+		SELECT id, actor_id, action, from_status, to_status, detail, created_at
+		FROM ticket_history WHERE request_id = ? ORDER BY id`, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h models.TicketHistory
+		if err := rows.Scan(&h.ID, &h.ActorID, &h.Action, &h.FromStatus, &h.ToStatus, &h.Detail, &h.CreatedAt); err == nil {
+			history = append(history, h)
+		}
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": r, "links": links, "merged": merged, "history": history})
+}
+
+// ReopenSupportRequest sends a resolved ticket back to work. Customers can do
+// it within reopenWindow of the resolution, admins at any time.
+func ReopenSupportRequest(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request ID")
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	c.BodyParser(&input)
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if _, _, err := ticketAccess(database, c, user, id); err != nil {
+		return err
+	}
+	if user.Role != "admin" && !canManageTicket(database, user, id) {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+
+	var status string
+	var resolvedAt *time.Time
+	var mergedInto *int
+	database.QueryRow(`SELECT status, resolved_at, merged_into FROM support_requests WHERE id = ?`, id).Scan(&status, &resolvedAt, &mergedInto)
+	if mergedInto != nil {
+		return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Request was merged into #%d", *mergedInto))
+	}
+	if status != models.StatusResolved {
+		return fiber.NewError(fiber.StatusConflict, "Only resolved requests can be reopened")
+	}
+	if user.Role != "admin" && (resolvedAt == nil || time.Since(*resolvedAt) > reopenWindow()) {
+		return fiber.NewError(fiber.StatusConflict, "The reopen period for this request has passed, please create a new request")
+	}
+
+	result, err := database.Exec(`
+		UPDATE support_requests SET status = ?, resolved_at = NULL, reopen_count = reopen_count + 1
+		WHERE id = ? AND status = ?`, models.StatusReopened, id, models.StatusResolved)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusConflict, "Only resolved requests can be reopened")
+	}
+	from, to := models.StatusResolved, models.StatusReopened
+	recordHistory(database, id, user.ID, "reopened", &from, &to, input.Reason)
+
+	publishTicketEvent(database, events.TicketUpdated, id, fiber.Map{"status": models.StatusReopened})
+	publishTicketEvent(database, events.TicketStatusChanged, id, fiber.Map{"old_status": models.StatusResolved, "status": models.StatusReopened, "reason": input.Reason})
+
+	return c.JSON(fiber.Map{"success": true, "message": "Request reopened"})
+}
+
+// mergedTables are the tables whose rows follow a merged ticket to the target.
+var mergedTables = []string{
+	"tech_notes", "time_entries", "work_orders", "appointments", "request_parts",
+	"stock_movements", "invoice_items", "notifications", "kb_suggestions", "ticket_history",
+}
+
+// MergeSupportRequest moves notes, time, work orders, visits, parts and
+// history of a duplicate into the target ticket and closes the duplicate.
+func MergeSupportRequest(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	sourceID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request ID")
+	}
+
+	var input struct {
+		TargetID int `json:"target_id"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.TargetID == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "target_id is required")
+	}
+	if input.TargetID == sourceID {
+		return fiber.NewError(fiber.StatusBadRequest, "A request cannot be merged into itself")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	tx, err := database.Begin()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer tx.Rollback()
+
+	type ticket struct {
+		status     string
+		mergedInto *int
+	}
+	tickets := map[int]*ticket{}
+	for _, id := range []int{sourceID, input.TargetID} {
+		t := &ticket{}
+		err := tx.QueryRow(`SELECT status, merged_into FROM support_requests WHERE id = ? AND tenant_id = ? FOR UPDATE`,
+			id, admin.TenantID).Scan(&t.status, &t.mergedInto)
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("Request #%d not found", id))
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+		}
+		if t.mergedInto != nil {
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Request #%d is already merged into #%d", id, *t.mergedInto))
+		}
+		tickets[id] = t
+	}
+
+	for _, table := range mergedTables {
+		if _, err := tx.Exec(`UPDATE `+table+` SET request_id = ? WHERE request_id = ?`, input.TargetID, sourceID); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Merge failed")
+		}
+	}
+	// tags the target already has stay behind and are dropped with the source
+	if _, err := tx.Exec(`UPDATE IGNORE ticket_tags SET request_id = ? WHERE request_id = ?`, input.TargetID, sourceID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Merge failed")
+	}
+	if _, err := tx.Exec(`DELETE FROM ticket_tags WHERE request_id = ?`, sourceID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Merge failed")
+	}
+	// earlier duplicates of the source now point at the target
+	if _, err := tx.Exec(`UPDATE support_requests SET merged_into = ? WHERE merged_into = ?`, input.TargetID, sourceID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Merge failed")
+	}
+	// links between source and target disappear, other links move over
+	if _, err := tx.Exec(`DELETE FROM ticket_links WHERE (request_id = ? AND linked_request_id = ?) OR (request_id = ? AND linked_request_id = ?)`,
+		sourceID, input.TargetID, input.TargetID, sourceID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Merge failed")
+	}
+	if _, err := tx.Exec(`UPDATE IGNORE ticket_links SET request_id = ? WHERE request_id = ?`, input.TargetID, sourceID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Merge failed")
+	}
+	if _, err := tx.Exec(`UPDATE IGNORE ticket_links SET linked_request_id = ? WHERE linked_request_id = ?`, input.TargetID, sourceID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Merge failed")
+	}
+	// links the target already had are duplicates now
+	if _, err := tx.Exec(`DELETE FROM ticket_links WHERE request_id = ? OR linked_request_id = ?`, sourceID, sourceID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Merge failed")
+	}
+
+	source := tickets[sourceID]
+	if _, err := tx.Exec(`UPDATE support_requests SET status = ?, merged_into = ? WHERE id = ?`, models.StatusClosed, input.TargetID, sourceID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Merge failed")
+	}
+	closed := models.StatusClosed
+	recordHistory(tx, sourceID, admin.ID, "merged", &source.status, &closed, fmt.Sprintf("Merged into #%d", input.TargetID))
+	recordHistory(tx, input.TargetID, admin.ID, "merged_from", nil, nil, fmt.Sprintf("#%d merged into this request", sourceID))
+
+	pending := []pendingEvent{{events.TicketUpdated, sourceID, fiber.Map{"status": models.StatusClosed, "merged_into": input.TargetID}}}
+	if source.status != models.StatusClosed {
+		pending = append(pending, pendingEvent{events.TicketStatusChanged, sourceID, fiber.Map{"old_status": source.status, "status": models.StatusClosed}})
+	}
+	pending = append(pending, pendingEvent{events.TicketUpdated, input.TargetID, fiber.Map{"merged_from": sourceID}})
+	recorded, err := recordTicketEvents(tx, pending)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Merge failed")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Merge failed")
+	}
+	for _, e := range recorded {
+		events.Publish(e)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": fmt.Sprintf("Request #%d merged into #%d", sourceID, input.TargetID)})
+}
+
+// LinkSupportRequests links the ticket to another one. type parent makes the
+// other ticket this one's parent, child the reverse, related is symmetric.
+func LinkSupportRequests(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request ID")
+	}
+
+	var input struct {
+		RequestID int    `json:"request_id"`
+		Type      string `json:"type"`
+	}
+	if err := c.BodyParser(&input); err != nil || input.RequestID == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "request_id is required")
+	}
+	if input.RequestID == id {
+		return fiber.NewError(fiber.StatusBadRequest, "A request cannot be linked to itself")
+	}
+
+	child, parent, linkType := id, input.RequestID, models.LinkParent
+	switch input.Type {
+	case "parent":
+	case "child":
+		child, parent = input.RequestID, id
+	case "related":
+		linkType = models.LinkRelated
+		child, parent = min(id, input.RequestID), max(id, input.RequestID)
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "type must be parent, child or related")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if _, _, err := ticketAccess(database, c, user, id); err != nil {
+		return err
+	}
+	if err := inTenant(database, c, "support_requests", input.RequestID); err != nil {
+		return err
+	}
+
+	var linked bool
+	database.QueryRow(`SELECT EXISTS(SELECT 1 FROM ticket_links WHERE (request_id = ? AND linked_request_id = ?) OR (request_id = ? AND linked_request_id = ?))`,
+		id, input.RequestID, input.RequestID, id).Scan(&linked)
+	if linked {
+		return fiber.NewError(fiber.StatusConflict, "Requests are already linked")
+	}
+
+	if linkType == models.LinkParent {
+		var hasParent bool
+		database.QueryRow(`SELECT EXISTS(SELECT 1 FROM ticket_links WHERE request_id = ? AND type = 'parent')`, child).Scan(&hasParent)
+		if hasParent {
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Request #%d already has a parent", child))
+		}
+		// walking up from the new parent must not reach the child
+		for current, depth := parent, 0; depth < 100; depth++ {
+			if current == child {
+				return fiber.NewError(fiber.StatusBadRequest, "Link would create a cycle")
+			}
+			if err := database.QueryRow(`SELECT linked_request_id FROM ticket_links WHERE request_id = ? AND type = 'parent'`, current).Scan(&current); err != nil {
+				break
+			}
+		}
+	}
+
+	result, err := database.Exec(`INSERT INTO ticket_links (request_id, linked_request_id, type, created_by) VALUES (?, ?, ?, ?)`,
+		child, parent, linkType, user.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	linkID, _ := result.LastInsertId()
+	recordHistory(database, id, user.ID, "linked", nil, nil, fmt.Sprintf("%s #%d", input.Type, input.RequestID))
+
+	return c.JSON(fiber.Map{"success": true, "message": "Requests linked", "id": linkID})
+}
+
+func UnlinkSupportRequests(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request ID")
+	}
+	linkID, err := strconv.Atoi(c.Params("linkId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid link ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if _, _, err := ticketAccess(database, c, user, id); err != nil {
+		return err
+	}
+
+	var other int
+	err = database.QueryRow(`SELECT IF(request_id = ?, linked_request_id, request_id) FROM ticket_links WHERE id = ? AND (request_id = ? OR linked_request_id = ?)`,
+		id, linkID, id, id).Scan(&other)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Link not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if _, err := database.Exec(`DELETE FROM ticket_links WHERE id = ?`, linkID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+	recordHistory(database, id, user.ID, "unlinked", nil, nil, fmt.Sprintf("#%d", other))
+
+	return c.JSON(fiber.Map{"success": true, "message": "Link removed"})
+}
@@ -0,0 +1,579 @@
+package handlers
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"ithelp/db"
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const timeEntryColumns = `id, request_id, technician_id, kind, started_at, ended_at,
+	COALESCE(TIMESTAMPDIFF(MINUTE, started_at, ended_at), 0), COALESCE(description, ''),
+	status, reviewed_by, COALESCE(reject_reason, ''), created_at`
+
+func scanTimeEntry(scan func(dest ...any) error) (models.TimeEntry, error) {
+	var t models.TimeEntry
+	err := scan(&t.ID, &t.RequestID, &t.TechnicianID, &t.Kind, &t.StartedAt, &t.EndedAt, &t.Minutes,
+		&t.Description, &t.Status, &t.ReviewedBy, &t.RejectReason, &t.CreatedAt)
+	return t, err
+}
+
+func loadTimeEntry(database *sql.DB, id int) (models.TimeEntry, error) {
+	return scanTimeEntry(database.QueryRow(`SELECT `+timeEntryColumns+` FROM time_entries WHERE id = ?`, id).Scan)
+}
+
+func validTimeKind(kind string) bool {
+	return kind == models.TimeKindRemote || kind == models.TimeKindOnsite || kind == models.TimeKindTravel
+}
+
+// timeEntryOwner resolves which technician an entry is logged for and checks
+// the caller may log time on the request.
+func timeEntryOwner(database *sql.DB, user models.User, requestID, technicianID int) (int, error) {
+	techID := user.ID
+	switch user.Role {
+	case "admin":
+		if technicianID == 0 {
+			return 0, fiber.NewError(fiber.StatusBadRequest, "technician_id is required")
+		}
+		if err := resourceInTenant(database, user.TenantID, "users", technicianID); err != nil {
+			return 0, err
+		}
+		techID = technicianID
+	case "tech":
+	default:
+		return 0, fiber.NewError(fiber.StatusForbidden, "Only technicians allowed")
+	}
+
+	var assignedTo *int
+	err := database.QueryRow(`SELECT assigned_to FROM support_requests WHERE id = ? AND tenant_id = ?`, requestID, user.TenantID).Scan(&assignedTo)
+	if err == sql.ErrNoRows {
+		return 0, fiber.NewError(fiber.StatusNotFound, "Request not found")
+	}
+	if err != nil {
+		return 0, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if user.Role == "tech" && (assignedTo == nil || *assignedTo != techID) {
+		return 0, fiber.NewError(fiber.StatusForbidden, "Request is not assigned to you")
+	}
+	return techID, nil
+}
+
+// checkTimeOverlap rejects entries overlapping another entry of the same
+// technician. Running timers count as lasting until now. end nil means "still running".
+func checkTimeOverlap(database *sql.DB, techID int, start time.Time, end *time.Time, excludeID int) error {
+	// running entries last until now, taken from the app clock like start and
+	// end instead of the database's NOW() in its session time zone
+	now := time.Now()
+	until := now
+	if end != nil {
+		until = *end
+	}
+	var overlapping int
+	err := database.QueryRow(`
+		SELECT COUNT(*) FROM time_entries
+		WHERE technician_id = ? AND id <> ? AND status <> 'rejected'
+		AND started_at < ? AND COALESCE(ended_at, ?) > ?
+	`, techID, excludeID, until, now, start).Scan(&overlapping)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if overlapping > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Time entry overlaps another entry")
+	}
+	return nil
+}
+
+// StartTimer starts a running time entry for the calling technician.
+func StartTimer(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	var input struct {
+		RequestID   int    `json:"request_id"`
+		Kind        string `json:"kind"`
+		Description string `json:"description"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+	}
+	if !validTimeKind(input.Kind) {
+		return fiber.NewError(fiber.StatusBadRequest, "kind must be remote, onsite or travel")
+	}
+	if user.Role != "tech" {
+		return fiber.NewError(fiber.StatusForbidden, "Only technicians allowed")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	techID, err := timeEntryOwner(database, user, input.RequestID, 0)
+	if err != nil {
+		return err
+	}
+
+	var running int
+	database.QueryRow(`SELECT COUNT(*) FROM time_entries WHERE technician_id = ? AND ended_at IS NULL`, techID).Scan(&running)
+	if running > 0 {
+		return fiber.NewError(fiber.StatusConflict, "Stop the running timer first")
+	}
+
+	now := time.Now()
+	if err := checkTimeOverlap(database, techID, now, nil, 0); err != nil {
+		return err
+	}
+
+	result, err := database.Exec(`INSERT INTO time_entries (request_id, technician_id, kind, started_at, description) VALUES (?, ?, ?, ?, ?)`,
+		input.RequestID, techID, input.Kind, now, input.Description)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	id, _ := result.LastInsertId()
+
+	entry, _ := loadTimeEntry(database, int(id))
+	return c.JSON(fiber.Map{"success": true, "message": "Timer started", "data": entry})
+}
+
+func StopTimer(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid time entry ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "time_entries", id); err != nil {
+		return err
+	}
+
+	entry, err := loadTimeEntry(database, id)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Time entry not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if user.Role != "admin" && user.ID != entry.TechnicianID {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+	if entry.EndedAt != nil {
+		return fiber.NewError(fiber.StatusConflict, "Timer already stopped")
+	}
+
+	if _, err := database.Exec(`UPDATE time_entries SET ended_at = ? WHERE id = ?`, time.Now(), id); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+
+	entry, _ = loadTimeEntry(database, id)
+	return c.JSON(fiber.Map{"success": true, "message": "Timer stopped", "data": entry})
+}
+
+// LogTime records a finished time entry after the fact.
+func LogTime(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+
+	var input struct {
+		RequestID    int    `json:"request_id"`
+		TechnicianID int    `json:"technician_id"` // admin only
+		Kind         string `json:"kind"`
+		StartedAt    string `json:"started_at"`
+		EndedAt      string `json:"ended_at"`
+		Description  string `json:"description"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+	}
+	if !validTimeKind(input.Kind) {
+		return fiber.NewError(fiber.StatusBadRequest, "kind must be remote, onsite or travel")
+	}
+	start, err1 := time.Parse(time.RFC3339, input.StartedAt)
+	end, err2 := time.Parse(time.RFC3339, input.EndedAt)
+	if err1 != nil || err2 != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "started_at and ended_at must be RFC3339 times")
+	}
+	if !end.After(start) {
+		return fiber.NewError(fiber.StatusBadRequest, "ended_at must be after started_at")
+	}
+	if end.After(time.Now()) {
+		return fiber.NewError(fiber.StatusBadRequest, "Time cannot be logged in the future")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	techID, err := timeEntryOwner(database, user, input.RequestID, input.TechnicianID)
+	if err != nil {
+		return err
+	}
+	if err := checkTimeOverlap(database, techID, start, &end, 0); err != nil {
+		return err
+	}
+
+	result, err := database.Exec(`INSERT INTO time_entries (request_id, technician_id, kind, started_at, ended_at, description) VALUES (?, ?, ?, ?, ?, ?)`,
+		input.RequestID, techID, input.Kind, start, end, input.Description)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	id, _ := result.LastInsertId()
+
+	entry, _ := loadTimeEntry(database, int(id))
+	return c.JSON(fiber.Map{"success": true, "message": "Time logged", "data": entry})
+}
+
+// UpdateTimeEntry lets the technician correct a finished entry while it is pending.
+func UpdateTimeEntry(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid time entry ID")
+	}
+
+	// fields left out keep their stored value
+	var input struct {
+		Kind        *string `json:"kind"`
+		StartedAt   *string `json:"started_at"`
+		EndedAt     *string `json:"ended_at"`
+		Description *string `json:"description"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "time_entries", id); err != nil {
+		return err
+	}
+
+	entry, err := loadTimeEntry(database, id)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Time entry not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if user.Role != "admin" && user.ID != entry.TechnicianID {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+	if entry.Status != models.TimeEntryPending || entry.EndedAt == nil {
+		return fiber.NewError(fiber.StatusConflict, "Only stopped, pending entries can be edited")
+	}
+
+	kind, description := entry.Kind, entry.Description
+	if input.Kind != nil {
+		kind = *input.Kind
+	}
+	if input.Description != nil {
+		description = *input.Description
+	}
+	if !validTimeKind(kind) {
+		return fiber.NewError(fiber.StatusBadRequest, "kind must be remote, onsite or travel")
+	}
+	start, end := entry.StartedAt, *entry.EndedAt
+	if input.StartedAt != nil {
+		if start, err = time.Parse(time.RFC3339, *input.StartedAt); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "started_at must be an RFC3339 time")
+		}
+	}
+	if input.EndedAt != nil {
+		if end, err = time.Parse(time.RFC3339, *input.EndedAt); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "ended_at must be an RFC3339 time")
+		}
+	}
+	if !end.After(start) || end.After(time.Now()) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid time range")
+	}
+	if err := checkTimeOverlap(database, entry.TechnicianID, start, &end, entry.ID); err != nil {
+		return err
+	}
+
+	_, err = database.Exec(`UPDATE time_entries SET kind = ?, started_at = ?, ended_at = ?, description = ? WHERE id = ?`,
+		kind, start, end, description, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+
+	entry, _ = loadTimeEntry(database, id)
+	return c.JSON(fiber.Map{"success": true, "message": "Time entry updated", "data": entry})
+}
+
+func DeleteTimeEntry(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid time entry ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "time_entries", id); err != nil {
+		return err
+	}
+
+	entry, err := loadTimeEntry(database, id)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Time entry not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if user.Role != "admin" && (user.ID != entry.TechnicianID || entry.Status != models.TimeEntryPending) {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+
+	if _, err := database.Exec(`DELETE FROM time_entries WHERE id = ?`, id); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Time entry deleted"})
+}
+
+// ListTimeEntries: techs see their own entries, admins everyone's.
+// Filters: ?request_id=, ?technician_id=, ?status=, ?from=, ?to= (RFC3339).
+func ListTimeEntries(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	if user.Role != "admin" && user.Role != "tech" {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+
+	query := `SELECT ` + timeEntryColumns + ` FROM time_entries
+		WHERE request_id IN (SELECT id FROM support_requests WHERE tenant_id = ?)`
+	args := []any{user.TenantID}
+	if user.Role == "tech" {
+		query += ` AND technician_id = ?`
+		args = append(args, user.ID)
+	} else if techID := c.QueryInt("technician_id"); techID != 0 {
+		query += ` AND technician_id = ?`
+		args = append(args, techID)
+	}
+	if requestID := c.QueryInt("request_id"); requestID != 0 {
+		query += ` AND request_id = ?`
+		args = append(args, requestID)
+	}
+	if status := c.Query("status"); status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	if from, err := time.Parse(time.RFC3339, c.Query("from")); err == nil {
+		query += ` AND started_at >= ?`
+		args = append(args, from)
+	}
+	if to, err := time.Parse(time.RFC3339, c.Query("to")); err == nil {
+		query += ` AND started_at < ?`
+		args = append(args, to)
+	}
+	query += ` ORDER BY started_at DESC`
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	entries := []models.TimeEntry{}
+	for rows.Next() {
+		t, err := scanTimeEntry(rows.Scan)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, t)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": entries})
+}
+
+// sumTime adds up minutes of non-rejected entries matching the condition.
+func sumTime(database *sql.DB, where string, args ...any) (models.TimeTotals, error) {
+	var t models.TimeTotals
+	err := database.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN kind = 'remote' THEN TIMESTAMPDIFF(MINUTE, started_at, ended_at) END), 0),
+			COALESCE(SUM(CASE WHEN kind = 'onsite' THEN TIMESTAMPDIFF(MINUTE, started_at, ended_at) END), 0),
+			COALESCE(SUM(CASE WHEN kind = 'travel' THEN TIMESTAMPDIFF(MINUTE, started_at, ended_at) END), 0),
+			COALESCE(SUM(CASE WHEN status = 'approved' THEN TIMESTAMPDIFF(MINUTE, started_at, ended_at) END), 0),
+			COALESCE(SUM(CASE WHEN status = 'pending' THEN TIMESTAMPDIFF(MINUTE, started_at, ended_at) END), 0),
+			COUNT(CASE WHEN ended_at IS NULL THEN 1 END)
+		FROM time_entries
+		WHERE status <> 'rejected' AND `+where, args...).
+		Scan(&t.Remote, &t.Onsite, &t.Travel, &t.ApprovedTotal, &t.PendingTotal, &t.RunningTimers)
+	t.Total = t.Remote + t.Onsite + t.Travel
+	return t, err
+}
+
+// RequestTimeTotals returns logged minutes for one support request.
+func RequestTimeTotals(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	requestID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var ownerID int
+	var assignedTo *int
+	err = database.QueryRow(`SELECT user_id, assigned_to FROM support_requests WHERE id = ? AND tenant_id = ?`, requestID, tenantID(c)).Scan(&ownerID, &assignedTo)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Request not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if user.Role != "admin" && !canManageTicket(database, user, requestID) && (assignedTo == nil || *assignedTo != user.ID) {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+
+	totals, err := sumTime(database, `request_id = ?`, requestID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": totals})
+}
+
+// TechnicianTimeTotals returns logged minutes of a technician, optionally within ?from= / ?to=.
+func TechnicianTimeTotals(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	techID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidUserID)
+	}
+	if user.Role != "admin" && user.ID != techID {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+
+	where := `technician_id = ?`
+	args := []any{techID}
+	if from, err := time.Parse(time.RFC3339, c.Query("from")); err == nil {
+		where += ` AND started_at >= ?`
+		args = append(args, from)
+	}
+	if to, err := time.Parse(time.RFC3339, c.Query("to")); err == nil {
+		where += ` AND started_at < ?`
+		args = append(args, to)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "users", techID); err != nil {
+		return err
+	}
+
+	totals, err := sumTime(database, where, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": totals})
+}
+
+func reviewTimeEntry(c *fiber.Ctx, status string) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid time entry ID")
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	c.BodyParser(&input)
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "time_entries", id); err != nil {
+		return err
+	}
+
+	entry, err := loadTimeEntry(database, id)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Time entry not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if entry.EndedAt == nil {
+		return fiber.NewError(fiber.StatusConflict, "Timer is still running")
+	}
+
+	var reason *string
+	if status == models.TimeEntryRejected && input.Reason != "" {
+		reason = &input.Reason
+	}
+	_, err = database.Exec(`UPDATE time_entries SET status = ?, reviewed_by = ?, reviewed_at = NOW(), reject_reason = ? WHERE id = ?`,
+		status, admin.ID, reason, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Time entry " + status})
+}
+
+func ApproveTimeEntry(c *fiber.Ctx) error {
+	return reviewTimeEntry(c, models.TimeEntryApproved)
+}
+
+func RejectTimeEntry(c *fiber.Ctx) error {
+	return reviewTimeEntry(c, models.TimeEntryRejected)
+}
@@ -3,12 +3,13 @@ package handlers
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
+	"log"
 	"strconv"
 	"time"
  
  
+	"ithelp/audit"
 	"ithelp/db"
 	"ithelp/models"
 	
@@ -35,16 +36,20 @@ const (
 
 // Helper function to parse and validate requester
 func getRequester(c *fiber.Ctx) (*models.User, error) {
-	userJson, ok := c.Locals("user").(string)
+	user, ok := currentUser(c)
 	if !ok {
 		return nil, errors.New(ErrInvalidAuth)
 	}
+	return &user, nil
+}
 
-	var requester models.User
-	if err := json.Unmarshal([]byte(userJson), &requester); err != nil {
-		return nil, errors.New(ErrUserDataParse)
+// Helper function to read the user JWTMiddleware stored in locals
+func currentUser(c *fiber.Ctx) (models.User, bool) {
+	user, ok := c.Locals("user").(models.User)
+	if !ok || user.ID == 0 {
+		return models.User{}, false
 	}
-	return &requester, nil
+	return user, true
 }
 
 // Helper function to get database connection with context
@@ -84,8 +89,8 @@ func ListUsers(c *fiber.Ctx) error {
 	rows, err := database.QueryContext(ctx, `
 		SELECT id, name, phone, email, role, 
 		subscription_plan, subscription_start, subscription_end 
-		FROM users
-	`)
+		FROM users WHERE tenant_id = ?
+	`, requester.TenantID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": ErrQueryFailed,
@@ -114,7 +119,7 @@ func ListUsers(c *fiber.Ctx) error {
 // handlers/user.go
 func GetUser(c *fiber.Ctx) error {
     // Get user claims from JWT
-    claims, ok := c.Locals("userClaims").(models.User)
+    claims, ok := currentUser(c)
     if !ok {
         return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
             "error": "Invalid user claims",
@@ -149,8 +154,8 @@ func GetUser(c *fiber.Ctx) error {
     err = database.QueryRow(`
         SELECT id, name, phone, email, role,
         subscription_plan, subscription_start, subscription_end
-        FROM users WHERE id = ?
-    `, requestedID).Scan(
+        FROM users WHERE id = ? AND tenant_id = ?
+    `, requestedID, claims.TenantID).Scan(
         &user.ID, &user.Name, &user.Phone, &user.Email, &user.Role,
         &user.SubscriptionPlan, &user.SubscriptionStart, &user.SubscriptionEnd,
     )
@@ -214,11 +219,32 @@ func UpdateUser(c *fiber.Ctx) error {
 	defer cancel()
 	defer database.Close()
 
+	// plan changes during a running subscription go to the ledger
+	var oldPlan sql.NullString
+	var wasActive bool
+	database.QueryRowContext(ctx, `
+		SELECT subscription_plan, COALESCE(subscription_end >= NOW() AND subscription_expired_at IS NULL, 0)
+		FROM users WHERE id = ? AND tenant_id = ?
+	`, targetID, requester.TenantID).Scan(&oldPlan, &wasActive)
+	before := userSnapshot(database, requester.TenantID, targetID)
+
+	// only admins change plans; customers keep theirs when they omit it
+	if requester.Role != "admin" {
+		if input.SubscriptionPlan == "" {
+			input.SubscriptionPlan = oldPlan.String
+		}
+		if input.SubscriptionPlan != oldPlan.String {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only admins can change the subscription plan",
+			})
+		}
+	}
+
 	_, err = database.ExecContext(ctx, `
 		UPDATE users 
 		SET name = ?, subscription_plan = ? 
-		WHERE id = ?
-	`, input.Name, input.SubscriptionPlan, targetID)
+		WHERE id = ? AND tenant_id = ?
+	`, input.Name, input.SubscriptionPlan, targetID, requester.TenantID)
 
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -226,6 +252,20 @@ func UpdateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	if wasActive && oldPlan.String != input.SubscriptionPlan {
+		err = recordSubscriptionChange(database, subscriptionChange{
+			tenant: requester.TenantID, userID: &targetID, fromPlan: oldPlan.String, wasActive: true,
+			toPlan: input.SubscriptionPlan, actorID: &requester.ID,
+		})
+		if err != nil {
+			log.Printf("subscriptions: recording change of user %d failed: %v", targetID, err)
+		}
+	}
+
+	entry := audit.FromRequest(c, "user.update", "users", targetID)
+	entry.Before, entry.After = before, userSnapshot(database, requester.TenantID, targetID)
+	audit.Log(c, database, entry)
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "User updated successfully",
@@ -263,10 +303,11 @@ func DeleteUser(c *fiber.Ctx) error {
 	defer cancel()
 	defer database.Close()
 
+	before := userSnapshot(database, requester.TenantID, targetID)
 	_, err = database.ExecContext(ctx, `
 		DELETE FROM users 
-		WHERE id = ?
-	`, targetID)
+		WHERE id = ? AND tenant_id = ?
+	`, targetID, requester.TenantID)
 
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -274,6 +315,10 @@ func DeleteUser(c *fiber.Ctx) error {
 		})
 	}
 
+	entry := audit.FromRequest(c, "user.delete", "users", targetID)
+	entry.Before = before
+	audit.Log(c, database, entry)
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "User deleted successfully",
@@ -301,6 +346,13 @@ func CreateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	// superadmins are provisioned outside tenants
+	if input.Role == "superadmin" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": ErrAccessDenied,
+		})
+	}
+
 	hash, err := bcrypt.GenerateFromPassword([]byte(input.PasswordHash), bcrypt.DefaultCost)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -317,11 +369,11 @@ func CreateUser(c *fiber.Ctx) error {
 	defer cancel()
 	defer database.Close()
 
-	_, err = database.ExecContext(ctx, `
+	result, err := database.ExecContext(ctx, `
 		INSERT INTO users (
-			name, phone, email, password_hash, role
-		) VALUES (?, ?, ?, ?, ?)
-	`, input.Name, input.Phone, input.Email, string(hash), input.Role)
+			name, phone, email, password_hash, role, tenant_id
+		) VALUES (?, ?, ?, ?, ?, ?)
+	`, input.Name, input.Phone, input.Email, string(hash), input.Role, requester.TenantID)
 
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -329,6 +381,11 @@ func CreateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	id, _ := result.LastInsertId()
+	entry := audit.FromRequest(c, "user.create", "users", id)
+	entry.After = userSnapshot(database, requester.TenantID, int(id))
+	audit.Log(c, database, entry)
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "User created successfully",
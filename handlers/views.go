@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"ithelp/db"
+	"ithelp/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type viewInput struct {
+	Name   string       `json:"name"`
+	Filter ticketFilter `json:"filter"`
+	Sort   string       `json:"sort"`
+	Order  string       `json:"order"`
+	Role   string       `json:"role"` // share with admin or tech instead of keeping it personal
+}
+
+func (in *viewInput) validate(database *sql.DB, user models.User) error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "name is required")
+	}
+	if in.Order == "" {
+		in.Order = "desc"
+	}
+	if _, err := orderBy(in.Sort, in.Order); err != nil {
+		return err
+	}
+	if in.Filter.Priority != "" && !validPriority(in.Filter.Priority) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid priority")
+	}
+	if _, _, err := in.Filter.where(database, user.TenantID); err != nil {
+		return err
+	}
+	switch in.Role {
+	case "":
+	case "admin", "tech":
+		if user.Role != "admin" {
+			return fiber.NewError(fiber.StatusForbidden, "Only admins can share views")
+		}
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "role must be admin or tech")
+	}
+	return nil
+}
+
+// scopeFilter limits what a view shows to what the user may list:
+// technicians only see tickets assigned to them.
+func scopeFilter(user models.User, f *ticketFilter) {
+	if user.Role == "tech" {
+		f.AssignedTo = user.ID
+		f.Unassigned = false
+	}
+}
+
+// loadView returns a view the user can use: their own or one shared with
+// their role.
+func loadView(database *sql.DB, user models.User, id int) (models.SavedView, error) {
+	var v models.SavedView
+	var sort sql.NullString
+	err := database.QueryRow(`
+		SELECT id, owner_id, role, name, filter, sort, sort_order, created_at, updated_at FROM saved_views
+		WHERE id = ? AND tenant_id = ? AND (owner_id = ? OR role = ?)`, id, user.TenantID, user.ID, user.Role).
+		Scan(&v.ID, &v.OwnerID, &v.Role, &v.Name, &v.Filter, &sort, &v.Order, &v.CreatedAt, &v.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return v, fiber.NewError(fiber.StatusNotFound, "View not found")
+	}
+	if err != nil {
+		return v, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	v.Sort = sort.String
+	return v, nil
+}
+
+// viewFilter decodes the stored filter of a view, scoped to the user.
+func viewFilter(user models.User, v models.SavedView) ticketFilter {
+	var f ticketFilter
+	json.Unmarshal(v.Filter, &f)
+	scopeFilter(user, &f)
+	return f
+}
+
+// ListViews returns the caller's views and those shared with their role,
+// each with the number of tickets it currently matches.
+func ListViews(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`
+		SELECT id, owner_id, role, name, filter, sort, sort_order, created_at, updated_at FROM saved_views
+		WHERE tenant_id = ? AND (owner_id = ? OR role = ?)
+		ORDER BY owner_id IS NULL, name`, user.TenantID, user.ID, user.Role)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	views := []models.SavedView{}
+	for rows.Next() {
+		var v models.SavedView
+		var sort sql.NullString
+		if err := rows.Scan(&v.ID, &v.OwnerID, &v.Role, &v.Name, &v.Filter, &sort, &v.Order, &v.CreatedAt, &v.UpdatedAt); err != nil {
+			continue
+		}
+		v.Sort = sort.String
+		views = append(views, v)
+	}
+	rows.Close()
+
+	for i := range views {
+		where, args, err := viewFilter(user, views[i]).where(database, user.TenantID)
+		if err != nil {
+			continue // e.g. its category was deleted
+		}
+		database.QueryRow(`SELECT COUNT(*) FROM support_requests WHERE `+where, args...).Scan(&views[i].Count)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": views})
+}
+
+func CreateView(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+
+	var input viewInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := input.validate(database, user); err != nil {
+		return err
+	}
+	var owner *int
+	var role *string
+	if input.Role == "" {
+		owner = &user.ID
+	} else {
+		role = &input.Role
+	}
+	filter, _ := json.Marshal(input.Filter)
+
+	result, err := database.Exec(`INSERT INTO saved_views (tenant_id, owner_id, role, name, filter, sort, sort_order) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		user.TenantID, owner, role, input.Name, filter, nullIfEmpty(input.Sort), input.Order)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	id, _ := result.LastInsertId()
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "message": "View created", "id": id})
+}
+
+// checkViewWrite allows the owner to change a personal view and admins to
+// change shared ones.
+func checkViewWrite(database *sql.DB, user models.User, id int) error {
+	v, err := loadView(database, user, id)
+	if err != nil {
+		return err
+	}
+	if v.OwnerID == nil && user.Role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only admins can change shared views")
+	}
+	return nil
+}
+
+// UpdateView replaces name, filter, sort and sharing of a view.
+func UpdateView(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid view ID")
+	}
+
+	var input viewInput
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, ErrInvalidInput)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := checkViewWrite(database, user, id); err != nil {
+		return err
+	}
+	if err := input.validate(database, user); err != nil {
+		return err
+	}
+	var owner *int
+	var role *string
+	if input.Role == "" {
+		owner = &user.ID
+	} else {
+		role = &input.Role
+	}
+	filter, _ := json.Marshal(input.Filter)
+
+	if _, err := database.Exec(`UPDATE saved_views SET owner_id = ?, role = ?, name = ?, filter = ?, sort = ?, sort_order = ? WHERE id = ?`,
+		owner, role, input.Name, filter, nullIfEmpty(input.Sort), input.Order, id); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, ErrUpdateFailed)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "View updated"})
+}
+
+func DeleteView(c *fiber.Ctx) error {
+	user, err := requireStaff(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid view ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if err := checkViewWrite(database, user, id); err != nil {
+		return err
+	}
+	if _, err := database.Exec(`DELETE FROM saved_views WHERE id = ?`, id); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "View deleted"})
+}
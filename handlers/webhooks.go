@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ithelp/db"
+	"ithelp/models"
+	"ithelp/webhooks"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func requireAdmin(c *fiber.Ctx) (models.User, error) {
+	user, ok := currentUser(c)
+	if !ok {
+		return user, fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	if user.Role != "admin" {
+		return user, fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+	return user, nil
+}
+
+func validateWebhookInput(rawURL string, eventTypes []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook URL")
+	}
+	if len(eventTypes) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one event type is required")
+	}
+	for _, t := range eventTypes {
+		if !webhooks.IsEventType(t) {
+			return fiber.NewError(fiber.StatusBadRequest, "Unknown event type: "+t)
+		}
+	}
+	return nil
+}
+
+func scanWebhookEndpoint(scan func(dest ...any) error) (models.WebhookEndpoint, error) {
+	var e models.WebhookEndpoint
+	var types string
+	err := scan(&e.ID, &e.URL, &types, &e.Active, &e.FailureCount, &e.DisabledAt, &e.CreatedAt)
+	e.EventTypes = strings.Split(types, ",")
+	return e, err
+}
+
+func ListWebhooks(c *fiber.Ctx) error {
+	if _, err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`SELECT id, url, event_types, active, failure_count, disabled_at, created_at FROM webhook_endpoints WHERE tenant_id = ? ORDER BY id`, tenantID(c))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	endpoints := []models.WebhookEndpoint{}
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows.Scan)
+		if err != nil {
+			continue
+		}
+		endpoints = append(endpoints, e)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": endpoints, "event_types": webhooks.EventTypes})
+}
+
+func CreateWebhook(c *fiber.Ctx) error {
+	admin, err := requireAdmin(c)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		URL        string   `json:"url"`
+		Secret     string   `json:"secret"` // generated when empty
+		EventTypes []string `json:"event_types"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+	}
+	if err := validateWebhookInput(input.URL, input.EventTypes); err != nil {
+		return err
+	}
+
+	if input.Secret == "" {
+		buf := make([]byte, 24)
+		if _, err := rand.Read(buf); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Secret generation failed")
+		}
+		input.Secret = hex.EncodeToString(buf)
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	result, err := database.Exec(`INSERT INTO webhook_endpoints (tenant_id, url, secret, event_types, created_by) VALUES (?, ?, ?, ?, ?)`,
+		tenantID(c), input.URL, input.Secret, strings.Join(input.EventTypes, ","), admin.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	id, _ := result.LastInsertId()
+
+	// the secret is only ever shown here
+	return c.JSON(fiber.Map{"success": true, "message": "Webhook created", "id": id, "secret": input.Secret})
+}
+
+func UpdateWebhook(c *fiber.Ctx) error {
+	if _, err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook ID")
+	}
+
+	var input struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+		Active     bool     `json:"active"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+	}
+	if err := validateWebhookInput(input.URL, input.EventTypes); err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "webhook_endpoints", id); err != nil {
+		return err
+	}
+
+	// re-enabling an endpoint clears its failure streak
+	result, err := database.Exec(`
+		UPDATE webhook_endpoints
+		SET url = ?, event_types = ?, active = ?,
+			failure_count = IF(?, 0, failure_count),
+			disabled_at = IF(?, NULL, disabled_at)
+		WHERE id = ?`,
+		input.URL, strings.Join(input.EventTypes, ","), input.Active, input.Active, input.Active, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var exists bool
+		database.QueryRow(`SELECT EXISTS(SELECT 1 FROM webhook_endpoints WHERE id = ?)`, id).Scan(&exists)
+		if !exists {
+			return fiber.NewError(fiber.StatusNotFound, "Webhook not found")
+		}
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Webhook updated"})
+}
+
+func DeleteWebhook(c *fiber.Ctx) error {
+	if _, err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	result, err := database.Exec(`DELETE FROM webhook_endpoints WHERE id = ? AND tenant_id = ?`, id, tenantID(c))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Delete failed")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Webhook not found")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Webhook deleted"})
+}
+
+// ListWebhookDeliveries returns the delivery log of one endpoint, newest first.
+func ListWebhookDeliveries(c *fiber.Ctx) error {
+	if _, err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook ID")
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+	if err := inTenant(database, c, "webhook_endpoints", id); err != nil {
+		return err
+	}
+
+	query := `
+		SELECT id, endpoint_id, event_type, payload, status, attempts, response_code,
+		response_body, last_error, next_attempt_at, delivered_at, created_at
+		FROM webhook_deliveries WHERE endpoint_id = ?`
+	args := []any{id}
+	if status := c.Query("status"); status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := database.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.EndpointID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.ResponseCode,
+			&d.ResponseBody, &d.LastError, &d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt); err != nil {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": deliveries})
+}
+
+func RedeliverWebhook(c *fiber.Ctx) error {
+	if _, err := requireAdmin(c); err != nil {
+		return err
+	}
+
+	deliveryID, err := strconv.Atoi(c.Params("deliveryId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid delivery ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	err = inTenant(database, c, "webhook_deliveries", deliveryID)
+	database.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := webhooks.Redeliver(deliveryID); err != nil {
+		if err == sql.ErrNoRows {
+			return fiber.NewError(fiber.StatusNotFound, "Delivery not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, "Redelivery failed")
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Delivery re-sent"})
+}
@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ithelp/db"
+	"ithelp/events"
+	"ithelp/models"
+	"ithelp/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jung-kurt/gofpdf"
+)
+
+const maxSignatureSize = 2 << 20 // 2 MB
+
+const workOrderColumns = `id, request_id, appointment_id, technician_id, summary, parts_used, minutes_spent,
+	status, signer_name, signed_at, signed_latitude, signed_longitude, pdf_path IS NOT NULL, created_at, updated_at`
+
+func scanWorkOrder(scan func(dest ...any) error) (models.WorkOrder, error) {
+	var w models.WorkOrder
+	var parts sql.NullString
+	err := scan(&w.ID, &w.RequestID, &w.AppointmentID, &w.TechnicianID, &w.Summary, &parts, &w.MinutesSpent,
+		&w.Status, &w.SignerName, &w.SignedAt, &w.SignedLatitude, &w.SignedLongitude, &w.HasPDF, &w.CreatedAt, &w.UpdatedAt)
+	w.PartsUsed = []models.WorkOrderPart{}
+	if parts.Valid {
+		json.Unmarshal([]byte(parts.String), &w.PartsUsed)
+	}
+	return w, err
+}
+
+func loadWorkOrder(database *sql.DB, id int) (models.WorkOrder, error) {
+	return scanWorkOrder(database.QueryRow(`SELECT `+workOrderColumns+` FROM work_orders WHERE id = ?`, id).Scan)
+}
+
+// workOrderAccess loads the order and checks the caller is its technician, an
+// admin or (for reading and signing) the ticket owner.
+func workOrderAccess(database *sql.DB, user models.User, id int, allowOwner bool) (models.WorkOrder, error) {
+	w, err := loadWorkOrder(database, id)
+	if err == sql.ErrNoRows {
+		return w, fiber.NewError(fiber.StatusNotFound, "Work order not found")
+	}
+	if err != nil {
+		return w, fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if err := resourceInTenant(database, user.TenantID, "work_orders", id); err != nil {
+		return w, err
+	}
+	if user.Role == "admin" || user.ID == w.TechnicianID {
+		return w, nil
+	}
+	if allowOwner {
+		var ownerID int
+		database.QueryRow(`SELECT user_id FROM support_requests WHERE id = ?`, w.RequestID).Scan(&ownerID)
+		if canManageTicket(database, user, w.RequestID) {
+			return w, nil
+		}
+	}
+	return w, fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+}
+
+func validateParts(parts []models.WorkOrderPart) error {
+	for _, p := range parts {
+		if strings.TrimSpace(p.Name) == "" || p.Quantity <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "Every part needs a name and a positive quantity")
+		}
+	}
+	return nil
+}
+
+// CreateWorkOrder is filled in by the technician after the work is done.
+// minutes_spent defaults to the time logged on the request.
+func CreateWorkOrder(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	if user.Role != "tech" && user.Role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "Only technicians allowed")
+	}
+
+	var input struct {
+		RequestID     int                    `json:"request_id"`
+		AppointmentID *int                   `json:"appointment_id"`
+		Summary       string                 `json:"summary"`
+		PartsUsed     []models.WorkOrderPart `json:"parts_used"`
+		MinutesSpent  *int                   `json:"minutes_spent"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+	}
+	if strings.TrimSpace(input.Summary) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Summary is required")
+	}
+	if err := validateParts(input.PartsUsed); err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var assignedTo *int
+	err = database.QueryRow(`SELECT assigned_to FROM support_requests WHERE id = ? AND tenant_id = ?`, input.RequestID, tenantID(c)).Scan(&assignedTo)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Request not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if assignedTo == nil {
+		return fiber.NewError(fiber.StatusConflict, "Request has no technician assigned")
+	}
+	if user.Role == "tech" && *assignedTo != user.ID {
+		return fiber.NewError(fiber.StatusForbidden, "Request is not assigned to you")
+	}
+
+	if input.AppointmentID != nil {
+		var apptRequest int
+		err := database.QueryRow(`SELECT request_id FROM appointments WHERE id = ?`, *input.AppointmentID).Scan(&apptRequest)
+		if err != nil || apptRequest != input.RequestID {
+			return fiber.NewError(fiber.StatusBadRequest, "Appointment does not belong to this request")
+		}
+	}
+
+	minutes := 0
+	if input.MinutesSpent != nil {
+		minutes = *input.MinutesSpent
+	} else {
+		totals, err := sumTime(database, `request_id = ?`, input.RequestID)
+		if err == nil {
+			minutes = totals.Total
+		}
+	}
+
+	parts, _ := json.Marshal(input.PartsUsed)
+	result, err := database.Exec(`
+		INSERT INTO work_orders (request_id, appointment_id, technician_id, summary, parts_used, minutes_spent)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		input.RequestID, input.AppointmentID, *assignedTo, input.Summary, string(parts), minutes)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Insert failed")
+	}
+	id, _ := result.LastInsertId()
+
+	w, _ := loadWorkOrder(database, int(id))
+	return c.JSON(fiber.Map{"success": true, "message": "Work order created", "data": w})
+}
+
+// UpdateWorkOrder edits an order that has not been signed yet.
+func UpdateWorkOrder(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid work order ID")
+	}
+
+	var input struct {
+		Summary      string                 `json:"summary"`
+		PartsUsed    []models.WorkOrderPart `json:"parts_used"`
+		MinutesSpent int                    `json:"minutes_spent"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid input")
+	}
+	if strings.TrimSpace(input.Summary) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Summary is required")
+	}
+	if err := validateParts(input.PartsUsed); err != nil {
+		return err
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	w, err := workOrderAccess(database, user, id, false)
+	if err != nil {
+		return err
+	}
+	if w.Status != models.WorkOrderDraft {
+		return fiber.NewError(fiber.StatusConflict, "Signed work orders cannot be changed")
+	}
+
+	parts, _ := json.Marshal(input.PartsUsed)
+	_, err = database.Exec(`UPDATE work_orders SET summary = ?, parts_used = ?, minutes_spent = ? WHERE id = ? AND status = 'draft'`,
+		input.Summary, string(parts), input.MinutesSpent, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+
+	w, _ = loadWorkOrder(database, id)
+	return c.JSON(fiber.Map{"success": true, "message": "Work order updated", "data": w})
+}
+
+func GetWorkOrder(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid work order ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	w, err := workOrderAccess(database, user, id, true)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": w})
+}
+
+// ListRequestWorkOrders returns the work orders of one support request.
+func ListRequestWorkOrders(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	requestID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	var ownerID int
+	var assignedTo *int
+	err = database.QueryRow(`SELECT user_id, assigned_to FROM support_requests WHERE id = ? AND tenant_id = ?`, requestID, tenantID(c)).Scan(&ownerID, &assignedTo)
+	if err == sql.ErrNoRows {
+		return fiber.NewError(fiber.StatusNotFound, "Request not found")
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	if user.Role != "admin" && !canManageTicket(database, user, requestID) && (assignedTo == nil || *assignedTo != user.ID) {
+		return fiber.NewError(fiber.StatusForbidden, ErrAccessDenied)
+	}
+
+	rows, err := database.Query(`SELECT `+workOrderColumns+` FROM work_orders WHERE request_id = ? ORDER BY id`, requestID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Query error")
+	}
+	defer rows.Close()
+
+	list := []models.WorkOrder{}
+	for rows.Next() {
+		w, err := scanWorkOrder(rows.Scan)
+		if err != nil {
+			continue
+		}
+		list = append(list, w)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": list})
+}
+
+// SignWorkOrder takes the customer's signature as a multipart upload
+// ("signature" image, "signer_name", optional "latitude"/"longitude"),
+// renders the signed PDF and resolves the support request.
+func SignWorkOrder(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid work order ID")
+	}
+
+	signerName := strings.TrimSpace(c.FormValue("signer_name"))
+	if signerName == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "signer_name is required")
+	}
+	var lat, lng *float64
+	if v, err := strconv.ParseFloat(c.FormValue("latitude"), 64); err == nil && v >= -90 && v <= 90 {
+		lat = &v
+	}
+	if v, err := strconv.ParseFloat(c.FormValue("longitude"), 64); err == nil && v >= -180 && v <= 180 {
+		lng = &v
+	}
+
+	file, err := c.FormFile("signature")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "signature image is required")
+	}
+	if file.Size > maxSignatureSize {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "Signature image is too large")
+	}
+	f, err := file.Open()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid signature image")
+	}
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	f.Close()
+	var ext, imageType string
+	switch http.DetectContentType(head[:n]) {
+	case "image/png":
+		ext, imageType = ".png", "PNG"
+	case "image/jpeg":
+		ext, imageType = ".jpg", "JPG"
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Signature must be a PNG or JPEG image")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	w, err := workOrderAccess(database, user, id, true)
+	if err != nil {
+		return err
+	}
+	if w.Status != models.WorkOrderDraft {
+		return fiber.NewError(fiber.StatusConflict, "Work order is already signed")
+	}
+
+	// both files are written under temporary names and only take their final
+	// names once this request has signed the work order
+	signaturePath, err1 := utils.NewUploadPath("signatures", ext)
+	pdfPath, err2 := utils.NewUploadPath("work_orders", ".pdf")
+	if err1 != nil || err2 != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Storage error")
+	}
+	signatureTmp, pdfTmp := signaturePath+".tmp", pdfPath+".tmp"
+	defer os.Remove(signatureTmp)
+	defer os.Remove(pdfTmp)
+	if err := c.SaveFile(file, signatureTmp); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Storage error")
+	}
+
+	signedAt := time.Now()
+	if err := renderWorkOrderPDF(database, w, signerName, signatureTmp, imageType, signedAt, lat, lng, pdfTmp); err != nil {
+		log.Printf("work_orders: PDF of work order %d failed: %v", id, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "PDF generation failed")
+	}
+
+	result, err := database.Exec(`
+		UPDATE work_orders SET status = 'signed', signer_name = ?, signature_path = ?, signed_at = ?,
+			signed_latitude = ?, signed_longitude = ?, signed_ip = ?, pdf_path = ?
+		WHERE id = ? AND status = 'draft'`,
+		signerName, signaturePath, signedAt, lat, lng, c.IP(), pdfPath, id)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Update failed")
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fiber.NewError(fiber.StatusConflict, "Work order is already signed")
+	}
+	if err := os.Rename(signatureTmp, signaturePath); err != nil {
+		log.Printf("work_orders: storing signature of work order %d failed: %v", id, err)
+	}
+	if err := os.Rename(pdfTmp, pdfPath); err != nil {
+		log.Printf("work_orders: storing PDF of work order %d failed: %v", id, err)
+	}
+
+	// a signed work order closes the ticket
+	var oldStatus string
+	database.QueryRow(`SELECT status FROM support_requests WHERE id = ?`, w.RequestID).Scan(&oldStatus)
+	if oldStatus != models.StatusResolved && oldStatus != models.StatusClosed {
+		if _, err := database.Exec(`UPDATE support_requests SET status = ? WHERE id = ?`, models.StatusResolved, w.RequestID); err == nil {
+			recordStatusChange(database, w.RequestID, user.ID, oldStatus, models.StatusResolved)
+			publishTicketEvent(database, events.TicketUpdated, w.RequestID, fiber.Map{"status": models.StatusResolved})
+			publishTicketEvent(database, events.TicketStatusChanged, w.RequestID, fiber.Map{"old_status": oldStatus, "status": models.StatusResolved})
+		}
+	}
+	if w.AppointmentID != nil {
+		database.Exec(`UPDATE appointments SET status = 'completed' WHERE id = ? AND status = 'scheduled'`, *w.AppointmentID)
+	}
+
+	w, _ = loadWorkOrder(database, id)
+	return c.JSON(fiber.Map{"success": true, "message": "Work order signed", "data": w})
+}
+
+// renderWorkOrderPDF writes the signed work order to pdfPath.
+func renderWorkOrderPDF(database *sql.DB, w models.WorkOrder, signerName, signaturePath, imageType string,
+	signedAt time.Time, lat, lng *float64, pdfPath string) error {
+	var title, category, customer, techName string
+	err := database.QueryRow(`
+		SELECT s.title, s.category, cu.name, te.name
+		FROM support_requests s
+		JOIN users cu ON cu.id = s.user_id
+		JOIN users te ON te.id = ?
+		WHERE s.id = ?`, w.TechnicianID, w.RequestID).Scan(&title, &category, &customer, &techName)
+	if err != nil {
+		return err
+	}
+	address := ""
+	if w.AppointmentID != nil {
+		database.QueryRow(`SELECT address FROM appointments WHERE id = ?`, *w.AppointmentID).Scan(&address)
+	}
+
+	loc := utils.BusinessLocation()
+	pdf, font, tr := utils.NewPDF()
+	pdf.AddPage()
+
+	pdf.SetFont(font, "B", 16)
+	pdf.CellFormat(0, 10, tr(fmt.Sprintf("İş sifarişi #%d", w.ID)), "", 1, "L", false, 0, "")
+	pdf.SetFont(font, "", 11)
+
+	row := func(label, value string) {
+		pdf.SetFont(font, "B", 11)
+		pdf.CellFormat(45, 7, tr(label), "", 0, "L", false, 0, "")
+		pdf.SetFont(font, "", 11)
+		pdf.MultiCell(0, 7, tr(value), "", "L", false)
+	}
+	row("Müraciət:", fmt.Sprintf("#%d %s", w.RequestID, title))
+	row("Kateqoriya:", category)
+	row("Müştəri:", customer)
+	if address != "" {
+		row("Ünvan:", address)
+	}
+	row("Texnik:", techName)
+	row("Sərf olunan vaxt:", fmt.Sprintf("%d dəq", w.MinutesSpent))
+	pdf.Ln(3)
+
+	pdf.SetFont(font, "B", 12)
+	pdf.CellFormat(0, 8, tr("Görülən işlər"), "", 1, "L", false, 0, "")
+	pdf.SetFont(font, "", 11)
+	pdf.MultiCell(0, 6, tr(w.Summary), "", "L", false)
+	pdf.Ln(3)
+
+	if len(w.PartsUsed) > 0 {
+		pdf.SetFont(font, "B", 12)
+		pdf.CellFormat(0, 8, tr("İstifadə olunan hissələr"), "", 1, "L", false, 0, "")
+		pdf.SetFont(font, "B", 11)
+		pdf.CellFormat(140, 7, tr("Ad"), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(40, 7, tr("Say"), "1", 1, "R", false, 0, "")
+		pdf.SetFont(font, "", 11)
+		for _, p := range w.PartsUsed {
+			pdf.CellFormat(140, 7, tr(p.Name), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(40, 7, strconv.Itoa(p.Quantity), "1", 1, "R", false, 0, "")
+		}
+		pdf.Ln(3)
+	}
+
+	pdf.SetFont(font, "B", 12)
+	pdf.CellFormat(0, 8, tr("Müştəri təsdiqi"), "", 1, "L", false, 0, "")
+	pdf.SetFont(font, "", 11)
+	row("İmzalayan:", signerName)
+	row("Tarix:", signedAt.In(loc).Format("02.01.2006 15:04:05 MST"))
+	if lat != nil && lng != nil {
+		row("Məkan:", fmt.Sprintf("%.6f, %.6f", *lat, *lng))
+	}
+	pdf.ImageOptions(signaturePath, pdf.GetX(), pdf.GetY()+2, 70, 0, true,
+		gofpdf.ImageOptions{ImageType: imageType}, 0, "")
+
+	return pdf.OutputFileAndClose(pdfPath)
+}
+
+// DownloadWorkOrderPDF serves the signed PDF.
+func DownloadWorkOrderPDF(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, ErrInvalidAuth)
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid work order ID")
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "DB error")
+	}
+	defer database.Close()
+
+	if _, err := workOrderAccess(database, user, id, true); err != nil {
+		return err
+	}
+	var pdfPath sql.NullString
+	database.QueryRow(`SELECT pdf_path FROM work_orders WHERE id = ?`, id).Scan(&pdfPath)
+	if !pdfPath.Valid {
+		return fiber.NewError(fiber.StatusNotFound, "Work order is not signed yet")
+	}
+
+	c.Set("Content-Type", "application/pdf")
+	return c.Download(pdfPath.String, fmt.Sprintf("work-order-%d.pdf", id))
+}
@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"ithelp/handlers"
+)
+
+// StartRecurringTickets creates the support requests of recurring
+// maintenance schedules as their occurrences come within lead time.
+func StartRecurringTickets(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := handlers.RunRecurringTickets(); err != nil {
+				log.Printf("jobs: recurring ticket run failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
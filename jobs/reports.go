@@ -0,0 +1,22 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"ithelp/handlers"
+)
+
+// StartReportSubscriptions emails scheduled reports when they are due.
+func StartReportSubscriptions(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := handlers.RunReportSubscriptions(); err != nil {
+				log.Printf("jobs: report subscription run failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
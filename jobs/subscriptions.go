@@ -0,0 +1,172 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"ithelp/db"
+	"ithelp/events"
+	"ithelp/handlers"
+	"ithelp/notifications"
+	"ithelp/webhooks"
+)
+
+// StartSubscriptionExpiry publishes subscription.expired once for every user
+// and organization whose subscription_end has passed, and once more after
+// each renewal. For organizations the event goes to each org admin.
+func StartSubscriptionExpiry(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := expireSubscriptions(); err != nil {
+				log.Printf("jobs: subscription expiry run failed: %v", err)
+			}
+			if err := expireOrganizationSubscriptions(); err != nil {
+				log.Printf("jobs: organization subscription expiry run failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func expireSubscriptions() error {
+	database, err := db.Connect()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	// a subscription renewed past its expiry expires again at its new end
+	if _, err := database.Exec(`UPDATE users SET subscription_expired_at = NULL WHERE subscription_expired_at IS NOT NULL AND subscription_end >= NOW()`); err != nil {
+		return err
+	}
+
+	rows, err := database.Query(`
+		SELECT id, tenant_id, subscription_plan, subscription_end FROM users
+		WHERE subscription_end IS NOT NULL AND subscription_end < NOW() AND subscription_expired_at IS NULL
+	`)
+	if err != nil {
+		return err
+	}
+
+	type expired struct {
+		userID   int
+		tenantID int
+		plan     string
+		end      time.Time
+	}
+	var list []expired
+	for rows.Next() {
+		var e expired
+		if err := rows.Scan(&e.userID, &e.tenantID, &e.plan, &e.end); err != nil {
+			continue
+		}
+		list = append(list, e)
+	}
+	rows.Close()
+
+	for _, e := range list {
+		if _, err := database.Exec(`UPDATE users SET subscription_expired_at = NOW() WHERE id = ?`, e.userID); err != nil {
+			log.Printf("jobs: marking subscription of user %d expired failed: %v", e.userID, err)
+			continue
+		}
+		if err := handlers.RecordSubscriptionExpiry(database, e.tenantID, &e.userID, nil, e.plan, e.end); err != nil {
+			log.Printf("jobs: recording expiry of user %d failed: %v", e.userID, err)
+		}
+		handlers.PublishEvent(database, events.Event{
+			TenantID: e.tenantID,
+			Type:     events.SubscriptionExpired,
+			UserID:   e.userID,
+			Data:     map[string]any{"subscription_plan": e.plan, "subscription_end": e.end.Format(time.RFC3339Nano)},
+		})
+	}
+	return nil
+}
+
+func expireOrganizationSubscriptions() error {
+	database, err := db.Connect()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	// a subscription renewed past its expiry expires again at its new end
+	if _, err := database.Exec(`UPDATE organizations SET subscription_expired_at = NULL WHERE subscription_expired_at IS NOT NULL AND subscription_end >= NOW()`); err != nil {
+		return err
+	}
+
+	rows, err := database.Query(`
+		SELECT id, tenant_id, name, subscription_plan, subscription_end FROM organizations
+		WHERE subscription_end IS NOT NULL AND subscription_end < NOW() AND subscription_expired_at IS NULL
+	`)
+	if err != nil {
+		return err
+	}
+
+	type expired struct {
+		orgID    int
+		tenantID int
+		name     string
+		plan     string
+		end      time.Time
+	}
+	var list []expired
+	for rows.Next() {
+		var e expired
+		if err := rows.Scan(&e.orgID, &e.tenantID, &e.name, &e.plan, &e.end); err != nil {
+			continue
+		}
+		list = append(list, e)
+	}
+	rows.Close()
+
+	for _, e := range list {
+		if _, err := database.Exec(`UPDATE organizations SET subscription_expired_at = NOW() WHERE id = ?`, e.orgID); err != nil {
+			log.Printf("jobs: marking subscription of organization %d expired failed: %v", e.orgID, err)
+			continue
+		}
+		if err := handlers.RecordSubscriptionExpiry(database, e.tenantID, nil, &e.orgID, e.plan, e.end); err != nil {
+			log.Printf("jobs: recording expiry of organization %d failed: %v", e.orgID, err)
+		}
+
+		admins, err := database.Query(`SELECT user_id FROM organization_members WHERE organization_id = ? AND role = 'org_admin'`, e.orgID)
+		if err != nil {
+			log.Printf("jobs: loading admins of organization %d failed: %v", e.orgID, err)
+			continue
+		}
+		var adminIDs []int
+		for admins.Next() {
+			var id int
+			if admins.Scan(&id) == nil {
+				adminIDs = append(adminIDs, id)
+			}
+		}
+		admins.Close()
+
+		// one webhook for the organization, a notification for each org admin
+		event := events.Event{
+			TenantID: e.tenantID,
+			Type:     events.SubscriptionExpired,
+			Data: map[string]any{
+				"subscription_plan": e.plan,
+				"subscription_end":  e.end.Format(time.RFC3339Nano),
+				"organization_id":   e.orgID,
+				"organization_name": e.name,
+			},
+			CreatedAt: time.Now(),
+		}
+		if err := webhooks.Enqueue(database, event); err != nil {
+			log.Printf("jobs: webhook for expiry of organization %d failed: %v", e.orgID, err)
+		}
+		for _, id := range adminIDs {
+			adminEvent := event
+			adminEvent.UserID = id
+			if err := notifications.Enqueue(database, adminEvent); err != nil {
+				log.Printf("jobs: notifying admin %d of organization %d failed: %v", id, e.orgID, err)
+			}
+			events.Publish(adminEvent)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"ithelp/surveys"
+)
+
+// StartSurveyReminders reminds customers about unanswered satisfaction surveys.
+func StartSurveyReminders(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := surveys.SendReminders(); err != nil {
+				log.Printf("jobs: survey reminder run failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
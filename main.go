@@ -5,10 +5,16 @@ import (
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"time"
 
 	"ithelp/handlers"
+	"ithelp/jobs"
 	"ithelp/middleware"
+	"ithelp/notifications"
+	"ithelp/surveys"
+	"ithelp/webhooks"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/contrib/websocket"
 )
 
 func main() {
@@ -24,6 +30,8 @@ func main() {
         AllowHeaders: "*",
         AllowMethods: "*",
     }))
+	app.Use(middleware.TenantMiddleware())
+	app.Use(middleware.AuditMiddleware())
 
 	// Auth route-lar
 	app.Post("/api/register", handlers.Register)
@@ -32,24 +40,109 @@ func main() {
 
 	// User routes
 	userGroup := app.Group("/api/users", middleware.JWTMiddleware())
-	userGroup.Get("/", handlers.ListUsers)        // Admin only
-	userGroup.Get("/:id", handlers.GetUser)       // Self or admin
-	userGroup.Put("/:id", handlers.UpdateUser)    // Self or admin
+	userGroup.Get("/", handlers.ListUsers) // Admin only
+	userGroup.Get("/:id", handlers.GetUser) // Self or admin
+	userGroup.Put("/:id", handlers.UpdateUser) // Self or admin
+	userGroup.Put("/:id/subscription", handlers.SetUserSubscription) // Admin only
 	userGroup.Delete("/:id", handlers.DeleteUser) // Admin only
 	
 	// Support routes
 	supportGroup := app.Group("/api/support", middleware.JWTMiddleware())
 	supportGroup.Post("/", handlers.CreateSupportRequest)
+	supportGroup.Post("/bulk", handlers.BulkUpdateSupportRequests) // Admin: ids or filter, per-item results
 	supportGroup.Get("/my", handlers.ListMySupportRequests)
 	supportGroup.Get("/", handlers.ListAllSupportRequests)
 	supportGroup.Put("/:id", handlers.UpdateSupportRequest)
 	supportGroup.Get("/assigned", handlers.ListAssignedSupportRequests)
+	supportGroup.Get("/:id/time", handlers.RequestTimeTotals)
+	supportGroup.Get("/:id/work-orders", handlers.ListRequestWorkOrders)
+	supportGroup.Get("/:id/parts", handlers.ListRequestParts)
+	supportGroup.Put("/:id/asset", handlers.LinkRequestAsset) // Owner, assigned tech or admin
+	supportGroup.Post("/:id/parts", handlers.ConsumeParts) // Assigned tech or admin
+	supportGroup.Get("/:id", handlers.GetSupportRequest) // Details with links and history
+	supportGroup.Post("/:id/reopen", handlers.ReopenSupportRequest) // Owner within TICKET_REOPEN_DAYS, or admin
+	supportGroup.Post("/:id/merge", handlers.MergeSupportRequest) // Admin: merge duplicate into target_id
+	supportGroup.Post("/:id/links", handlers.LinkSupportRequests) // Staff: parent, child or related link
+	supportGroup.Delete("/:id/links/:linkId", handlers.UnlinkSupportRequests)
+	supportGroup.Post("/:id/tags", handlers.AddRequestTags) // Staff
+	supportGroup.Delete("/:id/tags/:tag", handlers.RemoveRequestTag)
+
+	app.Get("/api/admin/dashboard", middleware.JWTMiddleware(), handlers.AdminDashboard) // ?from=&to= YYYY-MM-DD
+	app.Get("/api/admin/analytics/subscriptions", middleware.JWTMiddleware(), handlers.SubscriptionAnalytics) // MRR, churn, NRR per month; ?from=&to= YYYY-MM
+	app.Get("/api/admin/subscription-events", middleware.JWTMiddleware(), handlers.ListSubscriptionEvents) // ?user_id=&organization_id=&type=
+	app.Get("/api/admin/audit", middleware.JWTMiddleware(), handlers.ListAuditLog) // ?actor_id=&action=&entity=&entity_id=&from=&to=&q=&before_id=&limit=
+	app.Get("/api/admin/audit/verify", middleware.JWTMiddleware(), handlers.VerifyAuditLog) // recomputes the hash chain
+	app.Get("/api/reports/:name", middleware.JWTMiddleware(), handlers.ExportReport) // tickets, technicians, plan-usage, revenue; ?format=csv|xlsx plus listing filters
+	reportSubs := app.Group("/api/report-subscriptions", middleware.JWTMiddleware())
+	reportSubs.Get("/", handlers.ListReportSubscriptions)
+	reportSubs.Post("/", handlers.CreateReportSubscription) // report, filters, format, recipients, cron or RRULE schedule
+	reportSubs.Get("/runs", handlers.ListReportRuns) // ?status=failed
+	reportSubs.Put("/:id", handlers.UpdateReportSubscription)
+	reportSubs.Delete("/:id", handlers.DeleteReportSubscription)
+	reportSubs.Get("/:id/runs", handlers.ListReportRuns)
+	reportSubs.Post("/:id/run", handlers.RunReportSubscription) // Send now
+
+	// Recurring preventive maintenance schedules, admin only
+	recurringGroup := app.Group("/api/recurring", middleware.JWTMiddleware())
+	recurringGroup.Get("/", handlers.ListRecurringTickets)
+	recurringGroup.Post("/", handlers.CreateRecurringTicket) // schedule is cron or RRULE
+	recurringGroup.Get("/:id", handlers.GetRecurringTicket) // With the next occurrences
+	recurringGroup.Put("/:id", handlers.UpdateRecurringTicket)
+	recurringGroup.Delete("/:id", handlers.DeleteRecurringTicket)
+
+	// Tags and saved ticket views; run a view with GET /api/support?view_id=
+	app.Get("/api/tags", middleware.JWTMiddleware(), handlers.ListTags)
+	viewGroup := app.Group("/api/views", middleware.JWTMiddleware())
+	viewGroup.Get("/", handlers.ListViews) // With live counts
+	viewGroup.Post("/", handlers.CreateView)
+	viewGroup.Put("/:id", handlers.UpdateView)
+	viewGroup.Delete("/:id", handlers.DeleteView)
+
+	// Ticket categories with custom fields
+	categoryGroup := app.Group("/api/categories", middleware.JWTMiddleware())
+	categoryGroup.Get("/", handlers.ListCategories)
+	categoryGroup.Get("/report", handlers.CategoryReport) // Admin only
+	categoryGroup.Post("/", handlers.CreateCategory) // Admin only
+	categoryGroup.Put("/:id", handlers.UpdateCategory) // Admin only
+	categoryGroup.Delete("/:id", handlers.DeleteCategory) // Admin only
+	categoryGroup.Post("/:id/fields", handlers.CreateCategoryField)
+	categoryGroup.Put("/:id/fields/:fieldId", handlers.UpdateCategoryField)
+	categoryGroup.Delete("/:id/fields/:fieldId", handlers.DeleteCategoryField)
+
+	// Knowledge base
+	kbGroup := app.Group("/api/kb", middleware.JWTMiddleware())
+	kbGroup.Get("/suggest", handlers.SuggestArticles) // ?title= of the ticket being written
+	kbGroup.Post("/suggestions/:id/resolved", handlers.ResolveSuggestion)
+	kbGroup.Get("/deflection", handlers.DeflectionReport) // Admin only
+	kbGroup.Get("/articles", handlers.ListArticles)
+	kbGroup.Post("/articles", handlers.CreateArticle) // Staff
+	kbGroup.Get("/articles/:id", handlers.GetArticle)
+	kbGroup.Put("/articles/:id", handlers.UpdateArticle) // Staff
+	kbGroup.Delete("/articles/:id", handlers.DeleteArticle) // Admin only
+	kbGroup.Post("/articles/:id/publish", handlers.PublishArticle) // Admin only
+	kbGroup.Post("/articles/:id/unpublish", handlers.UnpublishArticle) // Admin only
+	kbGroup.Post("/articles/:id/feedback", handlers.ArticleFeedback)
 
 	// Technician notes
 	noteGroup := app.Group("/api/notes", middleware.JWTMiddleware())
-	noteGroup.Post("/", handlers.AddTechNote)          // only tech
+	noteGroup.Post("/", handlers.AddTechNote) // only tech
 	noteGroup.Get("/:id", handlers.ListNotesByRequest) // public per request_id
 
+	// Canned responses and macros, shared (admin-managed) or personal
+	cannedGroup := app.Group("/api/canned-responses", middleware.JWTMiddleware())
+	cannedGroup.Get("/", handlers.ListCannedResponses)
+	cannedGroup.Post("/", handlers.CreateCannedResponse)
+	cannedGroup.Put("/:id", handlers.UpdateCannedResponse)
+	cannedGroup.Delete("/:id", handlers.DeleteCannedResponse)
+	cannedGroup.Get("/:id/render", handlers.RenderCannedResponse) // ?request_id= fills the placeholders
+
+	macroGroup := app.Group("/api/macros", middleware.JWTMiddleware())
+	macroGroup.Get("/", handlers.ListMacros)
+	macroGroup.Post("/", handlers.CreateMacro)
+	macroGroup.Put("/:id", handlers.UpdateMacro)
+	macroGroup.Delete("/:id", handlers.DeleteMacro)
+	macroGroup.Post("/:id/apply", handlers.ApplyMacro) // Permission checked per action
+
 	// Plan routes
 	planGroup := app.Group("/api/plans", middleware.JWTMiddleware())
 	planGroup.Get("/", handlers.ListPlans)
@@ -57,7 +150,143 @@ func main() {
 	planGroup.Put("/:id", handlers.UpdatePlan)
 	planGroup.Delete("/:id", handlers.DeletePlan)
 
+	// Technician profiles
+	techGroup := app.Group("/api/techs", middleware.JWTMiddleware())
+	techGroup.Get("/", handlers.ListTechnicians) // Admin only
+	techGroup.Get("/leaderboard", handlers.TechnicianLeaderboard) // Admin only; ?sort=&from=&to=
+	techGroup.Get("/:id", handlers.GetTechnician) // Self or admin
+	techGroup.Put("/:id", handlers.UpdateTechnicianProfile) // Admin only
+	techGroup.Post("/:id/calendar-token", handlers.CreateCalendarToken) // Self or admin
+	techGroup.Get("/:id/time", handlers.TechnicianTimeTotals) // Self or admin
+	techGroup.Get("/:id/metrics", handlers.TechnicianMetrics) // Self or admin; ?from=&to= YYYY-MM-DD
+
+	// Onsite visit scheduling
+	appointmentGroup := app.Group("/api/appointments", middleware.JWTMiddleware())
+	appointmentGroup.Get("/", handlers.ListAppointments)
+	appointmentGroup.Post("/", handlers.CreateAppointment)
+	appointmentGroup.Get("/slots", handlers.AppointmentSlots)
+	appointmentGroup.Put("/:id", handlers.RescheduleAppointment)
+	appointmentGroup.Post("/:id/cancel", handlers.CancelAppointment)
+	appointmentGroup.Post("/:id/complete", handlers.CompleteAppointment)
+
+	// Technician time tracking
+	timeGroup := app.Group("/api/time-entries", middleware.JWTMiddleware())
+	timeGroup.Get("/", handlers.ListTimeEntries)
+	timeGroup.Post("/", handlers.LogTime)
+	timeGroup.Post("/start", handlers.StartTimer)
+	timeGroup.Post("/:id/stop", handlers.StopTimer)
+	timeGroup.Put("/:id", handlers.UpdateTimeEntry)
+	timeGroup.Delete("/:id", handlers.DeleteTimeEntry)
+	timeGroup.Post("/:id/approve", handlers.ApproveTimeEntry) // Admin only
+	timeGroup.Post("/:id/reject", handlers.RejectTimeEntry) // Admin only
+
+	// Work orders with customer sign-off
+	workOrderGroup := app.Group("/api/work-orders", middleware.JWTMiddleware())
+	workOrderGroup.Post("/", handlers.CreateWorkOrder)
+	workOrderGroup.Get("/:id", handlers.GetWorkOrder)
+	workOrderGroup.Put("/:id", handlers.UpdateWorkOrder)
+	workOrderGroup.Post("/:id/sign", handlers.SignWorkOrder)
+	workOrderGroup.Get("/:id/pdf", handlers.DownloadWorkOrderPDF)
+
+	// Customer assets
+	assetGroup := app.Group("/api/assets", middleware.JWTMiddleware())
+	assetGroup.Get("/", handlers.ListAssets)
+	assetGroup.Post("/", handlers.CreateAsset)
+	assetGroup.Get("/:id", handlers.GetAsset)
+	assetGroup.Put("/:id", handlers.UpdateAsset)
+	assetGroup.Delete("/:id", handlers.DeleteAsset)
+	assetGroup.Get("/:id/history", handlers.AssetHistory)
+
+	// Organizations (business customers)
+	orgGroup := app.Group("/api/orgs", middleware.JWTMiddleware())
+	orgGroup.Get("/", handlers.ListOrganizations) // Admin only
+	orgGroup.Post("/", handlers.CreateOrganization)
+	orgGroup.Get("/my", handlers.GetMyOrganization)
+	orgGroup.Post("/invitations/:token/accept", handlers.AcceptOrganizationInvitation)
+	orgGroup.Get("/:id", handlers.GetOrganization)
+	orgGroup.Put("/:id", handlers.UpdateOrganization) // Org admin or admin
+	orgGroup.Put("/:id/subscription", handlers.SetOrganizationSubscription) // Admin only
+	orgGroup.Get("/:id/members", handlers.ListOrganizationMembers)
+	orgGroup.Put("/:id/members/:userId", handlers.UpdateOrganizationMember)
+	orgGroup.Delete("/:id/members/:userId", handlers.RemoveOrganizationMember)
+	orgGroup.Get("/:id/invitations", handlers.ListOrganizationInvitations)
+	orgGroup.Post("/:id/invitations", handlers.InviteOrganizationMember)
+	orgGroup.Delete("/:id/invitations/:invitationId", handlers.RevokeOrganizationInvitation)
+	orgGroup.Get("/:id/requests", handlers.ListOrganizationRequests) // Org admin or admin
+
+	// Parts and stock
+	partGroup := app.Group("/api/parts", middleware.JWTMiddleware())
+	partGroup.Get("/", handlers.ListParts) // Tech or admin
+	partGroup.Post("/", handlers.CreatePart) // Admin only
+	partGroup.Put("/:id", handlers.UpdatePart) // Admin only
+
+	stockGroup := app.Group("/api/stock", middleware.JWTMiddleware())
+	stockGroup.Get("/", handlers.ListStock)
+	stockGroup.Get("/low", handlers.ListLowStock)
+	stockGroup.Get("/locations", handlers.ListStockLocations)
+	stockGroup.Post("/locations", handlers.CreateStockLocation)
+	stockGroup.Post("/receive", handlers.ReceiveStock)
+	stockGroup.Post("/transfer", handlers.TransferStock)
+	stockGroup.Post("/adjust", handlers.AdjustStock)
+
+	// Invoices for billable parts
+	invoiceGroup := app.Group("/api/invoices", middleware.JWTMiddleware())
+	invoiceGroup.Get("/", handlers.ListInvoices)
+	invoiceGroup.Get("/:id", handlers.GetInvoice)
+	invoiceGroup.Post("/:id/issue", handlers.IssueInvoice) // Admin only
+	invoiceGroup.Post("/:id/pay", handlers.PayInvoice) // Admin only
+
+	// Public iCalendar feed, authenticated by the secret token in the URL
+	app.Get("/api/calendar/:token.ics", handlers.TechnicianCalendar)
+
+	// Satisfaction surveys: public pages authenticated by the signed link token
+	app.Get("/api/surveys/:token", handlers.GetSurvey)
+	app.Post("/api/surveys/:token", handlers.SubmitSurvey)
+	csatGroup := app.Group("/api/csat", middleware.JWTMiddleware())
+	csatGroup.Get("/", handlers.CSATReport) // Admin only, ?group_by=technician|category
+	csatGroup.Get("/responses", handlers.ListSurveyResponses) // Admin, or tech for own ratings
+
+	// Webhook routes (admin only)
+	webhookGroup := app.Group("/api/webhooks", middleware.JWTMiddleware())
+	webhookGroup.Get("/", handlers.ListWebhooks)
+	webhookGroup.Post("/", handlers.CreateWebhook)
+	webhookGroup.Put("/:id", handlers.UpdateWebhook)
+	webhookGroup.Delete("/:id", handlers.DeleteWebhook)
+	webhookGroup.Get("/:id/deliveries", handlers.ListWebhookDeliveries)
+	webhookGroup.Post("/deliveries/:deliveryId/redeliver", handlers.RedeliverWebhook)
+
+	// Branding of the tenant resolved from the host name or X-Tenant header
+	app.Get("/api/branding", handlers.GetBranding)
+
+	// Tenant provisioning (super-admin only)
+	tenantGroup := app.Group("/api/tenants", middleware.JWTMiddleware())
+	tenantGroup.Get("/", handlers.ListTenants)
+	tenantGroup.Post("/", handlers.CreateTenant)
+	tenantGroup.Get("/:id", handlers.GetTenant)
+	tenantGroup.Put("/:id", handlers.UpdateTenant)
+
+	// Notification center
+	notificationGroup := app.Group("/api/notifications", middleware.JWTMiddleware())
+	notificationGroup.Get("/", handlers.ListNotifications)
+	notificationGroup.Get("/unread-count", handlers.UnreadNotificationCount)
+	notificationGroup.Put("/read-all", handlers.MarkAllNotificationsRead)
+	notificationGroup.Get("/preferences", handlers.GetNotificationPreferences)
+	notificationGroup.Put("/preferences", handlers.UpdateNotificationPreferences)
+	notificationGroup.Put("/:id/read", handlers.MarkNotificationRead)
+
+	// Real-time ticket updates (SSE, WebSocket)
+	app.Get("/api/stream", middleware.JWTStreamMiddleware(), handlers.StreamEvents)
+	app.Get("/api/ws", middleware.JWTStreamMiddleware(), handlers.WebSocketUpgrade, websocket.New(handlers.StreamWebSocket))
+
 
+	// Background workers
+	webhooks.Start()
+	notifications.Start()
+	surveys.Start()
+	jobs.StartSubscriptionExpiry(time.Hour)
+	jobs.StartSurveyReminders(time.Hour)
+	jobs.StartRecurringTickets(15 * time.Minute)
+	jobs.StartReportSubscriptions(5 * time.Minute)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -5,6 +5,7 @@ import (
  
 	"github.com/gofiber/fiber/v2"
 	"strings"
+	"ithelp/models"
 	"ithelp/utils"
  
 )
@@ -28,8 +29,50 @@ func JWTMiddleware() fiber.Handler {
             return fiber.NewError(fiber.StatusUnauthorized, "Invalid token: "+err.Error())
         }
 
+        if err := checkTenant(c, user); err != nil {
+            return err
+        }
+
         // Store the parsed user claims with proper type
         c.Locals("user", user) // Store the actual models.User struct
         return c.Next()
     }
-}
\ No newline at end of file
+}
+
+// JWTStreamMiddleware is used on the real-time endpoints. Browsers cannot set
+// headers on EventSource or WebSocket connections, so the token may also be
+// passed as ?token=<token>.
+func JWTStreamMiddleware() fiber.Handler {
+    return func(c *fiber.Ctx) error {
+        token := c.Query("token")
+        if token == "" {
+            parts := strings.Split(c.Get("Authorization"), " ")
+            if len(parts) != 2 || parts[0] != "Bearer" {
+                return fiber.NewError(fiber.StatusUnauthorized, "Missing token")
+            }
+            token = parts[1]
+        }
+
+        user, err := utils.ParseJWT(token)
+        if err != nil {
+            return fiber.NewError(fiber.StatusUnauthorized, "Invalid token: "+err.Error())
+        }
+        if err := checkTenant(c, user); err != nil {
+            return err
+        }
+
+        c.Locals("user", user)
+        return c.Next()
+    }
+}
+
+
+// checkTenant rejects tokens issued by another tenant than the one the
+// request resolved to, so a user can never act outside their own tenant.
+func checkTenant(c *fiber.Ctx, user models.User) error {
+    tenant, ok := c.Locals("tenant").(models.Tenant)
+    if ok && tenant.ID != user.TenantID {
+        return fiber.NewError(fiber.StatusUnauthorized, "Token belongs to another tenant")
+    }
+    return nil
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"ithelp/models"
+	"ithelp/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// tenantApp serves /me behind JWTMiddleware for requests resolved to tenant.
+func tenantApp(tenant models.Tenant) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("tenant", tenant)
+		return c.Next()
+	})
+	app.Get("/me", JWTMiddleware(), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	app.Get("/stream", JWTStreamMiddleware(), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	return app
+}
+
+func TestCheckTenant(t *testing.T) {
+	tests := []struct {
+		name        string
+		tenant      *models.Tenant // nil: the request resolved to no tenant
+		tokenTenant int
+		want        int
+	}{
+		{"same tenant", &models.Tenant{ID: 2}, 2, fiber.StatusOK},
+		{"token of another tenant", &models.Tenant{ID: 2}, 3, fiber.StatusUnauthorized},
+		{"default tenant token on another tenant", &models.Tenant{ID: 2}, 1, fiber.StatusUnauthorized},
+		{"no resolved tenant", nil, 3, fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				if tt.tenant != nil {
+					c.Locals("tenant", *tt.tenant)
+				}
+				if err := checkTenant(c, models.User{ID: 7, Role: "admin", TenantID: tt.tokenTenant}); err != nil {
+					return err
+				}
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTMiddlewareRejectsOtherTenant(t *testing.T) {
+	app := tenantApp(models.Tenant{ID: 2})
+
+	tests := []struct {
+		name        string
+		path        string
+		tokenTenant int
+		want        int
+	}{
+		{"header token, same tenant", "/me", 2, fiber.StatusOK},
+		{"header token, other tenant", "/me", 3, fiber.StatusUnauthorized},
+		{"stream token, same tenant", "/stream", 2, fiber.StatusOK},
+		{"stream token, other tenant", "/stream", 3, fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := utils.GenerateJWT(7, "admin", tt.tokenTenant)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
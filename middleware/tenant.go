@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"log"
+
+	"ithelp/tenants"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TenantMiddleware resolves the tenant of every request from the X-Tenant
+// header or the host name and stores it in locals under "tenant".
+func TenantMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tenant, err := tenants.Resolve(c.Get(tenants.Header), c.Hostname())
+		if err == tenants.ErrUnknown {
+			return fiber.NewError(fiber.StatusNotFound, "Unknown tenant")
+		}
+		if err != nil {
+			log.Printf("tenant resolution failed: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "Tenant lookup failed")
+		}
+		if !tenant.Active {
+			return fiber.NewError(fiber.StatusForbidden, "Tenant is suspended")
+		}
+
+		c.Locals("tenant", tenant)
+		return c.Next()
+	}
+}
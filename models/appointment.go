@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	AppointmentScheduled = "scheduled"
+	AppointmentCompleted = "completed"
+	AppointmentCancelled = "cancelled"
+)
+
+type Appointment struct {
+	ID              int       `json:"id"`
+	RequestID       int       `json:"request_id"`
+	TechnicianID    int       `json:"technician_id"`
+	CustomerID      int       `json:"customer_id"`
+	Address         string    `json:"address"`
+	StartsAt        time.Time `json:"starts_at"`
+	EndsAt          time.Time `json:"ends_at"`
+	Status          string    `json:"status"`
+	Notes           string    `json:"notes"`
+	CancelReason    string    `json:"cancel_reason,omitempty"`
+	RescheduleCount int       `json:"reschedule_count"` // by the customer
+	CreatedAt       string    `json:"created_at"`
+}
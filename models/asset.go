@@ -0,0 +1,16 @@
+package models
+
+type Asset struct {
+	ID            int     `json:"id"`
+	UserID        int     `json:"user_id"`
+	Type          string  `json:"type"` // laptop, desktop, printer, router...
+	Make          string  `json:"make"`
+	Model         string  `json:"model"`
+	SerialNumber  string  `json:"serial_number"`
+	OS            string  `json:"os"`
+	PurchaseDate  *string `json:"purchase_date"`  // YYYY-MM-DD
+	WarrantyUntil *string `json:"warranty_until"` // YYYY-MM-DD
+	Notes         string  `json:"notes"`
+	TicketCount   int     `json:"ticket_count"`
+	CreatedAt     string  `json:"created_at"`
+}
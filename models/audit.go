@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry is an entry of the append-only audit log. Before and After are
+// the JSON snapshots of the entity, null when the action has none.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	ActorID   *int            `json:"actor_id"`
+	ActorName *string         `json:"actor_name"`
+	ActorRole *string         `json:"actor_role"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  *string         `json:"entity_id"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	IP        *string         `json:"ip"`
+	UserAgent *string         `json:"user_agent"`
+	CreatedAt time.Time       `json:"created_at"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+}
@@ -0,0 +1,40 @@
+package models
+
+// CannedResponse is reply text with placeholders such as {{customer_name}}.
+// Shared responses have no owner.
+type CannedResponse struct {
+	ID        int    `json:"id"`
+	OwnerID   *int   `json:"owner_id"`
+	Shared    bool   `json:"shared"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// Macro action types
+const (
+	MacroSetStatus = "set_status"
+	MacroReply     = "reply"
+	MacroNote      = "note"
+	MacroAssign    = "assign"
+)
+
+// MacroAction is one step of a macro. Body is used by reply and note,
+// Status by set_status and TechnicianID by assign.
+type MacroAction struct {
+	Type         string `json:"type"`
+	Status       string `json:"status,omitempty"`
+	Body         string `json:"body,omitempty"`
+	TechnicianID int    `json:"technician_id,omitempty"`
+}
+
+type Macro struct {
+	ID        int           `json:"id"`
+	OwnerID   *int          `json:"owner_id"`
+	Shared    bool          `json:"shared"`
+	Name      string        `json:"name"`
+	Actions   []MacroAction `json:"actions"`
+	CreatedAt string        `json:"created_at"`
+	UpdatedAt string        `json:"updated_at"`
+}
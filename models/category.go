@@ -0,0 +1,39 @@
+package models
+
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+const (
+	FieldText   = "text"
+	FieldNumber = "number"
+	FieldSelect = "select"
+	FieldDate   = "date"  // YYYY-MM-DD
+	FieldAsset  = "asset" // id of one of the requester's assets
+)
+
+type CategoryField struct {
+	ID         int      `json:"id"`
+	CategoryID int      `json:"category_id"`
+	Key        string   `json:"key"`
+	Label      string   `json:"label"`
+	Type       string   `json:"type"`
+	Required   bool     `json:"required"`
+	Options    []string `json:"options,omitempty"`
+	SortOrder  int      `json:"sort_order"`
+}
+
+type Category struct {
+	ID              int             `json:"id"`
+	ParentID        *int            `json:"parent_id"`
+	Name            string          `json:"name"`
+	DefaultPriority *string         `json:"default_priority"` // nil inherits from the parent
+	SLAHours        *int            `json:"sla_hours"`        // nil inherits from the parent
+	SortOrder       int             `json:"sort_order"`
+	Active          bool            `json:"active"`
+	Fields          []CategoryField `json:"fields"`
+	Children        []*Category     `json:"children,omitempty"`
+}
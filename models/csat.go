@@ -0,0 +1,25 @@
+package models
+
+type CSATSurvey struct {
+	ID           int     `json:"id"`
+	RequestID    int     `json:"request_id"`
+	CustomerID   int     `json:"customer_id"`
+	TechnicianID *int    `json:"technician_id"`
+	Category     *string `json:"category"`
+	Rating       *int    `json:"rating"`
+	Comment      *string `json:"comment"`
+	SentAt       string  `json:"sent_at"`
+	RemindedAt   *string `json:"reminded_at"`
+	RespondedAt  *string `json:"responded_at"`
+}
+
+// CSATStats aggregates answered surveys of a technician or category.
+type CSATStats struct {
+	ID            *int    `json:"id"` // technician or category id
+	Name          string  `json:"name"`
+	Sent          int     `json:"sent"`
+	Responses     int     `json:"responses"`
+	ResponseRate  float64 `json:"response_rate"` // percent
+	AverageRating float64 `json:"average_rating"`
+	CSAT          float64 `json:"csat"` // percent of responses rated 4 or 5
+}
@@ -0,0 +1,43 @@
+package models
+
+type CountBy struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// TechnicianLoad is a technician's share of the tickets: Open right now,
+// Received and Resolved within the dashboard period.
+type TechnicianLoad struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Open     int    `json:"open"`
+	Received int    `json:"received"`
+	Resolved int    `json:"resolved"`
+}
+
+type PlanSubscriptions struct {
+	Plan          string `json:"plan"`
+	Users         int    `json:"users"`
+	Organizations int    `json:"organizations"`
+}
+
+// Dashboard is the admin overview. Open counts, SLA breaches and
+// subscriptions are as of now, the rest covers From to To.
+type Dashboard struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	OpenByStatus     []CountBy `json:"open_by_status"`
+	OpenByCategory   []CountBy `json:"open_by_category"`
+	Unassigned       int       `json:"unassigned"`
+	SLABreachesToday int       `json:"sla_breaches_today"`
+
+	Created                 int      `json:"created"`
+	Resolved                int      `json:"resolved"`
+	AvgFirstResponseMinutes *float64 `json:"avg_first_response_minutes"`
+	AvgResolutionMinutes    *float64 `json:"avg_resolution_minutes"`
+
+	Technicians         []TechnicianLoad    `json:"technicians"`
+	NewRegistrations    int                 `json:"new_registrations"`
+	ActiveSubscriptions []PlanSubscriptions `json:"active_subscriptions"`
+}
@@ -0,0 +1,40 @@
+package models
+
+type Part struct {
+	ID                int     `json:"id"`
+	SKU               string  `json:"sku"`
+	Name              string  `json:"name"`
+	Category          string  `json:"category"`
+	UnitPrice         float64 `json:"unit_price"`
+	LowStockThreshold int     `json:"low_stock_threshold"`
+	Active            bool    `json:"active"`
+}
+
+type StockLocation struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Type         string `json:"type"` // warehouse, van
+	TechnicianID *int   `json:"technician_id"`
+}
+
+type StockLevel struct {
+	PartID            int    `json:"part_id"`
+	SKU               string `json:"sku"`
+	PartName          string `json:"part_name"`
+	LocationID        int    `json:"location_id"`
+	LocationName      string `json:"location_name"`
+	Quantity          int    `json:"quantity"`
+	LowStockThreshold int    `json:"low_stock_threshold"`
+}
+
+type RequestPart struct {
+	ID         int     `json:"id"`
+	RequestID  int     `json:"request_id"`
+	PartID     int     `json:"part_id"`
+	PartName   string  `json:"part_name"`
+	LocationID int     `json:"location_id"`
+	Quantity   int     `json:"quantity"`
+	UnitPrice  float64 `json:"unit_price"`
+	Billable   bool    `json:"billable"`
+	CreatedAt  string  `json:"created_at"`
+}
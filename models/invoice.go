@@ -0,0 +1,28 @@
+package models
+
+const (
+	InvoiceDraft  = "draft"
+	InvoiceIssued = "issued"
+	InvoicePaid   = "paid"
+	InvoiceVoid   = "void"
+)
+
+type InvoiceItem struct {
+	ID          int     `json:"id"`
+	RequestID   *int    `json:"request_id"`
+	Description string  `json:"description"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	Amount      float64 `json:"amount"`
+}
+
+type Invoice struct {
+	ID        int           `json:"id"`
+	UserID    int           `json:"user_id"`
+	Status    string        `json:"status"`
+	Total     float64       `json:"total"`
+	IssuedAt  *string       `json:"issued_at"`
+	PaidAt    *string       `json:"paid_at"`
+	CreatedAt string        `json:"created_at"`
+	Items     []InvoiceItem `json:"items,omitempty"`
+}
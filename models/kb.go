@@ -0,0 +1,31 @@
+package models
+
+const (
+	ArticleDraft     = "draft"
+	ArticlePublished = "published"
+)
+
+type Article struct {
+	ID              int     `json:"id"`
+	Category        string  `json:"category"`
+	Title           string  `json:"title"`
+	Body            string  `json:"body,omitempty"` // markdown
+	HTML            string  `json:"html,omitempty"` // rendered body, single article only
+	Status          string  `json:"status"`
+	AuthorID        int     `json:"author_id"`
+	ViewCount       int     `json:"view_count"`
+	HelpfulCount    int     `json:"helpful_count"`
+	NotHelpfulCount int     `json:"not_helpful_count"`
+	PublishedAt     *string `json:"published_at"`
+	CreatedAt       string  `json:"created_at"`
+	UpdatedAt       string  `json:"updated_at"`
+}
+
+type DeflectionStats struct {
+	Suggestions   int     `json:"suggestions"`    // suggest calls that returned articles
+	Opened        int     `json:"opened"`         // an article was opened
+	Resolved      int     `json:"resolved"`       // customer said it solved the problem
+	TicketsFiled  int     `json:"tickets_filed"`  // filed a ticket anyway
+	Deflected     int     `json:"deflected"`      // resolved, or opened without filing
+	DeflectionPct float64 `json:"deflection_pct"` // deflected / suggestions
+}
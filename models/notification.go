@@ -0,0 +1,19 @@
+package models
+
+type Notification struct {
+	ID        int     `json:"id"`
+	UserID    int     `json:"user_id"`
+	Type      string  `json:"type"`
+	Title     string  `json:"title"`
+	Body      string  `json:"body"`
+	RequestID *int    `json:"request_id"`
+	ReadAt    *string `json:"read_at"`
+	CreatedAt string  `json:"created_at"`
+}
+
+type NotificationPreference struct {
+	EventType string `json:"event_type"`
+	InApp     bool   `json:"in_app"`
+	Email     bool   `json:"email"`
+	SMS       bool   `json:"sms"`
+}
@@ -0,0 +1,35 @@
+package models
+
+const (
+	OrgRoleAdmin    = "org_admin"
+	OrgRoleEmployee = "employee"
+)
+
+type Organization struct {
+	ID                int     `json:"id"`
+	Name              string  `json:"name"`
+	SubscriptionPlan  *string `json:"subscription_plan"`
+	SubscriptionStart *string `json:"subscription_start"`
+	SubscriptionEnd   *string `json:"subscription_end"`
+	MemberCount       int     `json:"member_count"`
+	CreatedAt         string  `json:"created_at"`
+}
+
+type OrganizationMember struct {
+	UserID   int    `json:"user_id"`
+	Name     string `json:"name"`
+	Phone    string `json:"phone"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	JoinedAt string `json:"joined_at"`
+}
+
+type OrganizationInvitation struct {
+	ID         int     `json:"id"`
+	Phone      *string `json:"phone"`
+	Email      *string `json:"email"`
+	Role       string  `json:"role"`
+	ExpiresAt  string  `json:"expires_at"`
+	AcceptedAt *string `json:"accepted_at"`
+	CreatedAt  string  `json:"created_at"`
+}
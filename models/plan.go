@@ -6,4 +6,17 @@ type Plan struct {
 	Price       float64 `json:"price"`
 	RemoteCalls int     `json:"remote_calls"`
 	OnsiteCalls int     `json:"onsite_calls"`
-}
\ No newline at end of file
+}
+
+// PlanUsage is how much of a plan's call quota a customer used in the
+// current subscription period.
+type PlanUsage struct {
+	OrganizationID  *int   `json:"organization_id"` // set when the quota is shared by an organization
+	Plan            string `json:"plan"`
+	RemoteCalls     int    `json:"remote_calls"`
+	OnsiteCalls     int    `json:"onsite_calls"`
+	RemoteUsed      int    `json:"remote_used"`
+	OnsiteUsed      int    `json:"onsite_used"`
+	RemoteRemaining int    `json:"remote_remaining"`
+	OnsiteRemaining int    `json:"onsite_remaining"`
+}
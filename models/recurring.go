@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// RecurringTicket creates a support request from its template at every
+// occurrence of Schedule, LeadDays in advance.
+type RecurringTicket struct {
+	ID             int            `json:"id"`
+	TenantID       int            `json:"-"`
+	CustomerID     int            `json:"customer_id"`
+	OrganizationID *int           `json:"organization_id"`
+	Title          string         `json:"title"`
+	Description    string         `json:"description"`
+	CategoryID     *int           `json:"category_id"`
+	CustomFields   map[string]any `json:"custom_fields,omitempty"`
+	Region         *string        `json:"region"`
+	TechnicianID   *int           `json:"technician_id"`
+	Schedule       string         `json:"schedule"`
+	StartsAt       time.Time      `json:"starts_at"`
+	LeadDays       int            `json:"lead_days"`
+	Onsite         bool           `json:"onsite"`
+	Address        *string        `json:"address"`
+	VisitMinutes   int            `json:"visit_minutes"`
+	Active         bool           `json:"active"`
+	NextRunAt      *time.Time     `json:"next_run_at"`
+	LastRunAt      *time.Time     `json:"last_run_at"`
+	LastError      *string        `json:"last_error"`
+	CreatedAt      string         `json:"created_at"`
+}
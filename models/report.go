@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// ReportSubscription emails a report export to its recipients at every
+// occurrence of Schedule.
+type ReportSubscription struct {
+	ID         int               `json:"id"`
+	Name       string            `json:"name"`
+	Report     string            `json:"report"`
+	Filters    map[string]string `json:"filters"`
+	Format     string            `json:"format"`
+	Recipients []string          `json:"recipients"`
+	Schedule   string            `json:"schedule"`
+	PeriodDays int               `json:"period_days"`
+	Active     bool              `json:"active"`
+	NextRunAt  *time.Time        `json:"next_run_at"`
+	LastRunAt  *time.Time        `json:"last_run_at"`
+	LastError  *string           `json:"last_error"`
+	CreatedBy  int               `json:"created_by"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// ReportRun is one generation and delivery of a subscription.
+type ReportRun struct {
+	ID             int        `json:"id"`
+	SubscriptionID int        `json:"subscription_id"`
+	Status         string     `json:"status"` // running, sent, failed
+	Manual         bool       `json:"manual"`
+	PeriodFrom     *string    `json:"period_from"`
+	PeriodTo       *string    `json:"period_to"`
+	SizeBytes      *int       `json:"size_bytes"`
+	Error          *string    `json:"error"`
+	StartedAt      time.Time  `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+const (
+	SubStarted    = "started"
+	SubRenewed    = "renewed"
+	SubUpgraded   = "upgraded"
+	SubDowngraded = "downgraded"
+	SubChanged    = "changed" // another plan at the same price
+	SubCancelled  = "cancelled"
+	SubExpired    = "expired"
+)
+
+// SubscriptionEvent is an entry of the subscription ledger. MRR is the
+// monthly price of the plan before and after the event.
+type SubscriptionEvent struct {
+	ID             int        `json:"id"`
+	UserID         *int       `json:"user_id"`
+	OrganizationID *int       `json:"organization_id"`
+	Type           string     `json:"type"`
+	FromPlan       *string    `json:"from_plan"`
+	ToPlan         *string    `json:"to_plan"`
+	MRRBefore      float64    `json:"mrr_before"`
+	MRRAfter       float64    `json:"mrr_after"`
+	PeriodStart    *time.Time `json:"period_start"`
+	PeriodEnd      *time.Time `json:"period_end"`
+	ActorID        *int       `json:"actor_id"`
+	OccurredAt     time.Time  `json:"occurred_at"`
+}
+
+type PlanMonth struct {
+	Plan        string  `json:"plan"`
+	Subscribers int     `json:"subscribers"`
+	MRR         float64 `json:"mrr"`
+}
+
+// SubscriptionMonth is the subscription business of one calendar month.
+// Subscribers and MRR are counted at its start and end; the movements
+// explain the difference: MRREnd = MRRStart + New + Expansion - Contraction - Churned.
+type SubscriptionMonth struct {
+	Month string `json:"month"` // YYYY-MM
+
+	MRRStart       float64 `json:"mrr_start"`
+	MRREnd         float64 `json:"mrr_end"`
+	NewMRR         float64 `json:"new_mrr"`
+	ExpansionMRR   float64 `json:"expansion_mrr"`
+	ContractionMRR float64 `json:"contraction_mrr"`
+	ChurnedMRR     float64 `json:"churned_mrr"`
+
+	SubscribersStart   int `json:"subscribers_start"`
+	SubscribersEnd     int `json:"subscribers_end"`
+	NewSubscribers     int `json:"new_subscribers"`
+	ChurnedSubscribers int `json:"churned_subscribers"`
+	Upgrades           int `json:"upgrades"`
+	Downgrades         int `json:"downgrades"`
+
+	ChurnRate           *float64    `json:"churn_rate"`            // percent of the subscribers at the start
+	NetRevenueRetention *float64    `json:"net_revenue_retention"` // percent of MRRStart kept by those subscribers
+	Plans               []PlanMonth `json:"plans"`                 // at the end of the month
+}
@@ -1,13 +1,57 @@
 package models
 
+// Tickets in these statuses no longer count as open work
+const (
+	StatusResolved = "resolved"
+	StatusClosed   = "closed"
+)
+
+// StatusReopened is set when the customer reopens a resolved ticket
+const StatusReopened = "reopened"
+
+const (
+	LinkParent  = "parent"
+	LinkRelated = "related"
+)
+
 type SupportRequest struct {
-	ID          int    `json:"id"`
-	UserID      int    `json:"user_id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Category    string `json:"category"`
-	Status      string `json:"status"`
-	AssignedTo  *int   `json:"assigned_to"`
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
-}
\ No newline at end of file
+	ID           int            `json:"id"`
+	UserID       int            `json:"user_id"`
+	Title        string         `json:"title"`
+	Description  string         `json:"description"`
+	Category     string         `json:"category"`
+	Status       string         `json:"status"`
+	AssignedTo   *int           `json:"assigned_to"`
+	Region       string         `json:"region"`
+	AssetID      *int           `json:"asset_id"`
+	CategoryID   *int           `json:"category_id"`
+	Priority     string         `json:"priority,omitempty"`
+	DueAt        *string        `json:"due_at,omitempty"` // from the category SLA
+	CustomFields map[string]any `json:"custom_fields,omitempty"`
+	ResolvedAt   *string        `json:"resolved_at,omitempty"`
+	ReopenCount  int            `json:"reopen_count,omitempty"`
+	MergedInto   *int           `json:"merged_into,omitempty"`
+	Tags         []string       `json:"tags,omitempty"`
+	CreatedAt    string         `json:"created_at"`
+	UpdatedAt    string         `json:"updated_at"`
+}
+
+// TicketLink is a link as seen from one ticket. Type is parent, child or related.
+type TicketLink struct {
+	ID        int    `json:"id"`
+	RequestID int    `json:"request_id"`
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+}
+
+type TicketHistory struct {
+	ID         int     `json:"id"`
+	ActorID    *int    `json:"actor_id"`
+	Action     string  `json:"action"`
+	FromStatus *string `json:"from_status"`
+	ToStatus   *string `json:"to_status"`
+	Detail     *string `json:"detail"`
+	CreatedAt  string  `json:"created_at"`
+}
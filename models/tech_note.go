@@ -5,5 +5,6 @@ type TechNote struct {
 	RequestID    int    `json:"request_id"`
 	TechnicianID int    `json:"technician_id"`
 	Note         string `json:"note"`
+	Internal     bool   `json:"internal"` // only visible to staff
 	CreatedAt    string `json:"created_at"`
 }
\ No newline at end of file
@@ -0,0 +1,52 @@
+package models
+
+const (
+	TechStatusActive   = "active"
+	TechStatusOnLeave  = "on_leave"
+	TechStatusInactive = "inactive"
+)
+
+type WorkingHours struct {
+	Weekday   int    `json:"weekday"`    // 0 = Sunday
+	StartTime string `json:"start_time"` // "09:00"
+	EndTime   string `json:"end_time"`   // "18:00"
+}
+
+type TechnicianProfile struct {
+	UserID               int            `json:"user_id"`
+	Name                 string         `json:"name"`
+	Phone                string         `json:"phone"`
+	Status               string         `json:"status"`
+	MaxConcurrentTickets int            `json:"max_concurrent_tickets"`
+	Bio                  string         `json:"bio"`
+	Skills               []string       `json:"skills"`
+	Regions              []string       `json:"regions"`
+	WorkingHours         []WorkingHours `json:"working_hours"`
+	OpenTickets          int            `json:"open_tickets"`
+}
+
+// TechnicianMetrics is the performance of a technician over a period.
+// Averages and rates are nil when there is nothing to measure; minutes are
+// wall-clock time.
+type TechnicianMetrics struct {
+	TechnicianID int    `json:"technician_id"`
+	Name         string `json:"name"`
+	Rank         int    `json:"rank,omitempty"` // position on the leaderboard
+
+	Resolved   int      `json:"resolved"`    // tickets resolved in the period
+	Reopened   int      `json:"reopened"`    // of those, reopened afterwards
+	ReopenRate *float64 `json:"reopen_rate"` // percent
+
+	AvgFirstResponseMinutes *float64 `json:"avg_first_response_minutes"` // to the technician's first public note
+	AvgResolutionMinutes    *float64 `json:"avg_resolution_minutes"`
+
+	SLAMet        int      `json:"sla_met"` // tickets due in the period
+	SLABreached   int      `json:"sla_breached"`
+	SLACompliance *float64 `json:"sla_compliance"` // percent
+
+	CSATResponses int      `json:"csat_responses"`
+	CSATAverage   *float64 `json:"csat_average"`
+
+	HoursLogged  float64 `json:"hours_logged"` // time entries not rejected
+	OnsiteVisits int     `json:"onsite_visits"`
+}
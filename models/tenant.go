@@ -0,0 +1,24 @@
+package models
+
+// Tenant is a reseller partner running the platform under its own brand.
+type Tenant struct {
+	ID           int    `json:"id"`
+	Slug         string `json:"slug"`
+	Name         string `json:"name"`
+	Domain       string `json:"domain"`
+	BrandName    string `json:"brand_name"`
+	LogoURL      string `json:"logo_url"`
+	PrimaryColor string `json:"primary_color"`
+	SupportEmail string `json:"support_email"`
+	SupportPhone string `json:"support_phone"`
+	Active       bool   `json:"active"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// DisplayName is the name shown to customers: the brand if set, else the tenant name.
+func (t Tenant) DisplayName() string {
+	if t.BrandName != "" {
+		return t.BrandName
+	}
+	return t.Name
+}
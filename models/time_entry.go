@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+const (
+	TimeKindRemote = "remote"
+	TimeKindOnsite = "onsite"
+	TimeKindTravel = "travel"
+
+	TimeEntryPending  = "pending"
+	TimeEntryApproved = "approved"
+	TimeEntryRejected = "rejected"
+)
+
+type TimeEntry struct {
+	ID           int        `json:"id"`
+	RequestID    int        `json:"request_id"`
+	TechnicianID int        `json:"technician_id"`
+	Kind         string     `json:"kind"`
+	StartedAt    time.Time  `json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at"`
+	Minutes      int        `json:"minutes"`
+	Description  string     `json:"description"`
+	Status       string     `json:"status"`
+	ReviewedBy   *int       `json:"reviewed_by"`
+	RejectReason string     `json:"reject_reason,omitempty"`
+	CreatedAt    string     `json:"created_at"`
+}
+
+// TimeTotals are minutes logged, split by kind
+type TimeTotals struct {
+	Remote        int `json:"remote"`
+	Onsite        int `json:"onsite"`
+	Travel        int `json:"travel"`
+	Total         int `json:"total"`
+	ApprovedTotal int `json:"approved_total"`
+	PendingTotal  int `json:"pending_total"`
+	RunningTimers int `json:"running_timers"`
+}
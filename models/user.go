@@ -7,7 +7,8 @@ type User struct {
 	Phone             string `json:"phone"`
  	Email             sql.NullString `json:"email"`
 	PasswordHash      string `json:"-"`
-	Role              string `json:"role"` // user, admin, tech
+	Role              string `json:"role"` // user, admin, tech, superadmin
+	TenantID          int    `json:"tenant_id"`
 	SubscriptionPlan  string `json:"subscription_plan"`
 	SubscriptionStart string `json:"subscription_start"`
 	SubscriptionEnd   string `json:"subscription_end"`
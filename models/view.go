@@ -0,0 +1,23 @@
+package models
+
+import "encoding/json"
+
+// SavedView is a stored ticket filter and sort. Personal views have an
+// owner, shared ones a role instead.
+type SavedView struct {
+	ID        int             `json:"id"`
+	OwnerID   *int            `json:"owner_id"`
+	Role      *string         `json:"role"`
+	Name      string          `json:"name"`
+	Filter    json.RawMessage `json:"filter"`
+	Sort      string          `json:"sort,omitempty"`
+	Order     string          `json:"order"`
+	Count     int             `json:"count"` // matching tickets right now
+	CreatedAt string          `json:"created_at"`
+	UpdatedAt string          `json:"updated_at"`
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
@@ -0,0 +1,27 @@
+package models
+
+type WebhookEndpoint struct {
+	ID           int      `json:"id"`
+	URL          string   `json:"url"`
+	Secret       string   `json:"secret,omitempty"`
+	EventTypes   []string `json:"event_types"`
+	Active       bool     `json:"active"`
+	FailureCount int      `json:"failure_count"`
+	DisabledAt   *string  `json:"disabled_at"`
+	CreatedAt    string   `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID            int     `json:"id"`
+	EndpointID    int     `json:"endpoint_id"`
+	EventType     string  `json:"event_type"`
+	Payload       string  `json:"payload"`
+	Status        string  `json:"status"` // pending, delivered, failed
+	Attempts      int     `json:"attempts"`
+	ResponseCode  *int    `json:"response_code"`
+	ResponseBody  *string `json:"response_body"`
+	LastError     *string `json:"last_error"`
+	NextAttemptAt string  `json:"next_attempt_at"`
+	DeliveredAt   *string `json:"delivered_at"`
+	CreatedAt     string  `json:"created_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+const (
+	WorkOrderDraft  = "draft"
+	WorkOrderSigned = "signed"
+)
+
+type WorkOrderPart struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+type WorkOrder struct {
+	ID              int             `json:"id"`
+	RequestID       int             `json:"request_id"`
+	AppointmentID   *int            `json:"appointment_id"`
+	TechnicianID    int             `json:"technician_id"`
+	Summary         string          `json:"summary"`
+	PartsUsed       []WorkOrderPart `json:"parts_used"`
+	MinutesSpent    int             `json:"minutes_spent"`
+	Status          string          `json:"status"`
+	SignerName      *string         `json:"signer_name"`
+	SignedAt        *string         `json:"signed_at"`
+	SignedLatitude  *float64        `json:"signed_latitude"`
+	SignedLongitude *float64        `json:"signed_longitude"`
+	HasPDF          bool            `json:"has_pdf"`
+	CreatedAt       string          `json:"created_at"`
+	UpdatedAt       string          `json:"updated_at"`
+}
@@ -0,0 +1,77 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+
+	"ithelp/events"
+)
+
+// batchTitles summarise several messages of one event type to one recipient.
+var batchTitles = map[string]string{
+	events.TicketStatusChanged: "Müraciətlərinizin statusu dəyişdi",
+	events.TicketAssigned:      "Müraciətlər üzrə texnik təyinatı",
+}
+
+type batchKey struct {
+	userID    int
+	eventType string
+}
+
+// Batch collects the notifications of a bulk ticket change so each recipient
+// gets one summary per event type instead of a message per ticket. Events
+// added to a batch should be published with Data["bulk"] = true so the
+// notifier does not send them again.
+type Batch struct {
+	tenantID int
+	order    []batchKey
+	msgs     map[batchKey][]message
+	requests map[batchKey][]int
+}
+
+func NewBatch(tenantID int) *Batch {
+	return &Batch{tenantID: tenantID, msgs: map[batchKey][]message{}, requests: map[batchKey][]int{}}
+}
+
+// Add queues the messages the notifier would send for the event.
+func (b *Batch) Add(e events.Event) {
+	if !IsEventType(e.Type) {
+		return
+	}
+	for _, m := range messages(e) {
+		k := batchKey{m.userID, e.Type}
+		if _, ok := b.msgs[k]; !ok {
+			b.order = append(b.order, k)
+		}
+		b.msgs[k] = append(b.msgs[k], m)
+		b.requests[k] = append(b.requests[k], e.RequestID)
+	}
+}
+
+// Record writes the queued summaries to the outbox. Pass the transaction of
+// the bulk change.
+func (b *Batch) Record(q Querier) error {
+	for _, k := range b.order {
+		msgs := b.msgs[k]
+		m := msgs[0]
+		var requestID *int
+		if len(msgs) == 1 {
+			requestID = &b.requests[k][0]
+		} else {
+			bodies := make([]string, len(msgs))
+			for i, msg := range msgs {
+				bodies[i] = msg.body
+			}
+			title, ok := batchTitles[k.eventType]
+			if !ok {
+				title = m.title
+			}
+			m = message{m.userID, fmt.Sprintf("%s (%d)", title, len(msgs)), strings.Join(bodies, "\n")}
+		}
+
+		if err := store(q, b.tenantID, k.eventType, []message{m}, requestID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package notifications
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"ithelp/db"
+	"ithelp/events"
+	"ithelp/models"
+	"ithelp/tenants"
+	"ithelp/utils"
+)
+
+// Event types users can be notified about
+var EventTypes = []string{
+	events.TicketCreated,
+	events.TicketStatusChanged,
+	events.TicketAssigned,
+	events.NoteAdded,
+	events.SubscriptionExpired,
+	events.AppointmentScheduled,
+	events.AppointmentRescheduled,
+	events.AppointmentCancelled,
+	events.StockLow,
+}
+
+// DefaultPreference is used when the user has not stored a preference for the event type.
+// Status and assignment emails were sent unconditionally before preferences existed.
+func DefaultPreference(eventType string) models.NotificationPreference {
+	p := models.NotificationPreference{EventType: eventType, InApp: true}
+	switch eventType {
+	case events.TicketStatusChanged, events.TicketAssigned, events.SubscriptionExpired,
+		events.AppointmentScheduled, events.AppointmentRescheduled, events.AppointmentCancelled:
+		p.Email = true
+	}
+	return p
+}
+
+func IsEventType(t string) bool {
+	for _, et := range EventTypes {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+type message struct {
+	userID int
+	title  string
+	body   string
+}
+
+// toAdmins as a message userID sends the message to every admin.
+const toAdmins = -1
+
+const (
+	pollInterval = 5 * time.Second
+	batchSize    = 100
+)
+
+// Querier is satisfied by *sql.DB and *sql.Tx.
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Start sends the messages of the notification outbox in the background.
+// Messages are added by Enqueue where events happen.
+func Start() {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := sendPending(); err != nil {
+				log.Printf("notifications: outbox run failed: %v", err)
+			}
+		}
+	}()
+}
+
+// messages decides who hears about an event and what they are told.
+func messages(e events.Event) []message {
+	switch e.Type {
+	case events.TicketCreated:
+		return []message{{e.UserID, "Müraciətiniz qəbul olundu", fmt.Sprintf("Müraciət #%d yaradıldı.", e.RequestID)}}
+	case events.TicketStatusChanged:
+		return []message{{e.UserID, "Müraciətinizin statusu dəyişdi", fmt.Sprintf("Müraciət #%d statusu dəyişdirildi: %v", e.RequestID, e.Data["status"])}}
+	case events.TicketAssigned:
+		if e.AssignedTo == nil {
+			return nil
+		}
+		return []message{
+			{*e.AssignedTo, "Sizə yeni texniki müraciət təyin olundu", fmt.Sprintf("Müraciət ID #%d sizə təyin edildi.", e.RequestID)},
+			{e.UserID, "Müraciətinizə texnik təyin olundu", fmt.Sprintf("Müraciət #%d üçün texnik təyin edildi.", e.RequestID)},
+		}
+	case events.NoteAdded:
+		if e.Data["internal"] == true {
+			return nil
+		}
+		return []message{{e.UserID, "Müraciətinizə yeni qeyd əlavə olundu", fmt.Sprintf("Müraciət #%d üzrə texnik yeni qeyd əlavə etdi.", e.RequestID)}}
+	case events.AppointmentScheduled, events.AppointmentRescheduled, events.AppointmentCancelled:
+		return appointmentMessages(e)
+	case events.SubscriptionExpired:
+		return []message{{e.UserID, "Abunəliyinizin müddəti bitdi", fmt.Sprintf("%v planı üzrə abunəliyinizin müddəti başa çatdı.", e.Data["subscription_plan"])}}
+	case events.StockLow:
+		return []message{{toAdmins, "Anbarda ehtiyat azalıb", fmt.Sprintf("%v: %v yerində %v ədəd qalıb (hədd %v).", e.Data["part_name"], e.Data["location_name"], e.Data["quantity"], e.Data["threshold"])}}
+	}
+	return nil
+}
+
+func appointmentMessages(e events.Event) []message {
+	when := ""
+	if t, ok := e.Data["starts_at"].(time.Time); ok {
+		when = t.In(utils.BusinessLocation()).Format("02.01.2006 15:04")
+	}
+	techID, _ := e.Data["technician_id"].(int)
+
+	var title, body string
+	switch e.Type {
+	case events.AppointmentScheduled:
+		title, body = "Ünvana gəliş təyin olundu", fmt.Sprintf("Müraciət #%d üzrə ünvana gəliş vaxtı: %s", e.RequestID, when)
+	case events.AppointmentRescheduled:
+		title, body = "Ünvana gəliş vaxtı dəyişdi", fmt.Sprintf("Müraciət #%d üzrə yeni gəliş vaxtı: %s", e.RequestID, when)
+	default:
+		title, body = "Ünvana gəliş ləğv olundu", fmt.Sprintf("Müraciət #%d üzrə %s tarixli gəliş ləğv edildi.", e.RequestID, when)
+	}
+	return []message{{e.UserID, title, body}, {techID, title, body}}
+}
+
+// Enqueue writes the messages of an event to the outbox. Pass the
+// transaction of the change that caused the event, so they are committed
+// together with it.
+func Enqueue(q Querier, e events.Event) error {
+	// bulk changes are notified once per recipient through a Batch
+	if !IsEventType(e.Type) || e.Data["bulk"] == true {
+		return nil
+	}
+	var requestID *int
+	if e.RequestID != 0 {
+		requestID = &e.RequestID
+	}
+	return store(q, e.TenantID, e.Type, messages(e), requestID)
+}
+
+func store(q Querier, tenantID int, eventType string, msgs []message, requestID *int) error {
+	msgs, err := expandAdmins(q, tenantID, msgs)
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if m.userID == 0 {
+			continue
+		}
+		if _, err := q.Exec(`INSERT INTO notification_outbox (tenant_id, user_id, event_type, title, body, request_id) VALUES (?, ?, ?, ?, ?, ?)`,
+			tenantID, m.userID, eventType, m.title, m.body, requestID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendPending delivers the outbox oldest first. A message is claimed before
+// it is sent, so two app instances never send it twice.
+func sendPending() error {
+	database, err := db.Connect()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`
+		SELECT id, tenant_id, user_id, event_type, title, body, request_id FROM notification_outbox
+		WHERE sent_at IS NULL ORDER BY id LIMIT ?`, batchSize)
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id        int64
+		tenantID  int
+		eventType string
+		msg       message
+		requestID *int
+	}
+	var list []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.tenantID, &p.msg.userID, &p.eventType, &p.msg.title, &p.msg.body, &p.requestID); err != nil {
+			continue
+		}
+		list = append(list, p)
+	}
+	rows.Close()
+
+	for _, p := range list {
+		res, err := database.Exec(`UPDATE notification_outbox SET sent_at = NOW() WHERE id = ? AND sent_at IS NULL`, p.id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		deliver(database, p.tenantID, p.eventType, p.msg, p.requestID)
+	}
+	return nil
+}
+
+// deliver stores and sends one message according to the recipient's
+// preference for the event type.
+func deliver(database *sql.DB, tenantID int, eventType string, m message, requestID *int) {
+	if m.userID == 0 {
+		return
+	}
+	pref, err := Preference(database, m.userID, eventType)
+	if err != nil {
+		log.Printf("notifications: preference lookup for user %d failed: %v", m.userID, err)
+		pref = DefaultPreference(eventType)
+	}
+
+	if pref.InApp {
+		if _, err := database.Exec(`INSERT INTO notifications (user_id, type, title, body, request_id) VALUES (?, ?, ?, ?, ?)`,
+			m.userID, eventType, m.title, m.body, requestID); err != nil {
+			log.Printf("notifications: insert for user %d failed: %v", m.userID, err)
+		}
+	}
+	if !pref.Email && !pref.SMS {
+		return
+	}
+
+	var email sql.NullString
+	var phone string
+	if err := database.QueryRow("SELECT email, phone FROM users WHERE id = ?", m.userID).Scan(&email, &phone); err != nil {
+		return
+	}
+	if pref.Email && email.Valid && email.String != "" {
+		subject, body := m.title, m.body
+		if tenant, err := tenants.ByID(tenantID); err == nil {
+			subject, body = tenants.BrandEmail(tenant, subject, body)
+		}
+		if err := utils.SendEmail(email.String, subject, body); err != nil {
+			log.Printf("notifications: email to user %d failed: %v", m.userID, err)
+		}
+	}
+	if pref.SMS && phone != "" {
+		if err := utils.SendSMS(phone, m.body); err != nil {
+			log.Printf("notifications: sms to user %d failed: %v", m.userID, err)
+		}
+	}
+}
+
+func expandAdmins(database Querier, tenantID int, msgs []message) ([]message, error) {
+	var out []message
+	for _, m := range msgs {
+		if m.userID != toAdmins {
+			out = append(out, m)
+			continue
+		}
+		rows, err := database.Query(`SELECT id FROM users WHERE role = 'admin' AND tenant_id = ?`, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int
+			if rows.Scan(&id) == nil {
+				out = append(out, message{id, m.title, m.body})
+			}
+		}
+		rows.Close()
+	}
+	return out, nil
+}
+
+// Preference returns the user's stored preference for an event type, or the default.
+func Preference(database *sql.DB, userID int, eventType string) (models.NotificationPreference, error) {
+	p := models.NotificationPreference{EventType: eventType}
+	err := database.QueryRow(`SELECT in_app, email, sms FROM notification_preferences WHERE user_id = ? AND event_type = ?`,
+		userID, eventType).Scan(&p.InApp, &p.Email, &p.SMS)
+	if err == sql.ErrNoRows {
+		return DefaultPreference(eventType), nil
+	}
+	return p, err
+}
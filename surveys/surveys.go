@@ -0,0 +1,199 @@
+package surveys
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"ithelp/db"
+	"ithelp/models"
+	"ithelp/tenants"
+	"ithelp/utils"
+)
+
+// TokenPurpose binds survey links to surveys, see utils.SignToken.
+const TokenPurpose = "csat"
+
+// TokenTTL is how long a survey can be answered.
+const TokenTTL = 14 * 24 * time.Hour
+
+// ReminderAfter is how long an unanswered survey waits for its one reminder.
+const ReminderAfter = 48 * time.Hour
+
+const pollInterval = time.Minute
+
+// Start sends the surveys that were created inside a transaction, or whose
+// first delivery did not happen, in the background.
+func Start() {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := DeliverPending(); err != nil {
+				log.Printf("surveys: delivery run failed: %v", err)
+			}
+		}
+	}()
+}
+
+// Link is the page the customer answers the survey on. Tenants with their
+// own domain get links on it, others use SURVEY_URL.
+func Link(tenant models.Tenant, token string) string {
+	base := os.Getenv("SURVEY_URL")
+	if tenant.Domain != "" {
+		base = "https://" + tenant.Domain + "/survey"
+	}
+	if base == "" {
+		base = "https://ithelp.az/survey"
+	}
+	return strings.TrimSuffix(base, "/") + "/" + token
+}
+
+// Create adds the survey of a resolved ticket, in the transaction of the
+// status change when there is one. It returns 0 when the ticket already has
+// a survey: a reopened ticket resolved again keeps the first one.
+func Create(q interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, requestID int) (int, error) {
+	result, err := q.Exec(`
+		INSERT IGNORE INTO csat_surveys (tenant_id, request_id, customer_id, technician_id, category_id, category)
+		SELECT tenant_id, id, user_id, assigned_to, category_id, category FROM support_requests WHERE id = ?`, requestID)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return 0, nil
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// Deliver sends a created survey unless it went out already. The token is
+// valid from the delivery on.
+func Deliver(surveyID int) error {
+	database, err := db.Connect()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	return deliver(database, surveyID)
+}
+
+func deliver(database *sql.DB, surveyID int) error {
+	result, err := database.Exec(`UPDATE csat_surveys SET sent_at = NOW(), delivered_at = NOW() WHERE id = ? AND delivered_at IS NULL`, surveyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+	return send(database, surveyID, false)
+}
+
+// DeliverPending sends every survey not delivered yet.
+func DeliverPending() error {
+	database, err := db.Connect()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`SELECT id FROM csat_surveys WHERE delivered_at IS NULL ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := deliver(database, id); err != nil {
+			log.Printf("surveys: survey %d failed: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// send delivers the survey link by email, or by SMS to customers without email.
+func send(database *sql.DB, surveyID int, reminder bool) error {
+	var tenantID, requestID int
+	var title string
+	var email sql.NullString
+	var phone string
+	var sentAt time.Time
+	err := database.QueryRow(`
+		SELECT cs.tenant_id, cs.request_id, s.title, u.email, u.phone, cs.sent_at
+		FROM csat_surveys cs
+		JOIN support_requests s ON s.id = cs.request_id
+		JOIN users u ON u.id = cs.customer_id
+		WHERE cs.id = ?`, surveyID).Scan(&tenantID, &requestID, &title, &email, &phone, &sentAt)
+	if err != nil {
+		return err
+	}
+
+	tenant, err := tenants.ByID(tenantID)
+	if err != nil {
+		return err
+	}
+	link := Link(tenant, utils.SignToken(TokenPurpose, surveyID, sentAt.Add(TokenTTL)))
+
+	subject := "Xidmətimizi qiymətləndirin"
+	body := fmt.Sprintf("Müraciət #%d (%s) həll olundu. Zəhmət olmasa xidmətimizi 1-5 arası qiymətləndirin: %s", requestID, title, link)
+	if reminder {
+		subject = "Xatırlatma: " + subject
+	}
+
+	if email.Valid && email.String != "" {
+		subject, body := tenants.BrandEmail(tenant, subject, body)
+		return utils.SendEmail(email.String, subject, body)
+	}
+	if phone != "" {
+		return utils.SendSMS(phone, body)
+	}
+	return nil
+}
+
+// SendReminders reminds customers once about surveys unanswered for
+// ReminderAfter and still open.
+func SendReminders() error {
+	database, err := db.Connect()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`
+		SELECT id FROM csat_surveys
+		WHERE rating IS NULL AND reminded_at IS NULL AND delivered_at IS NOT NULL AND sent_at < ? AND sent_at > ?`,
+		time.Now().Add(-ReminderAfter), time.Now().Add(-TokenTTL))
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		// mark first so a failing mailbox is not retried every run
+		if _, err := database.Exec(`UPDATE csat_surveys SET reminded_at = NOW() WHERE id = ?`, id); err != nil {
+			return err
+		}
+		if err := send(database, id, true); err != nil {
+			log.Printf("surveys: reminder for survey %d failed: %v", id, err)
+		}
+	}
+	return nil
+}
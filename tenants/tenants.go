@@ -0,0 +1,172 @@
+package tenants
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"ithelp/db"
+	"ithelp/models"
+)
+
+// DefaultID is the tenant that owned all data before multi-tenant mode and
+// that requests without a tenant hint resolve to.
+const DefaultID = 1
+
+// Header lets API clients pick a tenant by slug instead of host name.
+const Header = "X-Tenant"
+
+var ErrUnknown = errors.New("unknown tenant")
+
+const cacheTTL = time.Minute
+
+type cached struct {
+	tenant   models.Tenant
+	loadedAt time.Time
+}
+
+var (
+	mu     sync.RWMutex
+	byID   = map[int]cached{}
+	byKey  = map[string]int{} // slug or domain -> id
+	keysAt = map[string]time.Time{}
+)
+
+const columns = `id, slug, name, COALESCE(domain, ''), COALESCE(brand_name, ''), COALESCE(logo_url, ''),
+	COALESCE(primary_color, ''), COALESCE(support_email, ''), COALESCE(support_phone, ''), active, created_at`
+
+func Scan(row interface{ Scan(...any) error }) (models.Tenant, error) {
+	var t models.Tenant
+	err := row.Scan(&t.ID, &t.Slug, &t.Name, &t.Domain, &t.BrandName, &t.LogoURL,
+		&t.PrimaryColor, &t.SupportEmail, &t.SupportPhone, &t.Active, &t.CreatedAt)
+	return t, err
+}
+
+// Columns is the select list matching Scan.
+func Columns() string {
+	return columns
+}
+
+// loader reads a tenant from the database; tests replace it.
+var loader = load
+
+func load(where string, arg any) (models.Tenant, error) {
+	database, err := db.Connect()
+	if err != nil {
+		return models.Tenant{}, err
+	}
+	defer database.Close()
+
+	t, err := Scan(database.QueryRow(`SELECT `+columns+` FROM tenants WHERE `+where, arg))
+	if err == sql.ErrNoRows {
+		return t, ErrUnknown
+	}
+	return t, err
+}
+
+func remember(key string, t models.Tenant) {
+	mu.Lock()
+	defer mu.Unlock()
+	byID[t.ID] = cached{t, time.Now()}
+	if key != "" {
+		byKey[key] = t.ID
+		keysAt[key] = time.Now()
+	}
+}
+
+// ByID returns a tenant, cached for a minute.
+func ByID(id int) (models.Tenant, error) {
+	mu.RLock()
+	c, ok := byID[id]
+	mu.RUnlock()
+	if ok && time.Since(c.loadedAt) < cacheTTL {
+		return c.tenant, nil
+	}
+
+	t, err := loader(`id = ?`, id)
+	if err != nil {
+		return t, err
+	}
+	remember("", t)
+	return t, nil
+}
+
+func byLookupKey(key, where string) (models.Tenant, error) {
+	mu.RLock()
+	id, ok := byKey[key]
+	at := keysAt[key]
+	mu.RUnlock()
+	if ok && time.Since(at) < cacheTTL {
+		return ByID(id)
+	}
+
+	t, err := loader(where, strings.TrimPrefix(key, "domain:"))
+	if err != nil {
+		return t, err
+	}
+	remember(key, t)
+	return t, nil
+}
+
+// Resolve finds the tenant of a request: the X-Tenant header (slug) wins,
+// then an exact domain match of the host, then the first host label as slug
+// (acme.ithelp.az -> acme). Anything else is the default tenant.
+func Resolve(header, host string) (models.Tenant, error) {
+	if header != "" {
+		return byLookupKey(strings.ToLower(header), `slug = ?`)
+	}
+
+	host = strings.ToLower(host)
+	if i := strings.IndexByte(host, ':'); i >= 0 {
+		host = host[:i]
+	}
+	if host != "" {
+		if t, err := byLookupKey("domain:"+host, `domain = ?`); err == nil {
+			return t, nil
+		} else if err != ErrUnknown {
+			return t, err
+		}
+		if labels := strings.Split(host, "."); len(labels) > 2 {
+			if t, err := byLookupKey(labels[0], `slug = ?`); err == nil {
+				return t, nil
+			} else if err != ErrUnknown {
+				return t, err
+			}
+		}
+	}
+	return ByID(DefaultID)
+}
+
+// Forget drops a tenant from the cache after it was changed.
+func Forget(id int) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(byID, id)
+	for k, v := range byKey {
+		if v == id {
+			delete(byKey, k)
+			delete(keysAt, k)
+		}
+	}
+}
+
+// BrandEmail puts the tenant's brand into an outgoing email: the subject is
+// prefixed with the brand name and the body gets a signature with the
+// tenant's support contacts.
+func BrandEmail(t models.Tenant, subject, body string) (string, string) {
+	name := t.DisplayName()
+	if name == "" {
+		return subject, body
+	}
+
+	signature := "\n\n--\n" + name
+	if t.SupportEmail != "" {
+		signature += "\n" + t.SupportEmail
+	}
+	if t.SupportPhone != "" {
+		signature += "\n" + t.SupportPhone
+	}
+	return "[" + name + "] " + subject, body + signature
+}
@@ -0,0 +1,101 @@
+package tenants
+
+import (
+	"testing"
+	"time"
+
+	"ithelp/models"
+)
+
+// fakeTenants replaces the database with a fixed set of tenants and empties
+// the cache.
+func fakeTenants(t *testing.T, list ...models.Tenant) {
+	t.Helper()
+	prev := loader
+	loader = func(where string, arg any) (models.Tenant, error) {
+		for _, tenant := range list {
+			switch where {
+			case `id = ?`:
+				if arg == tenant.ID {
+					return tenant, nil
+				}
+			case `slug = ?`:
+				if arg == tenant.Slug {
+					return tenant, nil
+				}
+			case `domain = ?`:
+				if tenant.Domain != "" && arg == tenant.Domain {
+					return tenant, nil
+				}
+			}
+		}
+		return models.Tenant{}, ErrUnknown
+	}
+	reset := func() {
+		mu.Lock()
+		byID, byKey, keysAt = map[int]cached{}, map[string]int{}, map[string]time.Time{}
+		mu.Unlock()
+	}
+	reset()
+	t.Cleanup(func() {
+		loader = prev
+		reset()
+	})
+}
+
+func TestResolve(t *testing.T) {
+	fakeTenants(t,
+		models.Tenant{ID: DefaultID, Slug: "default", Active: true},
+		models.Tenant{ID: 2, Slug: "acme", Domain: "help.acme.com", Active: true},
+		models.Tenant{ID: 3, Slug: "globex", Active: true},
+	)
+
+	tests := []struct {
+		name    string
+		header  string
+		host    string
+		want    int
+		wantErr error
+	}{
+		{"header slug", "acme", "ithelp.az", 2, nil},
+		{"header is case-insensitive", "GLOBEX", "", 3, nil},
+		{"header wins over host", "globex", "help.acme.com", 3, nil},
+		{"unknown header slug", "initech", "help.acme.com", 0, ErrUnknown},
+		{"exact domain", "", "help.acme.com", 2, nil},
+		{"domain with port", "", "help.acme.com:8080", 2, nil},
+		{"subdomain slug", "", "globex.ithelp.az", 3, nil},
+		{"subdomain is case-insensitive", "", "ACME.ithelp.az", 2, nil},
+		{"unknown subdomain", "", "initech.ithelp.az", DefaultID, nil},
+		{"bare host", "", "ithelp.az", DefaultID, nil},
+		{"no host", "", "", DefaultID, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(tt.header, tt.host)
+			if err != tt.wantErr {
+				t.Fatalf("Resolve(%q, %q) error = %v, want %v", tt.header, tt.host, err, tt.wantErr)
+			}
+			if err == nil && got.ID != tt.want {
+				t.Errorf("Resolve(%q, %q) = tenant %d, want %d", tt.header, tt.host, got.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestForgetDropsCachedKeys(t *testing.T) {
+	fakeTenants(t, models.Tenant{ID: 2, Slug: "acme"})
+
+	if _, err := Resolve("acme", ""); err != nil {
+		t.Fatal(err)
+	}
+	Forget(2)
+
+	mu.RLock()
+	defer mu.RUnlock()
+	if _, ok := byID[2]; ok {
+		t.Error("tenant 2 still cached by id")
+	}
+	if _, ok := byKey["acme"]; ok {
+		t.Error("tenant 2 still cached by slug")
+	}
+}
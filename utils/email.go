@@ -1,8 +1,13 @@
 package utils
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
+	"mime"
+	"mime/multipart"
 	"net/smtp"
+	"net/textproto"
 	"os"
 )
 
@@ -38,4 +43,40 @@ func SendEmailHTML(to string, subject string, htmlBody string) error {
 
 	auth := smtp.PlainAuth("", from, password, host)
 	return smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
-}
\ No newline at end of file
+}
+
+// SendEmailAttachment sends a plain text email with one file attached.
+func SendEmailAttachment(to string, subject string, body string, filename string, contentType string, data []byte) error {
+	from := os.Getenv("MAIL_FROM")
+	password := os.Getenv("SMTP_PASS")
+	host := os.Getenv("SMTP_HOST")
+	port := os.Getenv("SMTP_PORT")
+	addr := fmt.Sprintf("%s:%s", host, port)
+
+	var parts bytes.Buffer
+	mw := multipart.NewWriter(&parts)
+	text, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=\"UTF-8\""}})
+	text.Write([]byte(body))
+	file, _ := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": filename})},
+	})
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		file.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	file.Write([]byte(encoded))
+	mw.Close()
+
+	msg := "From: " + from + "\n" +
+		"To: " + to + "\n" +
+		"MIME-Version: 1.0\n" +
+		"Content-Type: multipart/mixed; boundary=\"" + mw.Boundary() + "\"\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\n\n" +
+		parts.String()
+
+	auth := smtp.PlainAuth("", from, password, host)
+	return smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
+}
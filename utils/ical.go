@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type CalendarEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	Cancelled   bool
+	Updated     time.Time
+}
+
+func escapeICS(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// foldICS splits content lines longer than 75 octets as RFC 5545 requires.
+func foldICS(line string) string {
+	if len(line) <= 75 {
+		return line + "\r\n"
+	}
+	var b strings.Builder
+	for len(line) > 75 {
+		cut := 75
+		// do not split inside a multi-byte UTF-8 sequence
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+	}
+	b.WriteString(line + "\r\n")
+	return b.String()
+}
+
+// BuildICS renders an iCalendar (.ics) document with the given events.
+func BuildICS(calendarName string, events []CalendarEvent) string {
+	const stamp = "20060102T150405Z"
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\n")
+	b.WriteString("VERSION:2.0\r\n")
+	b.WriteString("PRODID:-//ITHelp//Appointments//AZ\r\n")
+	b.WriteString("CALSCALE:GREGORIAN\r\n")
+	b.WriteString("METHOD:PUBLISH\r\n")
+	b.WriteString(foldICS("X-WR-CALNAME:" + escapeICS(calendarName)))
+
+	now := time.Now().UTC().Format(stamp)
+	for _, e := range events {
+		b.WriteString("BEGIN:VEVENT\r\n")
+		b.WriteString(foldICS("UID:" + e.UID))
+		b.WriteString("DTSTAMP:" + now + "\r\n")
+		b.WriteString("DTSTART:" + e.Start.UTC().Format(stamp) + "\r\n")
+		b.WriteString("DTEND:" + e.End.UTC().Format(stamp) + "\r\n")
+		if !e.Updated.IsZero() {
+			b.WriteString("LAST-MODIFIED:" + e.Updated.UTC().Format(stamp) + "\r\n")
+		}
+		b.WriteString(foldICS("SUMMARY:" + escapeICS(e.Summary)))
+		if e.Description != "" {
+			b.WriteString(foldICS("DESCRIPTION:" + escapeICS(e.Description)))
+		}
+		if e.Location != "" {
+			b.WriteString(foldICS("LOCATION:" + escapeICS(e.Location)))
+		}
+		if e.Cancelled {
+			b.WriteString("STATUS:CANCELLED\r\n")
+		} else {
+			b.WriteString("STATUS:CONFIRMED\r\n")
+		}
+		b.WriteString("END:VEVENT\r\n")
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	return b.String()
+}
+
+// CalendarUID builds a stable event UID for a record.
+func CalendarUID(kind string, id int) string {
+	return fmt.Sprintf("%s-%d@ithelp", kind, id)
+}
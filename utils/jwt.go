@@ -12,10 +12,11 @@ import (
 
 var secret = []byte(os.Getenv("JWT_SECRET"))
 
-func GenerateJWT(userID int, role string) (string, error) {
+func GenerateJWT(userID int, role string, tenantID int) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id": userID,
-		"role":    role,
+		"user_id":   userID,
+		"role":      role,
+		"tenant_id": tenantID,
 		"exp":     time.Now().Add(time.Hour * 72).Unix(),
 	}
 
@@ -39,6 +40,11 @@ func ParseJWT(tokenStr string) (models.User, error) {
 	if claims, ok := token.Claims.(jwt.MapClaims); ok {
 		user.ID = int(claims["user_id"].(float64))
 		user.Role = claims["role"].(string)
+		// tokens issued before multi-tenant mode belong to the default tenant
+		user.TenantID = 1
+		if tenantID, ok := claims["tenant_id"].(float64); ok {
+			user.TenantID = int(tenantID)
+		}
 
 		// return full JSON string to avoid DB call in `me`
 		bytes, _ := json.Marshal(user)
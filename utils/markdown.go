@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// goldmark drops raw HTML from the source unless html.WithUnsafe is set, so
+// article authors cannot inject scripts.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// RenderMarkdown converts markdown to HTML.
+func RenderMarkdown(src string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(src), &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
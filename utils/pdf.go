@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"os"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// letters the core PDF fonts (cp1252) cannot show
+var pdfFallback = strings.NewReplacer(
+	"ə", "e", "Ə", "E",
+	"ş", "s", "Ş", "S",
+	"ğ", "g", "Ğ", "G",
+	"ı", "i", "İ", "I",
+)
+
+// NewPDF returns an A4 document, the font family in use and a function every
+// text should pass through. With PDF_FONT_PATH pointing to a UTF-8 TTF font all
+// Azerbaijani letters are kept; otherwise Helvetica is used and the few it
+// lacks are transliterated.
+func NewPDF() (*gofpdf.Fpdf, string, func(string) string) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 15)
+
+	if fontPath := os.Getenv("PDF_FONT_PATH"); fontPath != "" {
+		pdf.AddUTF8Font("main", "", fontPath)
+		pdf.AddUTF8Font("main", "B", fontPath)
+		if pdf.Ok() {
+			pdf.SetFont("main", "", 11)
+			return pdf, "main", func(s string) string { return s }
+		}
+		pdf.ClearError()
+	}
+
+	pdf.SetFont("Helvetica", "", 11)
+	cp1252 := pdf.UnicodeTranslatorFromDescriptor("cp1252")
+	return pdf, "Helvetica", func(s string) string {
+		return cp1252(pdfFallback.Replace(s))
+	}
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/teambition/rrule-go"
+)
+
+// ErrBadSchedule is returned for schedules that are neither cron nor RRULE.
+var ErrBadSchedule = errors.New("schedule must be a cron expression or an RRULE")
+
+// Schedule is a parsed recurrence, either a standard 5-field cron expression
+// ("0 9 1 * *", "@monthly") or an RFC 5545 RRULE
+// ("FREQ=MONTHLY;BYMONTHDAY=1;BYHOUR=9"). Times are in BusinessLocation and
+// nothing fires before the start.
+type Schedule struct {
+	start time.Time
+	cron  cron.Schedule
+	rule  *rrule.RRule
+}
+
+func ParseSchedule(spec string, start time.Time) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	loc := BusinessLocation()
+	s := &Schedule{start: start.In(loc)}
+
+	upper := strings.ToUpper(spec)
+	if strings.HasPrefix(upper, "RRULE:") || strings.Contains(upper, "FREQ=") {
+		opt, err := rrule.StrToROptionInLocation(spec[strings.Index(upper, "FREQ="):], loc)
+		if err != nil {
+			return nil, ErrBadSchedule
+		}
+		opt.Dtstart = s.start
+		if s.rule, err = rrule.NewRRule(*opt); err != nil {
+			return nil, ErrBadSchedule
+		}
+		return s, nil
+	}
+
+	c, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, ErrBadSchedule
+	}
+	s.cron = c
+	return s, nil
+}
+
+// Next returns the first occurrence after t, or the zero time when the
+// schedule has ended (RRULE COUNT or UNTIL).
+func (s *Schedule) Next(t time.Time) time.Time {
+	if t.Before(s.start) {
+		t = s.start.Add(-time.Second)
+	}
+	if s.rule != nil {
+		return s.rule.After(t, false)
+	}
+	return s.cron.Next(t.In(s.start.Location()))
+}
+
+// Upcoming returns at most n occurrences after t.
+func (s *Schedule) Upcoming(t time.Time, n int) []time.Time {
+	var out []time.Time
+	for len(out) < n {
+		t = s.Next(t)
+		if t.IsZero() {
+			break
+		}
+		out = append(out, t)
+	}
+	return out
+}
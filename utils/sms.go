@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// SendSMS posts the message to the HTTP SMS gateway configured in SMS_API_URL.
+// Without a gateway the message is only logged.
+func SendSMS(to string, message string) error {
+	apiURL := os.Getenv("SMS_API_URL")
+	if apiURL == "" {
+		log.Printf("SMS gateway not configured, skipping SMS to %s: %s", to, message)
+		return nil
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"to":      to,
+		"from":    os.Getenv("SMS_FROM"),
+		"message": message,
+	})
+	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("SMS_API_KEY"))
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sms gateway returned %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var ErrBadFormat = errors.New("format must be csv or xlsx")
+
+// SheetContentTypes maps the supported export formats to their MIME type.
+var SheetContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// SheetWriter writes rows of a report one at a time. Values may be nil,
+// strings, integers, floats and times; times are shown in business time.
+type SheetWriter interface {
+	Write(row []any) error
+	Close() error
+}
+
+// NewSheetWriter starts a csv or xlsx document with a header row on w. The
+// document is complete only after Close.
+func NewSheetWriter(w io.Writer, format string, headers []string) (SheetWriter, error) {
+	head := make([]any, len(headers))
+	for i, h := range headers {
+		head[i] = h
+	}
+	var sw SheetWriter
+	switch format {
+	case "csv":
+		// the BOM makes Excel read the file as UTF-8
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return nil, err
+		}
+		sw = &csvSheet{w: csv.NewWriter(w), out: w}
+	case "xlsx":
+		f := excelize.NewFile()
+		stream, err := f.NewStreamWriter("Sheet1")
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		bold, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+		sw = &xlsxSheet{f: f, stream: stream, out: w, headStyle: bold}
+	default:
+		return nil, ErrBadFormat
+	}
+	if err := sw.Write(head); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// csvFlushRows is how often buffered csv rows are pushed to the client.
+const csvFlushRows = 500
+
+type csvSheet struct {
+	w    *csv.Writer
+	out  io.Writer
+	rows int
+}
+
+func (s *csvSheet) Write(row []any) error {
+	record := make([]string, len(row))
+	for i, v := range row {
+		record[i] = csvValue(v)
+	}
+	if err := s.w.Write(record); err != nil {
+		return err
+	}
+	s.rows++
+	if s.rows%csvFlushRows == 0 {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *csvSheet) flush() error {
+	s.w.Flush()
+	if err := s.w.Error(); err != nil {
+		return err
+	}
+	if b, ok := s.out.(*bufio.Writer); ok {
+		return b.Flush()
+	}
+	return nil
+}
+
+func (s *csvSheet) Close() error {
+	return s.flush()
+}
+
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return csvText(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int, int64:
+		return fmt.Sprint(v)
+	case time.Time:
+		return v.In(BusinessLocation()).Format("2006-01-02 15:04:05")
+	default:
+		return csvText(fmt.Sprint(v))
+	}
+}
+
+// csvText keeps spreadsheet programs from running text as a formula: cells
+// starting with =, +, -, @, tab or carriage return get a leading quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// xlsxSheet keeps rows in excelize's stream writer, which spills them to a
+// temporary file past a few megabytes, and writes the workbook on Close.
+type xlsxSheet struct {
+	f         *excelize.File
+	stream    *excelize.StreamWriter
+	out       io.Writer
+	row       int
+	headStyle int
+}
+
+func (s *xlsxSheet) Write(row []any) error {
+	s.row++
+	cells := make([]any, len(row))
+	for i, v := range row {
+		if t, ok := v.(time.Time); ok {
+			// Excel has no time zones: store the wall clock in business time
+			y, m, d := t.In(BusinessLocation()).Date()
+			h, min, sec := t.In(BusinessLocation()).Clock()
+			v = time.Date(y, m, d, h, min, sec, 0, time.UTC)
+		}
+		if s.row == 1 {
+			v = excelize.Cell{StyleID: s.headStyle, Value: v}
+		}
+		cells[i] = v
+	}
+	cell, err := excelize.CoordinatesToCellName(1, s.row)
+	if err != nil {
+		return err
+	}
+	return s.stream.SetRow(cell, cells)
+}
+
+func (s *xlsxSheet) Close() error {
+	defer s.f.Close()
+	if err := s.stream.Flush(); err != nil {
+		return err
+	}
+	_, err := s.f.WriteTo(s.out)
+	return err
+}
@@ -0,0 +1,26 @@
+package utils
+
+import "testing"
+
+func TestCSVValueDefusesFormulas(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"plain text", "plain text"},
+		{"", ""},
+		{-5, "-5"},
+		{-1.5, "-1.5"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := csvValue(tt.in); got != tt.want {
+			t.Errorf("csvValue(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
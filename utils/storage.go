@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+)
+
+// UploadDir is where uploaded and generated files are kept (UPLOAD_DIR, default "uploads").
+func UploadDir() string {
+	dir := os.Getenv("UPLOAD_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+	return dir
+}
+
+// NewUploadPath returns a fresh, unguessable file path under UploadDir()/subdir
+// and makes sure the directory exists.
+func NewUploadPath(subdir string, ext string) (string, error) {
+	dir := filepath.Join(UploadDir(), subdir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, hex.EncodeToString(buf)+ext), nil
+}
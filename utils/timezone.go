@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"os"
+	"time"
+)
+
+// BusinessLocation is the timezone working hours and customer-facing times
+// are expressed in (APP_TIMEZONE, default Asia/Baku).
+func BusinessLocation() *time.Location {
+	name := os.Getenv("APP_TIMEZONE")
+	if name == "" {
+		name = "Asia/Baku"
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
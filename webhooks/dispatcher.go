@@ -0,0 +1,298 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"ithelp/db"
+	"ithelp/events"
+)
+
+// Event types endpoints may subscribe to
+var EventTypes = []string{
+	events.TicketCreated,
+	events.TicketStatusChanged,
+	events.UserRegistered,
+	events.SubscriptionExpired,
+	events.InvoicePaid,
+}
+
+const (
+	SignatureHeader = "X-Ithelp-Signature"
+	EventHeader     = "X-Ithelp-Event"
+	DeliveryHeader  = "X-Ithelp-Delivery"
+
+	// an endpoint is disabled after this many deliveries in a row end up failed
+	maxEndpointFailures = 10
+	pollInterval        = 15 * time.Second
+	batchSize           = 50
+	// a claimed delivery is due again after this, should its instance die
+	// while sending; well above the client timeout
+	claimLease = 5 * time.Minute
+)
+
+// retry delays after the 1st, 2nd, ... failed attempt; the delivery is marked
+// failed once they run out
+var backoff = []time.Duration{
+	1 * time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	12 * time.Hour,
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+func IsEventType(t string) bool {
+	for _, et := range EventTypes {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the hex HMAC-SHA256 of body with the endpoint secret.
+// Receivers should compare it against the signature header.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Start runs the delivery worker in the background. It only works the
+// webhook_deliveries table; rows are added by Enqueue where events happen.
+func Start() {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := deliverDue(); err != nil {
+				log.Printf("webhooks: delivery run failed: %v", err)
+			}
+		}
+	}()
+}
+
+// Querier is satisfied by *sql.DB and *sql.Tx.
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Enqueue stores one pending delivery per active endpoint of the event's
+// tenant subscribed to the event. Pass the transaction of the change that
+// caused the event, so the deliveries are committed together with it.
+func Enqueue(q Querier, e events.Event) error {
+	if !IsEventType(e.Type) {
+		return nil
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	rows, err := q.Query(`SELECT id, event_types FROM webhook_endpoints WHERE active = 1 AND tenant_id = ?`, e.TenantID)
+	if err != nil {
+		return err
+	}
+	var endpointIDs []int
+	for rows.Next() {
+		var id int
+		var types string
+		if err := rows.Scan(&id, &types); err != nil {
+			continue
+		}
+		for _, t := range strings.Split(types, ",") {
+			if strings.TrimSpace(t) == e.Type {
+				endpointIDs = append(endpointIDs, id)
+				break
+			}
+		}
+	}
+	rows.Close()
+
+	for _, id := range endpointIDs {
+		res, err := q.Exec(`INSERT INTO webhook_deliveries (endpoint_id, event_type, payload) VALUES (?, ?, ?)`,
+			id, e.Type, "{}")
+		if err != nil {
+			return err
+		}
+		// payload carries its own delivery id, so it is written after the insert
+		deliveryID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(map[string]any{
+			"id":         deliveryID,
+			"type":       e.Type,
+			"created_at": e.CreatedAt,
+			"data":       e,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := q.Exec(`UPDATE webhook_deliveries SET payload = ? WHERE id = ?`, string(payload), deliveryID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type dueDelivery struct {
+	id         int
+	endpointID int
+	eventType  string
+	payload    string
+	attempts   int
+	url        string
+	secret     string
+}
+
+func deliverDue() error {
+	database, err := db.Connect()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	rows, err := database.Query(`
+		SELECT d.id, d.endpoint_id, d.event_type, d.payload, d.attempts, e.url, e.secret
+		FROM webhook_deliveries d
+		JOIN webhook_endpoints e ON e.id = d.endpoint_id
+		WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND e.active = 1
+		ORDER BY d.next_attempt_at
+		LIMIT ?`, batchSize)
+	if err != nil {
+		return err
+	}
+	var due []dueDelivery
+	for rows.Next() {
+		var d dueDelivery
+		if err := rows.Scan(&d.id, &d.endpointID, &d.eventType, &d.payload, &d.attempts, &d.url, &d.secret); err != nil {
+			continue
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	for _, d := range due {
+		claimed, err := claim(database, d.id)
+		if err != nil {
+			log.Printf("webhooks: claiming delivery %d failed: %v", d.id, err)
+			continue
+		}
+		if claimed {
+			attempt(database, d)
+		}
+	}
+	return nil
+}
+
+// claim takes a due delivery for this instance by moving its next attempt
+// past the lease, so other app instances polling at the same time skip it.
+func claim(database *sql.DB, deliveryID int) (bool, error) {
+	result, err := database.Exec(`
+		UPDATE webhook_deliveries SET next_attempt_at = NOW() + INTERVAL ? SECOND
+		WHERE id = ? AND status = 'pending' AND next_attempt_at <= NOW()`,
+		int(claimLease.Seconds()), deliveryID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// Redeliver sends a stored delivery again right away, whatever its status.
+func Redeliver(deliveryID int) error {
+	database, err := db.Connect()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	var d dueDelivery
+	err = database.QueryRow(`
+		SELECT d.id, d.endpoint_id, d.event_type, d.payload, d.attempts, e.url, e.secret
+		FROM webhook_deliveries d
+		JOIN webhook_endpoints e ON e.id = d.endpoint_id
+		WHERE d.id = ?`, deliveryID).Scan(&d.id, &d.endpointID, &d.eventType, &d.payload, &d.attempts, &d.url, &d.secret)
+	if err != nil {
+		return err
+	}
+	// a manual redelivery gets a fresh retry schedule
+	d.attempts = 0
+	attempt(database, d)
+	return nil
+}
+
+func attempt(database *sql.DB, d dueDelivery) {
+	code, body, err := send(d)
+	attempts := d.attempts + 1
+
+	if err == nil && code >= 200 && code < 300 {
+		database.Exec(`UPDATE webhook_deliveries SET status = 'delivered', attempts = ?, response_code = ?, response_body = ?, last_error = NULL, delivered_at = NOW() WHERE id = ?`,
+			attempts, code, body, d.id)
+		database.Exec(`UPDATE webhook_endpoints SET failure_count = 0 WHERE id = ?`, d.endpointID)
+		return
+	}
+
+	errText := fmt.Sprintf("unexpected status %d", code)
+	if err != nil {
+		errText = err.Error()
+	}
+	var respCode *int
+	if code != 0 {
+		respCode = &code
+	}
+
+	if attempts <= len(backoff) {
+		next := time.Now().Add(backoff[attempts-1])
+		database.Exec(`UPDATE webhook_deliveries SET status = 'pending', attempts = ?, response_code = ?, response_body = ?, last_error = ?, next_attempt_at = ? WHERE id = ?`,
+			attempts, respCode, body, errText, next, d.id)
+		return
+	}
+
+	database.Exec(`UPDATE webhook_deliveries SET status = 'failed', attempts = ?, response_code = ?, response_body = ?, last_error = ? WHERE id = ?`,
+		attempts, respCode, body, errText, d.id)
+	database.Exec(`UPDATE webhook_endpoints SET failure_count = failure_count + 1 WHERE id = ?`, d.endpointID)
+	res, _ := database.Exec(`UPDATE webhook_endpoints SET active = 0, disabled_at = NOW() WHERE id = ? AND active = 1 AND failure_count >= ?`,
+		d.endpointID, maxEndpointFailures)
+	if res != nil {
+		if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("webhooks: endpoint %d disabled after %d failed deliveries", d.endpointID, maxEndpointFailures)
+		}
+	}
+}
+
+func send(d dueDelivery) (int, string, error) {
+	body := []byte(d.payload)
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ithelp-webhooks/1.0")
+	req.Header.Set(EventHeader, d.eventType)
+	req.Header.Set(DeliveryHeader, fmt.Sprint(d.id))
+	req.Header.Set(SignatureHeader, Sign(d.secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	// keep only the start of the response for the delivery log
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+	return resp.StatusCode, string(respBody), nil
+}